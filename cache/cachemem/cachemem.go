@@ -0,0 +1,332 @@
+// Package cachemem provides an in-memory implementation of cache.Cache for unit tests.
+// Expiry is driven by a clock which can be replaced by a FakeClock,
+// so that tests can advance time instead of sleeping.
+//
+// Example usage:
+//
+//	clock := cachemem.NewFakeClock(time.Now())
+//	c := cachemem.New(clock.Now)
+//	_ = c.Set(ctx, "key", "value", time.Minute)
+//	clock.Advance(time.Minute) // "key" is now expired
+package cachemem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SeaRoll/zumi/cache"
+)
+
+// Clock returns the current time.
+type Clock func() time.Time
+
+type entry struct {
+	value     string
+	expiresAt time.Time // zero means no expiry
+}
+
+// Cache is an in-memory cache.Cache.
+type Cache struct {
+	mu          sync.Mutex
+	now         Clock
+	entries     map[string]entry
+	subscribers map[string][]chan string
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+var _ cache.Cache = (*Cache)(nil)
+
+// New creates an empty in-memory cache. The clock defaults to time.Now.
+func New(clock ...Clock) *Cache {
+	now := time.Now
+	if len(clock) > 0 && clock[0] != nil {
+		now = clock[0]
+	}
+
+	return &Cache{
+		now:         now,
+		entries:     map[string]entry{},
+		subscribers: map[string][]chan string{},
+		closed:      make(chan struct{}),
+	}
+}
+
+// lookup returns a non-expired entry, removing it if it has expired. Must be called with the lock held.
+func (c *Cache) lookup(key string) (entry, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return entry{}, false
+	}
+
+	if !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		return entry{}, false
+	}
+
+	return e, true
+}
+
+// expiresAt returns the expiry time for a timeout, where 0 means no expiry. Must be called with the lock held.
+func (c *Cache) expiresAt(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+
+	return c.now().Add(timeout)
+}
+
+// Publish publishes a message to a channel.
+func (c *Cache) Publish(_ context.Context, channel string, message string) error {
+	if channel == "" {
+		return errors.New("channel cannot be empty")
+	}
+
+	if message == "" {
+		return errors.New("message cannot be empty")
+	}
+
+	c.mu.Lock()
+	subscribers := append([]chan string{}, c.subscribers[channel]...)
+	c.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		select {
+		case subscriber <- message:
+		case <-c.closed:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Subscribe listens to a channel and calls the callback function for each message received.
+// It blocks until the cache is disconnected.
+func (c *Cache) Subscribe(channel string, callback func(msg string) error) error {
+	messages := make(chan string, 64)
+
+	c.mu.Lock()
+	c.subscribers[channel] = append(c.subscribers[channel], messages)
+	c.mu.Unlock()
+
+	for {
+		select {
+		case <-c.closed:
+			return nil
+		case msg := <-messages:
+			_ = callback(msg)
+		}
+	}
+}
+
+// Lock locks a key in the cache for a specified duration.
+func (c *Cache) Lock(_ context.Context, key string, timeout time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.lookup(key); ok {
+		return false, nil
+	}
+
+	c.entries[key] = entry{value: "1", expiresAt: c.expiresAt(timeout)}
+
+	return true, nil
+}
+
+// Unlock unlocks a key in the cache.
+func (c *Cache) Unlock(ctx context.Context, key string) error {
+	return c.Delete(ctx, key)
+}
+
+// TTL returns the time to live of a key in the cache, rounded to seconds like Valkey.
+// It returns -1 for keys without expiry and -2 for missing keys.
+func (c *Cache) TTL(_ context.Context, key string) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.lookup(key)
+	if !ok {
+		return -2, nil
+	}
+
+	if e.expiresAt.IsZero() {
+		return -1, nil
+	}
+
+	return e.expiresAt.Sub(c.now()).Round(time.Second), nil
+}
+
+// Disconnect stops all subscriptions. The cache can still be used afterwards.
+func (c *Cache) Disconnect(_ ...bool) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+// Set sets a value in the cache with a specified timeout.
+func (c *Cache) Set(_ context.Context, key string, value any, timeout time.Duration) error {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = entry{value: string(jsonValue), expiresAt: c.expiresAt(timeout)}
+
+	return nil
+}
+
+// IncrBy increments the value of a key in the cache by a specified amount.
+func (c *Cache) IncrBy(_ context.Context, key string, increment int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.lookup(key)
+	if !ok {
+		e = entry{value: "0"}
+	}
+
+	current, err := strconv.ParseInt(e.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment key %s by %d: value is not an integer", key, increment)
+	}
+
+	e.value = strconv.FormatInt(current+increment, 10)
+	c.entries[key] = e
+
+	return current + increment, nil
+}
+
+// Get retrieves a value from the cache by its key and unmarshals it into the provided value.
+// Returns an error wrapping cache.ErrNil if the key does not exist.
+func (c *Cache) Get(_ context.Context, key string, value any) error {
+	c.mu.Lock()
+	e, ok := c.lookup(key)
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("failed to get value from cache: %w", cache.ErrNil)
+	}
+
+	err := json.Unmarshal([]byte(e.value), value)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal value: %w", err)
+	}
+
+	return nil
+}
+
+// GetWithResetTTL retrieves a value from the cache by its key, unmarshals it into the provided value and resets its TTL.
+func (c *Cache) GetWithResetTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	err := c.Get(ctx, key, value)
+	if err != nil {
+		return fmt.Errorf("failed to get value from cache: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.lookup(key); ok {
+		e.expiresAt = c.expiresAt(ttl)
+		c.entries[key] = e
+	}
+
+	return nil
+}
+
+// Exists checks if a key exists.
+func (c *Cache) Exists(_ context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.lookup(key)
+
+	return ok, nil
+}
+
+// Delete removes a key from the cache.
+func (c *Cache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+
+	return nil
+}
+
+// Wrapped will attempt to get the value from the cache, if it doesn't exist it will call the fallbackFunc
+// and set the value in the cache. Timeout is optional and will default to 15 minutes. 0 means no timeout.
+// -1 means no cache.
+func (c *Cache) Wrapped(ctx context.Context, key string, data any, fallbackFunc func() error, timeout ...time.Duration) error {
+	if len(timeout) > 0 && timeout[0] == -1 {
+		return fallbackFunc()
+	}
+
+	err := c.Get(ctx, key, data)
+	if err == nil {
+		return nil
+	}
+
+	err = fallbackFunc()
+	if err != nil {
+		return fmt.Errorf("fallback function failed: %w", err)
+	}
+
+	to := cache.DefaultTimeout
+	if len(timeout) > 0 {
+		to = timeout[0]
+	}
+
+	return c.Set(ctx, key, data, to)
+}
+
+// Keys returns all non-expired keys in the cache, for assertions in tests.
+func (c *Cache) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := []string{}
+
+	for key := range c.entries {
+		if _, ok := c.lookup(key); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// FakeClock is a manually advanced clock for tests.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock creates a clock which starts at the given time.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Advance moves the clock forward by the given duration.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
@@ -0,0 +1,56 @@
+package cachemem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/cache"
+	"github.com/SeaRoll/zumi/cache/cachetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) cache.Cache {
+		c := New()
+		t.Cleanup(func() { c.Disconnect() })
+
+		return c
+	})
+}
+
+func TestFakeClock(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := New(clock.Now)
+
+	assert.NoError(t, c.Set(ctx, "key", "value", time.Minute))
+
+	locked, err := c.Lock(ctx, "lock", 30*time.Second)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+
+	ttl, err := c.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	clock.Advance(30 * time.Second)
+
+	ttl, err = c.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, ttl)
+
+	locked, err = c.Lock(ctx, "lock", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, locked, "the previous lock expired")
+
+	clock.Advance(30 * time.Second)
+
+	var value string
+	assert.ErrorIs(t, c.Get(ctx, "key", &value), cache.ErrNil)
+
+	ttl, err = c.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(-2), ttl)
+	assert.Equal(t, []string{"lock"}, c.Keys())
+}
@@ -0,0 +1,214 @@
+// Package cachetest contains a conformance test suite for cache.Cache implementations,
+// which makes sure fakes behave like the Valkey implementation.
+package cachetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/cache"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunConformance runs the conformance test suite against the caches created by newCache.
+// Keys are random, so the caches may share state between tests.
+func RunConformance(t *testing.T, newCache func(t *testing.T) cache.Cache) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	t.Run("set and get", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+
+		require.NoError(t, c.Set(ctx, key, map[string]any{"title": "book", "pages": 42}, time.Minute))
+
+		var value map[string]any
+		require.NoError(t, c.Get(ctx, key, &value))
+		assert.Equal(t, map[string]any{"title": "book", "pages": float64(42)}, value)
+	})
+
+	t.Run("get missing key", func(t *testing.T) {
+		c := newCache(t)
+
+		var value string
+		assert.ErrorIs(t, c.Get(ctx, uuid.NewString(), &value), cache.ErrNil)
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+
+		require.NoError(t, c.Set(ctx, key, "value", 100*time.Millisecond))
+
+		assert.Eventually(t, func() bool {
+			exists, err := c.Exists(ctx, key)
+			return err == nil && !exists
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+
+		require.NoError(t, c.Set(ctx, key, "value", time.Minute))
+
+		ttl, err := c.TTL(ctx, key)
+		require.NoError(t, err)
+		assert.Positive(t, ttl)
+		assert.LessOrEqual(t, ttl, time.Minute)
+
+		require.NoError(t, c.Set(ctx, key, "value", 0))
+
+		ttl, err = c.TTL(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, time.Duration(-1), ttl, "no expiry")
+	})
+
+	t.Run("exists and delete", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+
+		require.NoError(t, c.Set(ctx, key, "value", time.Minute))
+
+		exists, err := c.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		require.NoError(t, c.Delete(ctx, key))
+
+		exists, err = c.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("lock and unlock", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+
+		locked, err := c.Lock(ctx, key, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, locked)
+
+		locked, err = c.Lock(ctx, key, time.Minute)
+		require.NoError(t, err)
+		assert.False(t, locked, "already locked")
+
+		require.NoError(t, c.Unlock(ctx, key))
+
+		locked, err = c.Lock(ctx, key, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, locked)
+	})
+
+	t.Run("incr by", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+
+		value, err := c.IncrBy(ctx, key, 5)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), value)
+
+		value, err = c.IncrBy(ctx, key, -2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), value)
+
+		var stored int64
+		require.NoError(t, c.Get(ctx, key, &stored))
+		assert.Equal(t, int64(3), stored)
+
+		require.NoError(t, c.Set(ctx, key, "not a number", time.Minute))
+
+		_, err = c.IncrBy(ctx, key, 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("get with reset ttl", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+
+		require.NoError(t, c.Set(ctx, key, "value", 10*time.Second))
+
+		var value string
+		require.NoError(t, c.GetWithResetTTL(ctx, key, &value, time.Hour))
+		assert.Equal(t, "value", value)
+
+		ttl, err := c.TTL(ctx, key)
+		require.NoError(t, err)
+		assert.Greater(t, ttl, time.Minute)
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		c := newCache(t)
+		key := uuid.NewString()
+		timesCalled := 0
+
+		var data string
+
+		for range 2 {
+			err := c.Wrapped(ctx, key, &data, func() error {
+				timesCalled++
+				data = "fallbackValue"
+
+				return nil
+			})
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, 1, timesCalled)
+		assert.Equal(t, "fallbackValue", data)
+
+		for range 2 {
+			err := c.Wrapped(ctx, uuid.NewString(), &data, func() error {
+				timesCalled++
+				return nil
+			}, -1)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, 3, timesCalled, "-1 never caches")
+	})
+
+	t.Run("publish and subscribe", func(t *testing.T) {
+		c := newCache(t)
+		channel := uuid.NewString()
+
+		assert.Error(t, c.Publish(ctx, "", "message"))
+		assert.Error(t, c.Publish(ctx, channel, ""))
+
+		var (
+			mu       sync.Mutex
+			received []string
+		)
+
+		go func() {
+			_ = c.Subscribe(channel, func(msg string) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				received = append(received, msg)
+
+				return nil
+			})
+		}()
+
+		// the subscription is asynchronous, so publish until it is received
+		assert.Eventually(t, func() bool {
+			require.NoError(t, c.Publish(ctx, channel, "message"))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			return len(received) > 0
+		}, 5*time.Second, 50*time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.Equal(t, "message", received[0])
+	})
+}
@@ -0,0 +1,26 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/SeaRoll/zumi/cache"
+	"github.com/SeaRoll/zumi/cache/cachetest"
+	"github.com/SeaRoll/zumi/config"
+)
+
+func TestConformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) cache.Cache {
+		c, err := cache.NewCache(config.CacheConfig{
+			Enabled: true,
+			Host:    "localhost",
+			Port:    "6379",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+
+		t.Cleanup(func() { c.Disconnect() })
+
+		return c
+	})
+}
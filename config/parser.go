@@ -9,8 +9,8 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Regex to find all occurrences of ${VAR:fallback}.
-var re = regexp.MustCompile(`\$\{(\w+):([^}]+)\}`)
+// Regex to find all occurrences of ${VAR:fallback} and ${VAR}.
+var re = regexp.MustCompile(`\$\{(\w+)(?::([^}]*))?\}`)
 
 // FromYAML creates a Config instance from a YAML string.
 func FromYAML[T ZumiConfig](data string) (T, error) {
@@ -24,6 +24,8 @@ func FromYAML[T ZumiConfig](data string) (T, error) {
 
 // expandEnvVars processes a string to replace placeholders like ${VAR:default}
 // with the corresponding environment variable's value or the default.
+// A placeholder without a default like ${VAR} is replaced with an empty value if the variable is not set,
+// so that a required value can be validated instead of falling back to a default.
 func expandEnvVars(s string) string {
 	// Find all matches in the input string
 	matches := re.FindAllStringSubmatch(s, -1)
@@ -37,7 +39,7 @@ func expandEnvVars(s string) string {
 	for _, match := range matches {
 		// The full match is match[0], e.g., "${DATABASE_HOST:localhost}"
 		// The variable name is match[1], e.g., "DATABASE_HOST"
-		// The fallback value is match[2], e.g., "localhost"
+		// The fallback value is match[2], e.g., "localhost", empty for "${DATABASE_HOST}"
 		fullMatch := match[0]
 		envVar := match[1]
 		fallback := match[2]
@@ -79,3 +79,25 @@ nullable:
 	t.Logf("Parsed config: %+v", cfg)
 	os.Unsetenv("NULL_FIELD")
 }
+
+func TestParseWithoutFallback(t *testing.T) {
+	yamlContent := `
+server:
+  port: 8080
+database:
+  host: ${DATABASE_HOST}
+  port: ${DATABASE_PORT:5432}
+`
+
+	cfg, err := config.FromYAML[testConfig](yamlContent)
+	assert.Nil(t, err)
+	assert.Equal(t, "", cfg.Database.Host)
+
+	os.Setenv("DATABASE_HOST", "db.example.com")
+
+	cfg, err = config.FromYAML[testConfig](yamlContent)
+	assert.Nil(t, err)
+	assert.Equal(t, "db.example.com", cfg.Database.Host)
+
+	os.Unsetenv("DATABASE_HOST")
+}
@@ -0,0 +1,41 @@
+package database
+
+import "context"
+
+// AuditColumns are the auditing columns of a Repository, which Save populates. An empty column is not populated.
+type AuditColumns struct {
+	CreatedAt string // Set to the time of the transaction when an entity is inserted, and kept when it is updated
+	UpdatedAt string // Set to the time of the transaction when an entity is inserted or updated
+	// Set to the principal of the context when an entity is inserted, see ContextWithPrincipal,
+	// or to the value of the entity if the context has none, and kept when it is updated.
+	CreatedBy string
+}
+
+// DefaultAuditColumns are the conventional auditing columns.
+var DefaultAuditColumns = AuditColumns{
+	CreatedAt: "created_at",
+	UpdatedAt: "updated_at",
+	CreatedBy: "created_by",
+}
+
+type principalContextKey struct{}
+
+// ContextWithPrincipal returns a context carrying the principal, e.g: the name of the authenticated user,
+// which Repository.Save records in the CreatedBy column of the entities it inserts.
+//
+// Example usage:
+//
+//	server.AddMiddleware(func(next http.Handler) http.Handler {
+//	    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	        next.ServeHTTP(w, r.WithContext(database.ContextWithPrincipal(r.Context(), user(r))))
+//	    })
+//	})
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFrom returns the principal carried by the context, and false if it carries none.
+func PrincipalFrom(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(string)
+	return principal, ok && principal != ""
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipal(t *testing.T) {
+	ctx := context.Background()
+
+	_, ok := PrincipalFrom(ctx)
+	assert.False(t, ok)
+
+	_, ok = PrincipalFrom(ContextWithPrincipal(ctx, ""))
+	assert.False(t, ok)
+
+	principal, ok := PrincipalFrom(ContextWithPrincipal(ctx, "alice"))
+	assert.True(t, ok)
+	assert.Equal(t, "alice", principal)
+}
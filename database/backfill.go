@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultBackfillBatchSize is the batch size of a backfill which has none.
+const DefaultBackfillBatchSize = 1000
+
+// BackfillTable is the table of the checkpoints of backfills, created by the first backfill.
+const BackfillTable = "zumi_backfills"
+
+// ErrNoTransactions is returned by RunBackfill when the connection cannot begin transactions.
+var ErrNoTransactions = errors.New("connection cannot begin transactions")
+
+// Backfill processes the rows selected by a query in batches of keys in ascending order.
+type Backfill[K any] struct {
+	Name      string // The unique name of the backfill, identifying its checkpoint
+	Query     string // The query selecting the unique keys of the rows to backfill as its only column, e.g: "SELECT id FROM books"
+	Args      []any  // The arguments of the query
+	BatchSize int    // The number of keys of a batch, defaults to DefaultBackfillBatchSize
+	// Processes a batch of keys in the transaction of the batch, e.g: "UPDATE books SET ... WHERE id = ANY($1)"
+	Process func(ctx context.Context, tx DBTX, keys []K) error
+}
+
+// RunBackfill runs the backfill, committing every batch in its own transaction together with a checkpoint
+// of its last key and the number of processed rows, which are logged as progress.
+// An interrupted backfill resumes after the last committed batch, and a completed backfill is not run again.
+// Concurrent runs of a backfill process each batch once, as the checkpoint is locked by the transaction of a batch.
+//
+// The connection must be able to begin transactions, such as a pool or the DBTX of a Migration without transaction.
+//
+// Example usage:
+//
+//	err := database.RunBackfill(ctx, conn, database.Backfill[int]{
+//	    Name:  "books_normalize_titles",
+//	    Query: "SELECT id FROM books WHERE title <> initcap(title)",
+//	    Process: func(ctx context.Context, tx database.DBTX, ids []int) error {
+//	        return database.ExecQuery(ctx, tx, "UPDATE books SET title = initcap(title) WHERE id = ANY($1)", ids)
+//	    },
+//	})
+func RunBackfill[K any](ctx context.Context, conn DBTX, backfill Backfill[K]) error {
+	beginner, ok := conn.(interface {
+		Begin(ctx context.Context) (pgx.Tx, error)
+	})
+	if !ok {
+		return ErrNoTransactions
+	}
+
+	batchSize := backfill.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBackfillBatchSize
+	}
+
+	err := ExecQuery(ctx, conn, `CREATE TABLE IF NOT EXISTS `+BackfillTable+` (
+	name TEXT PRIMARY KEY,
+	last_key TEXT,
+	processed BIGINT NOT NULL DEFAULT 0,
+	completed_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return fmt.Errorf("failed to create backfill table: %w", err)
+	}
+
+	err = ExecQuery(ctx, conn, "INSERT INTO "+BackfillTable+" (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", backfill.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create backfill checkpoint: %w", err)
+	}
+
+	for {
+		done := false
+
+		err := pgx.BeginFunc(ctx, beginner, func(tx pgx.Tx) error {
+			var err error
+
+			done, err = runBackfillBatch(ctx, tx, backfill, batchSize)
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to run batch of backfill %s: %w", backfill.Name, err)
+		}
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// runBackfillBatch processes the batch after the checkpoint and advances the checkpoint,
+// returning whether the backfill is completed.
+func runBackfillBatch[K any](ctx context.Context, tx DBTX, backfill Backfill[K], batchSize int) (bool, error) {
+	var (
+		lastKey   *string
+		processed int64
+		completed bool
+	)
+
+	err := tx.QueryRow(ctx,
+		"SELECT last_key, processed, completed_at IS NOT NULL FROM "+BackfillTable+" WHERE name = $1 FOR UPDATE",
+		backfill.Name,
+	).Scan(&lastKey, &processed, &completed)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock backfill checkpoint: %w", err)
+	}
+
+	if completed {
+		return true, nil
+	}
+
+	query, args := backfillBatchSQL(backfill.Query, backfill.Args, lastKey, batchSize)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to select batch: %w", err)
+	}
+
+	keys := []K{}
+
+	var batchLastKey string
+
+	for rows.Next() {
+		var key K
+
+		err = rows.Scan(&key, &batchLastKey)
+		if err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan key: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil {
+		return false, fmt.Errorf("failed to select batch: %w", rows.Err())
+	}
+
+	if len(keys) == 0 {
+		err = ExecQuery(ctx, tx, "UPDATE "+BackfillTable+" SET completed_at = now(), updated_at = now() WHERE name = $1", backfill.Name)
+		if err != nil {
+			return false, fmt.Errorf("failed to complete backfill checkpoint: %w", err)
+		}
+
+		slog.Info("Backfill completed", "backfill", backfill.Name, "processed", processed)
+
+		return true, nil
+	}
+
+	err = backfill.Process(ctx, tx, keys)
+	if err != nil {
+		return false, fmt.Errorf("failed to process batch: %w", err)
+	}
+
+	processed += int64(len(keys))
+
+	err = ExecQuery(ctx, tx,
+		"UPDATE "+BackfillTable+" SET last_key = $2, processed = $3, updated_at = now() WHERE name = $1",
+		backfill.Name, batchLastKey, processed,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update backfill checkpoint: %w", err)
+	}
+
+	slog.Info("Backfill progress", "backfill", backfill.Name, "processed", processed)
+
+	return false, nil
+}
+
+// backfillBatchSQL builds the query of the batch after the last key, numbering the placeholders after the arguments.
+// The key is selected twice, the second time as text for the checkpoint.
+func backfillBatchSQL(query string, args []any, lastKey *string, batchSize int) (string, []any) {
+	batchQuery := "SELECT backfill_key, backfill_key::text FROM (" + query + ") AS backfill_query(backfill_key)"
+	batchArgs := append([]any{}, args...)
+
+	if lastKey != nil {
+		batchArgs = append(batchArgs, *lastKey)
+		batchQuery += fmt.Sprintf(" WHERE backfill_key > $%d", len(batchArgs))
+	}
+
+	batchArgs = append(batchArgs, batchSize)
+	batchQuery += fmt.Sprintf(" ORDER BY backfill_key LIMIT $%d", len(batchArgs))
+
+	return batchQuery, batchArgs
+}
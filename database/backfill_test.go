@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillBatchSQL(t *testing.T) {
+	query, args := backfillBatchSQL("SELECT id FROM books WHERE title = $1", []any{"Dune"}, nil, 10)
+	assert.Equal(t,
+		"SELECT backfill_key, backfill_key::text FROM (SELECT id FROM books WHERE title = $1) AS backfill_query(backfill_key)"+
+			" ORDER BY backfill_key LIMIT $2",
+		query,
+	)
+	assert.Equal(t, []any{"Dune", 10}, args)
+
+	lastKey := "42"
+	query, args = backfillBatchSQL("SELECT id FROM books", nil, &lastKey, 10)
+	assert.Equal(t,
+		"SELECT backfill_key, backfill_key::text FROM (SELECT id FROM books) AS backfill_query(backfill_key)"+
+			" WHERE backfill_key > $1 ORDER BY backfill_key LIMIT $2",
+		query,
+	)
+	assert.Equal(t, []any{"42", 10}, args)
+}
+
+func TestRunBackfillWithoutTransactions(t *testing.T) {
+	err := RunBackfill(context.Background(), noConn{}, Backfill[int]{Name: "books"})
+	assert.ErrorIs(t, err, ErrNoTransactions)
+}
+
+func TestRunBackfill(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+	description := uuid.NewString()
+	fnErr := errors.New("failed")
+
+	for range 5 {
+		err := ExecQuery(ctx, db.Conn(ctx), "INSERT INTO books (title, description) VALUES ('backfill', $1)", description)
+		assert.NoError(t, err)
+	}
+
+	batches := [][]int{}
+	backfill := Backfill[int]{
+		Name:      "books_" + description,
+		Query:     "SELECT id FROM books WHERE description = $1",
+		Args:      []any{description},
+		BatchSize: 2,
+		Process: func(ctx context.Context, tx DBTX, ids []int) error {
+			batches = append(batches, ids)
+			if len(batches) == 2 {
+				return fnErr
+			}
+
+			return ExecQuery(ctx, tx, "UPDATE books SET title = 'backfilled' WHERE id = ANY($1)", ids)
+		},
+	}
+
+	// the second batch fails, the first batch stays committed
+	err := RunBackfill(ctx, db.Conn(ctx), backfill)
+	assert.ErrorIs(t, err, fnErr)
+
+	// the backfill resumes with the second batch
+	err = RunBackfill(ctx, db.Conn(ctx), backfill)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 5)
+	assert.Equal(t, batches[1], batches[2])
+
+	var processed int64
+
+	err = db.Conn(ctx).QueryRow(ctx, "SELECT processed FROM "+BackfillTable+" WHERE name = $1", backfill.Name).Scan(&processed)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), processed)
+
+	books, err := SelectRows[Book](ctx, db.Conn(ctx), "SELECT * FROM books WHERE description = $1 AND title = 'backfilled'", description)
+	assert.NoError(t, err)
+	assert.Len(t, books, 5)
+
+	// a completed backfill is not run again
+	err = RunBackfill(ctx, db.Conn(ctx), backfill)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 5)
+}
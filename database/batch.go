@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrBatchNotSent is returned by the result of a queued statement before its batch is sent.
+var ErrBatchNotSent = errors.New("batch is not sent")
+
+// CopyFrom inserts the rows into the table with the COPY protocol, which is much faster than INSERT statements
+// for thousands of rows, and returns the number of inserted rows.
+// The columns are the `db` tags of T, so every column is copied, e.g: use a type without the id column
+// to insert rows with the default id of the table.
+// Constraint violations are returned as a ConstraintError.
+//
+// Example usage:
+//
+//	count, err := database.CopyFrom(ctx, tx, "books", books)
+func CopyFrom[T any](ctx context.Context, dbtx DBTX, table string, rows []T) (int64, error) {
+	entity := entityOf[T]()
+
+	columns := make([]string, 0, len(entity.fields))
+	for _, field := range entity.fields {
+		columns = append(columns, field.column)
+	}
+
+	count, err := dbtx.CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns,
+		pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+			value := reflect.ValueOf(rows[i])
+
+			values := make([]any, 0, len(entity.fields))
+			for _, field := range entity.fields {
+				values = append(values, value.FieldByIndex(field.index).Interface())
+			}
+
+			return values, nil
+		}),
+	)
+	if err != nil {
+		return count, fmt.Errorf("failed to copy rows into %s: %w", table, ClassifyError(err))
+	}
+
+	return count, nil
+}
+
+// Batch queues statements which are sent to the database in one round trip, and collects their typed results.
+// Outside a transaction, the statements of a batch run in an implicit transaction,
+// so that an error of one statement rolls back every statement.
+//
+// Example usage:
+//
+//	var batch database.Batch
+//
+//	book := database.QueueRow[Book](&batch, "SELECT * FROM books WHERE id = $1", id)
+//	count := database.QueueRow[int64](&batch, "SELECT COUNT(*) FROM books")
+//	deleted := batch.Exec("DELETE FROM books WHERE title = $1", "")
+//
+//	err := batch.Send(ctx, tx)
+//	if err != nil {
+//	    return err
+//	}
+//
+//	b, err := book.Get()
+type Batch struct {
+	batch   pgx.Batch
+	pending []func(err error) // fail the results of the queued statements which did not receive a response
+}
+
+// BatchResult is the result of a statement queued in a Batch, which is available once the batch is sent.
+type BatchResult[T any] struct {
+	value T
+	err   error
+}
+
+// Get returns the result of the statement, or its error.
+func (r *BatchResult[T]) Get() (T, error) {
+	return r.value, r.err
+}
+
+// QueueRow queues a query returning a single row, which is collected into a struct of type T with `db` tags
+// like SelectRow, or scanned into T otherwise, e.g: a count.
+func QueueRow[T any](b *Batch, query string, args ...any) *BatchResult[T] {
+	return queue(b, query, args, func(rows pgx.Rows) (T, error) {
+		return pgx.CollectOneRow(rows, rowTo[T]())
+	})
+}
+
+// QueueRows queues a query returning multiple rows, which are collected into a slice of structs of type T
+// with `db` tags like SelectRows, or scanned into a slice of T otherwise.
+func QueueRows[T any](b *Batch, query string, args ...any) *BatchResult[[]T] {
+	return queue(b, query, args, func(rows pgx.Rows) ([]T, error) {
+		return pgx.CollectRows(rows, rowTo[T]())
+	})
+}
+
+// Exec queues a statement which does not return rows, and whose result is the number of affected rows.
+func (b *Batch) Exec(query string, args ...any) *BatchResult[int64] {
+	result := &BatchResult[int64]{err: ErrBatchNotSent}
+
+	b.batch.Queue(query, args...).Exec(func(tag pgconn.CommandTag) error {
+		result.value, result.err = tag.RowsAffected(), nil
+		return nil
+	})
+
+	return track(b, result)
+}
+
+// Len returns the number of queued statements.
+func (b *Batch) Len() int {
+	return b.batch.Len()
+}
+
+// Send sends the queued statements in one round trip and collects their results.
+// It returns the first error of the statements, which is also the error of the results of every statement
+// which did not receive a response.
+func (b *Batch) Send(ctx context.Context, dbtx DBTX) error {
+	err := dbtx.SendBatch(ctx, &b.batch).Close()
+	if err != nil {
+		err = fmt.Errorf("failed to send batch: %w", ClassifyError(err))
+	}
+
+	for _, fail := range b.pending {
+		fail(err)
+	}
+
+	return err
+}
+
+// queue queues a query whose rows are collected into the result.
+func queue[T any](b *Batch, query string, args []any, collect func(rows pgx.Rows) (T, error)) *BatchResult[T] {
+	result := &BatchResult[T]{err: ErrBatchNotSent}
+
+	b.batch.Queue(query, args...).Query(func(rows pgx.Rows) error {
+		value, err := collect(rows)
+		if err != nil {
+			result.err = fmt.Errorf("failed to collect rows: %w", ClassifyError(err))
+			return result.err
+		}
+
+		result.value, result.err = value, nil
+
+		return nil
+	})
+
+	return track(b, result)
+}
+
+// track fails the result with the error of the batch if its statement does not receive a response.
+func track[T any](b *Batch, result *BatchResult[T]) *BatchResult[T] {
+	b.pending = append(b.pending, func(err error) {
+		if errors.Is(result.err, ErrBatchNotSent) {
+			result.err = err
+		}
+	})
+
+	return result
+}
+
+// rowTo returns the function collecting a row into T, by name for structs with `db` tags and by position otherwise,
+// e.g: for a count or a time.Time.
+func rowTo[T any]() pgx.RowToFunc[T] {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() == reflect.Struct && len(entityFor(typ).fields) > 0 {
+		return pgx.RowToStructByName[T]
+	}
+
+	return pgx.RowTo[T]
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchWithoutConnection(t *testing.T) {
+	var batch Batch
+
+	row := QueueRow[Book](&batch, "SELECT * FROM books WHERE id = $1", 1)
+	rows := QueueRows[Book](&batch, "SELECT * FROM books")
+	deleted := batch.Exec("DELETE FROM books")
+
+	assert.Equal(t, 3, batch.Len())
+
+	_, err := row.Get()
+	assert.ErrorIs(t, err, ErrBatchNotSent)
+
+	err = batch.Send(context.Background(), noConn{})
+	require.ErrorIs(t, err, errNoConnection)
+
+	_, err = row.Get()
+	assert.ErrorIs(t, err, errNoConnection)
+
+	_, err = rows.Get()
+	assert.ErrorIs(t, err, errNoConnection)
+
+	_, err = deleted.Get()
+	assert.ErrorIs(t, err, errNoConnection)
+
+	_, err = CopyFrom(context.Background(), noConn{}, "books", []Book{{Title: "Dune"}})
+	assert.ErrorIs(t, err, errNoConnection)
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	type NewBook struct {
+		Title       string `db:"title"`
+		Description string `db:"description"`
+	}
+
+	description := uuid.NewString()
+
+	err := db.WithTX(ctx, func(tx DBTX) error {
+		count, err := CopyFrom(ctx, tx, "books", []NewBook{
+			{Title: "a", Description: description},
+			{Title: "b", Description: description},
+			{Title: "c", Description: description},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+
+		var batch Batch
+
+		first := QueueRow[Book](&batch, "SELECT * FROM books WHERE description = $1 ORDER BY title LIMIT 1", description)
+		all := QueueRows[Book](&batch, "SELECT * FROM books WHERE description = $1 ORDER BY title", description)
+		titles := QueueRows[string](&batch, "SELECT title FROM books WHERE description = $1 ORDER BY title", description)
+		now := QueueRow[time.Time](&batch, "SELECT now()")
+		deleted := batch.Exec("DELETE FROM books WHERE description = $1 AND title = $2", description, "c")
+
+		require.NoError(t, batch.Send(ctx, tx))
+
+		book, err := first.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "a", book.Title)
+
+		books, err := all.Get()
+		require.NoError(t, err)
+		assert.Len(t, books, 3)
+
+		names, err := titles.Get()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, names)
+
+		_, err = now.Get()
+		require.NoError(t, err)
+
+		affected, err := deleted.Get()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), affected)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	t.Run("error fails the remaining statements", func(t *testing.T) {
+		var batch Batch
+
+		ok := QueueRow[int](&batch, "SELECT 1")
+		failed := QueueRow[int](&batch, "SELECT 1 / 0")
+		skipped := batch.Exec("DELETE FROM books WHERE description = $1", description)
+
+		err := batch.Send(ctx, db.Conn(ctx))
+		require.Error(t, err)
+
+		_, err = ok.Get()
+		require.NoError(t, err)
+
+		_, err = failed.Get()
+		require.Error(t, err)
+
+		_, err = skipped.Get()
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrBatchNotSent)
+	})
+}
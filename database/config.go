@@ -0,0 +1,156 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// connectionString returns the DSN of the configuration, or builds a URL of the connection and SSL fields,
+// escaping the user, password and database name.
+func connectionString(cfg config.DatabaseConfig) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	query := url.Values{}
+	query.Set("sslmode", sslMode)
+
+	if cfg.SSLRootCert != "" {
+		query.Set("sslrootcert", cfg.SSLRootCert)
+	}
+
+	if cfg.SSLCert != "" {
+		query.Set("sslcert", cfg.SSLCert)
+	}
+
+	if cfg.SSLKey != "" {
+		query.Set("sslkey", cfg.SSLKey)
+	}
+
+	connectionUrl := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     "/" + cfg.Name,
+		RawQuery: query.Encode(),
+	}
+
+	return connectionUrl.String()
+}
+
+// PoolConfig parses the connection string of the configuration, and applies its run-time parameters
+// and pool settings.
+func PoolConfig(cfg config.DatabaseConfig) (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(connectionString(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	runtimeParams := poolCfg.ConnConfig.RuntimeParams
+
+	if cfg.SearchPath != "" {
+		runtimeParams["search_path"] = cfg.SearchPath
+	}
+
+	if cfg.ApplicationName != "" {
+		runtimeParams["application_name"] = cfg.ApplicationName
+	}
+
+	statementTimeout, err := parseOptionalDuration(cfg.StatementTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statement timeout: %w", err)
+	}
+
+	if statementTimeout > 0 {
+		runtimeParams["statement_timeout"] = strconv.FormatInt(statementTimeout.Milliseconds(), 10)
+	}
+
+	if cfg.Pool.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.Pool.MaxConns
+	}
+
+	if cfg.Pool.MinConns > 0 {
+		poolCfg.MinConns = cfg.Pool.MinConns
+	}
+
+	if poolCfg.MinConns > poolCfg.MaxConns {
+		return nil, fmt.Errorf("min conns %d cannot be greater than max conns %d", poolCfg.MinConns, poolCfg.MaxConns)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"max conn lifetime", cfg.Pool.MaxConnLifetime, &poolCfg.MaxConnLifetime},
+		{"max conn idle time", cfg.Pool.MaxConnIdleTime, &poolCfg.MaxConnIdleTime},
+		{"health check period", cfg.Pool.HealthCheckPeriod, &poolCfg.HealthCheckPeriod},
+	}
+
+	for _, duration := range durations {
+		d, err := parseOptionalDuration(duration.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", duration.name, err)
+		}
+
+		if d > 0 {
+			*duration.dest = d
+		}
+	}
+
+	return poolCfg, nil
+}
+
+// replicaPoolConfigs returns the pool configurations of the replicas,
+// which share every setting of the primary except for the host, port and DSN.
+func replicaPoolConfigs(cfg config.DatabaseConfig) ([]*pgxpool.Config, error) {
+	poolConfigs := []*pgxpool.Config{}
+
+	for i, replica := range cfg.Replicas {
+		if cfg.DSN != "" && replica.DSN == "" {
+			return nil, fmt.Errorf("replica %d needs a DSN, as the primary is configured with a DSN", i)
+		}
+
+		replicaCfg := cfg
+		replicaCfg.Host = replica.Host
+		replicaCfg.DSN = replica.DSN
+
+		if replica.Port != 0 {
+			replicaCfg.Port = replica.Port
+		}
+
+		poolCfg, err := PoolConfig(replicaCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replica %d: %w", i, err)
+		}
+
+		poolConfigs = append(poolConfigs, poolCfg)
+	}
+
+	return poolConfigs, nil
+}
+
+// parseOptionalDuration parses a duration of the configuration, an empty value is 0.
+func parseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration %q: %w", value, err)
+	}
+
+	return d, nil
+}
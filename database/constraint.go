@@ -0,0 +1,163 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrConstraintViolation is matched by every ConstraintError.
+var ErrConstraintViolation = errors.New("constraint violation")
+
+// ConstraintViolation is the kind of an integrity constraint violated by a statement.
+type ConstraintViolation string
+
+const (
+	UniqueViolation     ConstraintViolation = "unique violation"      // SQLSTATE 23505, e.g: a duplicate primary key
+	ForeignKeyViolation ConstraintViolation = "foreign key violation" // SQLSTATE 23503, e.g: a reference to a missing row
+	NotNullViolation    ConstraintViolation = "not null violation"    // SQLSTATE 23502
+	CheckViolation      ConstraintViolation = "check violation"       // SQLSTATE 23514
+)
+
+// constraintViolations maps the Postgres error codes to the kinds of constraint violations.
+var constraintViolations = map[string]ConstraintViolation{
+	"23505": UniqueViolation,
+	"23503": ForeignKeyViolation,
+	"23502": NotNullViolation,
+	"23514": CheckViolation,
+}
+
+// ConstraintError describes a violated integrity constraint.
+// It matches ErrConstraintViolation, and is returned to clients with HTTP status 409 for unique violations
+// and 422 for every other violation.
+type ConstraintError struct {
+	Violation  ConstraintViolation // The kind of the violated constraint
+	Constraint string              // The name of the constraint, empty for not null violations
+	Table      string              // The table of the constraint
+	Column     string              // The column of the constraint, comma separated if it has multiple columns, or empty if unknown
+	Err        error               // The error of the violation, wrapping the *pgconn.PgError
+}
+
+func (e *ConstraintError) Error() string {
+	switch {
+	case e.Column != "" && e.Constraint != "":
+		return fmt.Sprintf("%s of constraint %q on column %q", e.Violation, e.Constraint, e.Column)
+	case e.Column != "":
+		return fmt.Sprintf("%s on column %q", e.Violation, e.Column)
+	default:
+		return fmt.Sprintf("%s of constraint %q", e.Violation, e.Constraint)
+	}
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+// HTTPStatus returns the HTTP status code the error should be returned to clients with.
+func (e *ConstraintError) HTTPStatus() int {
+	if e.Violation == UniqueViolation {
+		return http.StatusConflict
+	}
+
+	return http.StatusUnprocessableEntity
+}
+
+// keyDetailPattern matches the columns of the detail of unique and foreign key violations,
+// e.g: `Key (title)=(Dune) already exists.`
+var keyDetailPattern = regexp.MustCompile(`^Key \((.+?)\)=`)
+
+// constraintError returns the constraint error of err, or nil if err is not caused by a constraint violation.
+func constraintError(err error) *ConstraintError {
+	var constraintErr *ConstraintError
+	if errors.As(err, &constraintErr) {
+		return constraintErr
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	violation, ok := constraintViolations[pgErr.Code]
+	if !ok {
+		return nil
+	}
+
+	column := pgErr.ColumnName
+	if match := keyDetailPattern.FindStringSubmatch(pgErr.Detail); column == "" && match != nil {
+		column = match[1]
+	}
+
+	return &ConstraintError{
+		Violation:  violation,
+		Constraint: pgErr.ConstraintName,
+		Table:      pgErr.TableName,
+		Column:     column,
+		Err:        err,
+	}
+}
+
+// violation returns the constraint error of err if it is caused by a violation of the given kind.
+func violation(err error, kind ConstraintViolation) (*ConstraintError, bool) {
+	constraintErr := constraintError(err)
+	if constraintErr == nil || constraintErr.Violation != kind {
+		return nil, false
+	}
+
+	return constraintErr, true
+}
+
+// IsUniqueViolation returns the violated constraint if the error is caused by a unique violation.
+//
+// Example usage:
+//
+//	if violation, ok := database.IsUniqueViolation(err); ok && violation.Column == "title" {
+//	    return ErrTitleTaken
+//	}
+func IsUniqueViolation(err error) (*ConstraintError, bool) {
+	return violation(err, UniqueViolation)
+}
+
+// IsForeignKeyViolation returns the violated constraint if the error is caused by a foreign key violation.
+func IsForeignKeyViolation(err error) (*ConstraintError, bool) {
+	return violation(err, ForeignKeyViolation)
+}
+
+// IsNotNullViolation returns the violated column if the error is caused by a not null violation.
+func IsNotNullViolation(err error) (*ConstraintError, bool) {
+	return violation(err, NotNullViolation)
+}
+
+// IsCheckViolation returns the violated constraint if the error is caused by a check violation.
+func IsCheckViolation(err error) (*ConstraintError, bool) {
+	return violation(err, CheckViolation)
+}
+
+// ClassifyError returns the error as a *ConstraintError if it is caused by a constraint violation,
+// so that server.WriteErrorFrom returns it to clients with status 409 or 422. Other errors are returned unchanged.
+//
+// Example usage:
+//
+//	book, err := database.SelectRow[Book](ctx, tx, "INSERT INTO books (title) VALUES ($1) RETURNING *", title)
+//	if err != nil {
+//	    return Book{}, fmt.Errorf("failed to insert book: %w", database.ClassifyError(err))
+//	}
+func ClassifyError(err error) error {
+	var constraintErr *ConstraintError
+	if errors.As(err, &constraintErr) {
+		return err
+	}
+
+	if constraintErr := constraintError(err); constraintErr != nil {
+		return constraintErr
+	}
+
+	return err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstraintViolations(t *testing.T) {
+	uniqueErr := fmt.Errorf("failed to execute query: %w", &pgconn.PgError{
+		Code:           "23505",
+		Message:        `duplicate key value violates unique constraint "books_title_key"`,
+		Detail:         "Key (title)=(Dune) already exists.",
+		TableName:      "books",
+		ConstraintName: "books_title_key",
+	})
+
+	t.Run("unique violation", func(t *testing.T) {
+		violation, ok := IsUniqueViolation(uniqueErr)
+		assert.True(t, ok)
+		assert.Equal(t, UniqueViolation, violation.Violation)
+		assert.Equal(t, "books_title_key", violation.Constraint)
+		assert.Equal(t, "books", violation.Table)
+		assert.Equal(t, "title", violation.Column)
+
+		_, ok = IsForeignKeyViolation(uniqueErr)
+		assert.False(t, ok)
+	})
+
+	t.Run("foreign key violation with multiple columns", func(t *testing.T) {
+		violation, ok := IsForeignKeyViolation(&pgconn.PgError{
+			Code:           "23503",
+			Detail:         `Key (author_id, edition)=(1, 2) is not present in table "authors".`,
+			ConstraintName: "books_author_fkey",
+		})
+		assert.True(t, ok)
+		assert.Equal(t, "author_id, edition", violation.Column)
+	})
+
+	t.Run("not null violation", func(t *testing.T) {
+		violation, ok := IsNotNullViolation(&pgconn.PgError{Code: "23502", TableName: "books", ColumnName: "title"})
+		assert.True(t, ok)
+		assert.Equal(t, "title", violation.Column)
+		assert.Equal(t, `not null violation on column "title"`, violation.Error())
+	})
+
+	t.Run("check violation", func(t *testing.T) {
+		violation, ok := IsCheckViolation(&pgconn.PgError{Code: "23514", ConstraintName: "books_title_check"})
+		assert.True(t, ok)
+		assert.Equal(t, `check violation of constraint "books_title_check"`, violation.Error())
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		_, ok := IsUniqueViolation(&pgconn.PgError{Code: "40001"})
+		assert.False(t, ok)
+
+		_, ok = IsUniqueViolation(errors.New("failed"))
+		assert.False(t, ok)
+	})
+}
+
+func TestClassifyError(t *testing.T) {
+	pgErr := &pgconn.PgError{Code: "23505", Detail: "Key (id)=(1) already exists.", ConstraintName: "books_pkey"}
+
+	err := fmt.Errorf("failed to save book: %w", ClassifyError(fmt.Errorf("failed to execute query: %w", pgErr)))
+	assert.ErrorIs(t, err, ErrConstraintViolation)
+	assert.ErrorIs(t, err, pgErr)
+	assert.Equal(t, `failed to save book: unique violation of constraint "books_pkey" on column "id"`, err.Error())
+
+	var statusErr interface{ HTTPStatus() int }
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusConflict, statusErr.HTTPStatus())
+
+	// classifying twice keeps the error
+	assert.Equal(t, err, ClassifyError(err))
+
+	notNullErr := ClassifyError(&pgconn.PgError{Code: "23502", ColumnName: "title"})
+	assert.ErrorAs(t, notNullErr, &statusErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusErr.HTTPStatus())
+
+	fnErr := errors.New("failed")
+	assert.Equal(t, fnErr, ClassifyError(fnErr))
+}
+
+func TestConstraintViolationsOfDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	book, err := SelectRow[Book](ctx, db.Conn(ctx),
+		"INSERT INTO books (title, description) VALUES ($1, 'constraint') RETURNING *", uuid.NewString())
+	assert.NoError(t, err)
+
+	err = ExecQuery(ctx, db.Conn(ctx), "INSERT INTO books (id, title, description) VALUES ($1, 'duplicate', 'constraint')", book.ID)
+	violation, ok := IsUniqueViolation(err)
+	assert.True(t, ok)
+	assert.Equal(t, "books_pkey", violation.Constraint)
+	assert.Equal(t, "id", violation.Column)
+
+	err = ExecQuery(ctx, db.Conn(ctx), "INSERT INTO books (title, description) VALUES (NULL, 'constraint')")
+	violation, ok = IsNotNullViolation(err)
+	assert.True(t, ok)
+	assert.Equal(t, "books", violation.Table)
+	assert.Equal(t, "title", violation.Column)
+}
@@ -0,0 +1,390 @@
+package database
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTiebreaker is the sort field which cursor pagination uses to order rows with equal sort keys.
+const DefaultTiebreaker = "id"
+
+// ErrInvalidCursor is matched by every error caused by a cursor which is malformed, tampered with,
+// or created for a different sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorError describes why a cursor was rejected.
+// It matches ErrInvalidCursor and is returned to clients with HTTP status 400.
+type CursorError struct {
+	Reason string // Why the cursor was rejected
+}
+
+func (e *CursorError) Error() string {
+	return "invalid cursor: " + e.Reason
+}
+
+func (e *CursorError) Is(target error) bool {
+	return target == ErrInvalidCursor
+}
+
+// HTTPStatus returns the HTTP status code the error should be returned to clients with.
+func (e *CursorError) HTTPStatus() int {
+	return http.StatusBadRequest
+}
+
+type CursorRequest struct {
+	Cursor string   `query:"cursor" json:"cursor" validate:"omitempty"` // The cursor of the requested page, empty for the first page
+	Size   int      `query:"size" json:"size"`                          // The number of items per page
+	Sort   []string `query:"sort" json:"sort"`                          // A slice of sort commands, e.g., "name,desc"
+}
+
+type CursorPage[T any] struct {
+	Content          []T           `json:"content"`
+	Pageable         CursorRequest `json:"pageable"`
+	Size             int           `json:"size"`
+	NumberOfElements int           `json:"numberOfElements"`
+	NextCursor       string        `json:"nextCursor"` // The cursor of the next page, empty if there is none
+	PrevCursor       string        `json:"prevCursor"` // The cursor of the previous page, empty if there is none
+	HasNext          bool          `json:"hasNext"`
+	HasPrevious      bool          `json:"hasPrevious"`
+	IsEmpty          bool          `json:"empty"`
+}
+
+func MapCursorContent[T any, R any](page CursorPage[T], newContent []R) CursorPage[R] {
+	return CursorPage[R]{
+		Content:          newContent,
+		Pageable:         page.Pageable,
+		Size:             page.Size,
+		NumberOfElements: page.NumberOfElements,
+		NextCursor:       page.NextCursor,
+		PrevCursor:       page.PrevCursor,
+		HasNext:          page.HasNext,
+		HasPrevious:      page.HasPrevious,
+		IsEmpty:          page.IsEmpty,
+	}
+}
+
+// CursorQuery describes a cursor paginated query and how clients may sort it.
+type CursorQuery struct {
+	Request    CursorRequest // The page requested by the client
+	Query      string        // The query without ORDER BY and LIMIT
+	Args       []any         // The arguments of the query
+	Sortable   Sortable      // The allowed sort fields, defaults to the db columns of the result type
+	Tiebreaker string        // The sort field which is unique for every row, defaults to DefaultTiebreaker
+	MaxSize    int           // The maximum page size, defaults to MaxPageSize
+	Filter     Filter        // The filter requested by the client, its conditions are validated against Filterable
+	Filterable Filterable    // The allowed filter fields, no field can be filtered on if nil
+	// The key cursors are signed with, required. Every instance serving the same cursors must use the same key,
+	// so take it from the configuration, and keep it secret.
+	Key []byte
+}
+
+// SelectRowsCursor executes a query and returns a page of its results after the cursor of the request,
+// which is a keyset paginated alternative to SelectPage that is stable under concurrent inserts
+// and does not slow down on later pages.
+//
+// The rows are sorted by the sort commands of the request followed by the tiebreaker,
+// and the cursors of the returned page encode the sort keys of its first and last rows.
+// Errors matching ErrInvalidSort, ErrInvalidFilter or ErrInvalidCursor are returned for sort commands and filter conditions
+// which are not allowed, and for cursors which are invalid. Null handling is not supported in the sort commands, and the sort keys must not be null.
+// The query is wrapped in a subquery, so sort expressions can only reference its result columns.
+//
+// Example usage:
+//
+//	page, err := database.SelectRowsCursor[Book](ctx, tx, database.CursorQuery{
+//	    Request:  cursorRequest,
+//	    Query:    "SELECT * FROM books WHERE author_id = $1",
+//	    Args:     []any{authorID},
+//	    Sortable: database.Sortable{"id": "id", "title": "title"},
+//	    Key:      []byte(cfg.CursorKey),
+//	})
+func SelectRowsCursor[T any](ctx context.Context, dbtx DBTX, cursorQuery CursorQuery) (CursorPage[T], error) {
+	var page CursorPage[T]
+
+	if len(cursorQuery.Key) == 0 {
+		return page, errors.New("cursor key cannot be empty")
+	}
+
+	request := cursorQuery.Request
+	request.Size = pageSize(request.Size, cursorQuery.MaxSize)
+	page.Pageable = request
+	page.Size = request.Size
+
+	terms, err := cursorSortTerms[T](cursorQuery, request.Sort)
+	if err != nil {
+		return page, err
+	}
+
+	filteredQuery, filteredArgs, err := filterQuery(cursorQuery.Query, cursorQuery.Args, cursorQuery.Filter, cursorQuery.Filterable)
+	if err != nil {
+		return page, err
+	}
+
+	key := cursorQuery.Key
+
+	signature := sortSignature(terms)
+
+	var after *cursor
+
+	if request.Cursor != "" {
+		decoded, err := decodeCursor(request.Cursor, key)
+		if err != nil {
+			return page, err
+		}
+
+		if decoded.Sort != signature || len(decoded.Values) != len(terms) {
+			return page, &CursorError{Reason: "cursor does not match the sort"}
+		}
+
+		after = &decoded
+	}
+
+	query, args := cursorSQL(filteredQuery, filteredArgs, terms, after, request.Size+1)
+
+	slog.Info("Executing cursor paginated query",
+		"query", query,
+		"args", args,
+	)
+
+	rows, err := dbtx.Query(ctx, query, args...)
+	if err != nil {
+		return page, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Collect results with the sort keys of every row
+	keys := []cursor{}
+
+	results, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (T, error) {
+		keyColumns := make([]any, len(terms))
+		for i := range keyColumns {
+			keyColumns[i] = new(*string)
+		}
+
+		result, err := pgx.RowToStructByName[T](extraColumnsRow{CollectableRow: row, dest: keyColumns})
+		if err != nil {
+			return result, err
+		}
+
+		rowKeys, err := cursorFromColumns(signature, keyColumns)
+		keys = append(keys, rowKeys)
+
+		return result, err
+	})
+	if err != nil {
+		return page, fmt.Errorf("failed to collect rows: %w", err)
+	}
+
+	hasMore := len(results) > request.Size
+	if hasMore {
+		results = results[:request.Size]
+		keys = keys[:request.Size]
+	}
+
+	backward := after != nil && after.Backward
+	if backward {
+		slices.Reverse(results)
+		slices.Reverse(keys)
+	}
+
+	page.Content = results
+	page.NumberOfElements = len(results)
+	page.IsEmpty = len(results) == 0
+	page.HasNext = hasMore || backward
+	page.HasPrevious = (backward && hasMore) || (!backward && after != nil)
+
+	if page.IsEmpty {
+		return page, nil
+	}
+
+	if page.HasNext {
+		page.NextCursor = encodeCursor(keys[len(keys)-1], key)
+	}
+
+	if page.HasPrevious {
+		prev := keys[0]
+		prev.Backward = true
+		page.PrevCursor = encodeCursor(prev, key)
+	}
+
+	return page, nil
+}
+
+// cursorSortTerms resolves the sort commands of a cursor query, appending the tiebreaker if it is missing.
+func cursorSortTerms[T any](cursorQuery CursorQuery, sorts []string) ([]sortTerm, error) {
+	sortable := cursorQuery.Sortable
+	if sortable == nil {
+		sortable = SortableColumns[T]()
+	}
+
+	tiebreaker := cursorQuery.Tiebreaker
+	if tiebreaker == "" {
+		tiebreaker = DefaultTiebreaker
+	}
+
+	terms, err := sortable.resolve(sorts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, term := range terms {
+		if term.Nulls != "" {
+			return nil, &SortError{Sort: term.Field, Reason: "null handling is not supported with cursor pagination"}
+		}
+	}
+
+	if !slices.ContainsFunc(terms, func(term sortTerm) bool { return term.Field == tiebreaker }) {
+		expression, ok := sortable[tiebreaker]
+		if !ok {
+			return nil, fmt.Errorf("tiebreaker %q is not a sort field", tiebreaker)
+		}
+
+		terms = append(terms, sortTerm{Sort: Sort{Field: tiebreaker}, Expression: expression})
+	}
+
+	return terms, nil
+}
+
+// sortSignature identifies the resolved sort of a cursor, e.g: "title,desc;id,asc".
+func sortSignature(terms []sortTerm) string {
+	signatures := make([]string, len(terms))
+
+	for i, term := range terms {
+		direction := "asc"
+		if term.Descending {
+			direction = "desc"
+		}
+
+		signatures[i] = term.Field + "," + direction
+	}
+
+	return strings.Join(signatures, ";")
+}
+
+// cursorSQL builds the query of a cursor page. Every sort key is selected as text,
+// and the rows are filtered to those after the cursor when one is given.
+// The sort keys of the cursor are bound as text to placeholders numbered after the query arguments,
+// and Postgres infers the type of each placeholder from the sort expression it is compared to,
+// so that the cursor cannot choose the types of its values.
+func cursorSQL(query string, args []any, terms []sortTerm, after *cursor, limit int) (string, []any) {
+	args = append([]any{}, args...)
+
+	keyColumns := []string{}
+	for i, term := range terms {
+		keyColumns = append(keyColumns, fmt.Sprintf("(%s)::text AS cursor_value_%d", term.Expression, i))
+	}
+
+	query = "SELECT cursor_query.*, " + strings.Join(keyColumns, ", ") + " FROM (" + query + ") AS cursor_query"
+
+	backward := false
+
+	if after != nil {
+		backward = after.Backward
+
+		// (a > $1) OR (a = $1 AND b > $2) OR ...
+		values := make([]string, len(terms))
+		for i, value := range after.Values {
+			args = append(args, value)
+			values[i] = fmt.Sprintf("$%d", len(args))
+		}
+
+		conditions := make([]string, len(terms))
+
+		for i, term := range terms {
+			operator := ">"
+			if term.Descending != backward {
+				operator = "<"
+			}
+
+			equals := []string{}
+			for j := range i {
+				equals = append(equals, terms[j].Expression+" = "+values[j])
+			}
+
+			conditions[i] = "(" + strings.Join(append(equals, term.Expression+" "+operator+" "+values[i]), " AND ") + ")"
+		}
+
+		query += " WHERE " + strings.Join(conditions, " OR ")
+	}
+
+	args = append(args, limit)
+	query += orderByClause(terms, backward) + fmt.Sprintf(" LIMIT $%d", len(args))
+
+	return query, args
+}
+
+// cursor is the decoded content of a cursor token.
+type cursor struct {
+	Sort     string   `json:"s"`           // The signature of the sort the cursor was created for
+	Backward bool     `json:"b,omitempty"` // Whether the cursor selects the rows before instead of after the keys
+	Values   []string `json:"v"`           // The sort keys of the row as text
+}
+
+// cursorFromColumns creates a cursor from the scanned sort key columns of a row.
+func cursorFromColumns(signature string, columns []any) (cursor, error) {
+	c := cursor{Sort: signature}
+
+	for _, column := range columns {
+		value := *column.(**string) //nolint:forcetypeassert
+		if value == nil {
+			return c, errors.New("sort keys cannot be null with cursor pagination")
+		}
+
+		c.Values = append(c.Values, *value)
+	}
+
+	return c, nil
+}
+
+// encodeCursor encodes the cursor as a base64 payload followed by its HMAC-SHA256 signature.
+func encodeCursor(c cursor, key []byte) string {
+	payload, _ := json.Marshal(c) //nolint:errchkjson
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signCursor(encoded, key))
+}
+
+// decodeCursor verifies the signature of a cursor token and decodes it.
+func decodeCursor(token string, key []byte) (cursor, error) {
+	var c cursor
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, &CursorError{Reason: "malformed cursor"}
+	}
+
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, signCursor(encoded, key)) {
+		return c, &CursorError{Reason: "signature mismatch"}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, &CursorError{Reason: "malformed cursor"}
+	}
+
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return c, &CursorError{Reason: "malformed cursor"}
+	}
+
+	return c, nil
+}
+
+func signCursor(encoded string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+
+	return mac.Sum(nil)
+}
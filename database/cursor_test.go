@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorEncoding(t *testing.T) {
+	key := []byte("secret")
+	c := cursor{Sort: "title,desc;id,asc", Values: []string{"title", "42"}}
+
+	t.Run("round trip", func(t *testing.T) {
+		decoded, err := decodeCursor(encodeCursor(c, key), key)
+		require.NoError(t, err)
+		assert.Equal(t, c, decoded)
+	})
+
+	t.Run("rejected cursors", func(t *testing.T) {
+		token := encodeCursor(c, key)
+		payload, signature, _ := strings.Cut(token, ".")
+
+		tampered := c
+		tampered.Values = []string{"title", "43"}
+		tamperedPayload, _, _ := strings.Cut(encodeCursor(tampered, key), ".")
+
+		for name, token := range map[string]string{
+			"empty":        "",
+			"no signature": payload,
+			"wrong key":    encodeCursor(c, []byte("other")),
+			"tampered":     tamperedPayload + "." + signature,
+			"not base64":   "!!!." + signature,
+			"not json":     base64.RawURLEncoding.EncodeToString([]byte("{")) + "." + base64.RawURLEncoding.EncodeToString(signCursor(base64.RawURLEncoding.EncodeToString([]byte("{")), key)),
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := decodeCursor(token, key)
+				require.ErrorIs(t, err, ErrInvalidCursor)
+
+				var cursorErr *CursorError
+				require.ErrorAs(t, err, &cursorErr)
+				assert.Equal(t, http.StatusBadRequest, cursorErr.HTTPStatus())
+			})
+		}
+	})
+}
+
+func TestSelectRowsCursorRequiresKey(t *testing.T) {
+	// a random key would invalidate the cursors on every restart, and across instances
+	_, err := SelectRowsCursor[Book](context.Background(), nil, CursorQuery{Query: "SELECT * FROM books"})
+	assert.EqualError(t, err, "cursor key cannot be empty")
+}
+
+func TestCursorSortTerms(t *testing.T) {
+	t.Run("appends tiebreaker", func(t *testing.T) {
+		terms, err := cursorSortTerms[Book](CursorQuery{}, []string{"title,desc"})
+		require.NoError(t, err)
+		assert.Equal(t, "title,desc;id,asc", sortSignature(terms))
+	})
+
+	t.Run("keeps requested tiebreaker direction", func(t *testing.T) {
+		terms, err := cursorSortTerms[Book](CursorQuery{}, []string{"id,desc"})
+		require.NoError(t, err)
+		assert.Equal(t, "id,desc", sortSignature(terms))
+	})
+
+	t.Run("custom tiebreaker", func(t *testing.T) {
+		terms, err := cursorSortTerms[Book](CursorQuery{Sortable: Sortable{"title": "title", "code": "code"}, Tiebreaker: "code"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "code,asc", sortSignature(terms))
+	})
+
+	t.Run("tiebreaker must be sortable", func(t *testing.T) {
+		_, err := cursorSortTerms[Book](CursorQuery{Sortable: Sortable{"title": "title"}}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("null handling is rejected", func(t *testing.T) {
+		_, err := cursorSortTerms[Book](CursorQuery{}, []string{"title,asc,nullslast"})
+		assert.ErrorIs(t, err, ErrInvalidSort)
+	})
+}
+
+func TestCursorSQL(t *testing.T) {
+	terms, err := cursorSortTerms[Book](CursorQuery{}, []string{"title,desc"})
+	require.NoError(t, err)
+
+	query, args := cursorSQL("SELECT * FROM books WHERE description = $1", []any{"description"}, terms, nil, 11)
+	assert.Equal(t, `SELECT cursor_query.*, ("title")::text AS cursor_value_0, ("id")::text AS cursor_value_1 `+
+		`FROM (SELECT * FROM books WHERE description = $1) AS cursor_query `+
+		`ORDER BY "title" DESC, "id" ASC LIMIT $2`, query)
+	assert.Equal(t, []any{"description", 11}, args)
+
+	after := &cursor{Values: []string{"title", "42"}}
+	query, args = cursorSQL("SELECT * FROM books", nil, terms, after, 11)
+	assert.Contains(t, query, `WHERE ("title" < $1) OR ("title" = $1 AND "id" > $2) `+
+		`ORDER BY "title" DESC, "id" ASC LIMIT $3`)
+	assert.Equal(t, []any{"title", "42", 11}, args)
+
+	after.Backward = true
+	query, _ = cursorSQL("SELECT * FROM books", nil, terms, after, 11)
+	assert.Contains(t, query, `WHERE ("title" > $1) OR ("title" = $1 AND "id" < $2) `+
+		`ORDER BY "title" ASC, "id" DESC LIMIT $3`)
+}
+
+func TestSelectRowsCursor(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	description := uuid.NewString()
+
+	insert := func(t *testing.T, titles ...string) {
+		t.Helper()
+
+		err := db.WithTX(ctx, func(tx DBTX) error {
+			for _, title := range titles {
+				err := ExecQuery(ctx, tx, "INSERT INTO books (title, description) VALUES ($1, $2)", title, description)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	selectCursor := func(t *testing.T, request CursorRequest) CursorPage[Book] {
+		t.Helper()
+
+		var page CursorPage[Book]
+
+		err := db.WithReadTX(ctx, func(tx DBTX) error {
+			var err error
+
+			page, err = SelectRowsCursor[Book](ctx, tx, CursorQuery{
+				Request: request,
+				Query:   "SELECT * FROM books WHERE description = $1",
+				Args:    []any{description},
+				Key:     []byte("secret"),
+			})
+
+			return err
+		})
+		require.NoError(t, err)
+
+		return page
+	}
+
+	titles := func(page CursorPage[Book]) []string {
+		titles := []string{}
+		for _, book := range page.Content {
+			titles = append(titles, book.Title)
+		}
+
+		return titles
+	}
+
+	// duplicate titles are ordered by the id tiebreaker
+	insert(t, "a", "b", "b", "c", "d")
+
+	first := selectCursor(t, CursorRequest{Size: 2, Sort: []string{"title"}})
+	assert.Equal(t, []string{"a", "b"}, titles(first))
+	assert.True(t, first.HasNext)
+	assert.False(t, first.HasPrevious)
+	assert.Empty(t, first.PrevCursor)
+
+	// rows inserted before the cursor do not shift the next page
+	insert(t, "a")
+
+	second := selectCursor(t, CursorRequest{Size: 2, Sort: []string{"title"}, Cursor: first.NextCursor})
+	assert.Equal(t, []string{"b", "c"}, titles(second))
+	assert.True(t, second.HasNext)
+	assert.True(t, second.HasPrevious)
+
+	last := selectCursor(t, CursorRequest{Size: 2, Sort: []string{"title"}, Cursor: second.NextCursor})
+	assert.Equal(t, []string{"d"}, titles(last))
+	assert.False(t, last.HasNext)
+	assert.Empty(t, last.NextCursor)
+
+	previous := selectCursor(t, CursorRequest{Size: 2, Sort: []string{"title"}, Cursor: last.PrevCursor})
+	assert.Equal(t, []string{"b", "c"}, titles(previous))
+	assert.True(t, previous.HasNext)
+	assert.True(t, previous.HasPrevious)
+
+	previous = selectCursor(t, CursorRequest{Size: 2, Sort: []string{"title"}, Cursor: previous.PrevCursor})
+	assert.Equal(t, []string{"a", "b"}, titles(previous))
+
+	t.Run("cursor of another sort", func(t *testing.T) {
+		err := db.WithReadTX(ctx, func(tx DBTX) error {
+			_, err := SelectRowsCursor[Book](ctx, tx, CursorQuery{
+				Request: CursorRequest{Sort: []string{"title,desc"}, Cursor: first.NextCursor},
+				Query:   "SELECT * FROM books",
+				Key:     []byte("secret"),
+			})
+
+			return err
+		})
+		assert.ErrorIs(t, err, ErrInvalidCursor, fmt.Sprint(err))
+	})
+}
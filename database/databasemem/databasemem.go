@@ -0,0 +1,427 @@
+// Package databasemem provides a fake database.Database for unit tests of services
+// whose data access goes through a mocked repository.
+// Transactions are recorded instead of executed, and the DBTX handed to the
+// transaction functions fails every query, so that unmocked access is noticed.
+//
+// Example usage:
+//
+//	db := databasemem.New()
+//	service := NewService(mq, db, mockRepository)
+//	_, _ = service.CreateBook(ctx, book)
+//	assert.Equal(t, []databasemem.Transaction{{Committed: true}}, db.Transactions())
+package databasemem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/SeaRoll/zumi/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrNotSupported is returned by every query executed on the fake DBTX.
+var ErrNotSupported = errors.New("databasemem: queries are not supported, mock the repository instead")
+
+// Transaction is a recorded transaction.
+type Transaction struct {
+	ReadOnly  bool // Whether the transaction was started by WithReadTX
+	Committed bool // Whether the transaction function succeeded
+	Nested    bool // Whether an existing transaction was joined or reused
+	// The isolation level requested with Transactional, empty for WithTX and WithReadTX
+	Isolation database.IsolationLevel
+}
+
+// Database is a fake database.Database which records transactions.
+type Database struct {
+	mu           sync.Mutex
+	transactions []Transaction
+	listeners    map[string][]chan database.Notification
+	locks        map[string]chan struct{} // holds a token while the advisory lock of the key is held
+}
+
+var _ database.Database = (*Database)(nil)
+
+// New creates a fake database without recorded transactions.
+func New() *Database {
+	return &Database{}
+}
+
+// Disconnect does nothing.
+func (d *Database) Disconnect(_ ...bool) {}
+
+// Health returns a healthy database without connections, as there is nothing to reconnect.
+func (d *Database) Health() database.Health {
+	return database.Health{Healthy: true}
+}
+
+// OnReconnect does nothing, as the in-memory database never reconnects.
+func (d *Database) OnReconnect(_ func(event database.ReconnectEvent)) {}
+
+// Listen calls the handler for each notification sent on the channel with Notify.
+// It blocks until the context is done.
+func (d *Database) Listen(
+	ctx context.Context,
+	channel string,
+	handler func(ctx context.Context, n database.Notification) error,
+) error {
+	if channel == "" {
+		return errors.New("channel cannot be empty")
+	}
+
+	notifications := make(chan database.Notification, 64)
+
+	d.mu.Lock()
+	if d.listeners == nil {
+		d.listeners = map[string][]chan database.Notification{}
+	}
+
+	d.listeners[channel] = append(d.listeners[channel], notifications)
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		d.listeners[channel] = slices.DeleteFunc(d.listeners[channel], func(c chan database.Notification) bool {
+			return c == notifications
+		})
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-notifications:
+			_ = handler(ctx, n)
+		}
+	}
+}
+
+// Notify sends a notification to the listeners of the channel, as database.Notify does once a transaction commits.
+// It never blocks, so a notification is dropped for a listener which has 64 notifications pending.
+func (d *Database) Notify(channel string, payload string) {
+	d.mu.Lock()
+	listeners := slices.Clone(d.listeners[channel])
+	d.mu.Unlock()
+
+	for _, notifications := range listeners {
+		select {
+		case notifications <- database.Notification{Channel: channel, Payload: payload}:
+		default:
+		}
+	}
+}
+
+// RunLeaderElection elects the election once no other election of the key leads, and leads until the context is done.
+func (d *Database) RunLeaderElection(ctx context.Context, election database.LeaderElection) error {
+	if election.Key == "" {
+		return errors.New("leader election key cannot be empty")
+	}
+
+	if election.OnElected == nil {
+		return errors.New("leader election needs OnElected")
+	}
+
+	lock := d.lock(election.Key)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case lock <- struct{}{}:
+	}
+
+	defer func() { <-lock }()
+
+	election.OnElected(ctx)
+	<-ctx.Done()
+
+	if election.OnRevoked != nil {
+		election.OnRevoked()
+	}
+
+	return nil
+}
+
+// WithAdvisoryLock executes the function once no other function or leader election holds the lock of the key.
+// Unlike database.Database, a transaction lock is released when the function returns rather than when its transaction ends.
+func (d *Database) WithAdvisoryLock(
+	ctx context.Context,
+	key string,
+	fn func(ctx context.Context) error,
+	opts ...database.AdvisoryLockOptions,
+) error {
+	if key == "" {
+		return errors.New("lock key cannot be empty")
+	}
+
+	var o database.AdvisoryLockOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if tx, ok := ctx.Value(txKey{}).(dbtx); ok && tx.readOnly && o.Transaction {
+		return database.ErrReadOnlyLock
+	}
+
+	lock := d.lock(key)
+
+	if o.Try {
+		select {
+		case lock <- struct{}{}:
+		default:
+			return fmt.Errorf("failed to acquire lock %s: %w", key, database.ErrLockNotAcquired)
+		}
+	} else {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to acquire lock %s: %w", key, ctx.Err())
+		case lock <- struct{}{}:
+		}
+	}
+
+	defer func() { <-lock }()
+
+	if o.Transaction {
+		return d.Transactional(ctx, database.TxOptions{}, fn)
+	}
+
+	return fn(ctx)
+}
+
+// lock returns the channel holding a token while the advisory lock of the key is held.
+func (d *Database) lock(key string) chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.locks == nil {
+		d.locks = map[string]chan struct{}{}
+	}
+
+	lock, ok := d.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		d.locks[key] = lock
+	}
+
+	return lock
+}
+
+// WithReadTX runs the function with a fake read-only transaction and records it.
+func (d *Database) WithReadTX(ctx context.Context, fn func(tx database.DBTX) error, existingQ ...database.DBTX) error {
+	return d.run(fn, true, "", withAmbient(ctx, existingQ)...)
+}
+
+// WithTX runs the function with a fake transaction and records it.
+func (d *Database) WithTX(ctx context.Context, fn func(tx database.DBTX) error, existingQ ...database.DBTX) error {
+	return d.run(fn, false, "", withAmbient(ctx, existingQ)...)
+}
+
+// withAmbient returns the fake transaction carried by the context as existing transaction if none is given.
+func withAmbient(ctx context.Context, existingQ []database.DBTX) []database.DBTX {
+	if tx, ok := ctx.Value(txKey{}).(dbtx); ok && len(existingQ) == 0 {
+		return []database.DBTX{tx}
+	}
+
+	return existingQ
+}
+
+// Transactional runs the function with a context carrying a fake transaction, following the propagation
+// of the options, and records the transactions which are begun.
+// Like database.Database, a new transaction is retried without delay when the function fails with an error
+// matching database.IsRetryable, as often as configured by the retry options.
+func (d *Database) Transactional(ctx context.Context, opts database.TxOptions, fn func(ctx context.Context) error) error {
+	ambient, hasAmbient := ctx.Value(txKey{}).(dbtx)
+
+	switch opts.Propagation {
+	case database.PropagationSupports:
+		return wrapErr(fn(ctx))
+	case database.PropagationNever:
+		if hasAmbient {
+			return database.ErrTransactionExists
+		}
+
+		return wrapErr(fn(ctx))
+	case database.PropagationRequiresNew:
+		hasAmbient = false
+	case database.PropagationRequired:
+		if hasAmbient {
+			return d.join(ctx, ambient, opts, fn)
+		}
+	case database.PropagationNested:
+	}
+
+	existingQ := []database.DBTX{}
+	if hasAmbient {
+		existingQ = append(existingQ, ambient)
+	}
+
+	run := func() error {
+		return d.run(func(tx database.DBTX) error {
+			return fn(context.WithValue(ctx, txKey{}, tx))
+		}, opts.ReadOnly, opts.Isolation, existingQ...)
+	}
+
+	err := run()
+	for retries := 0; !hasAmbient && retries < opts.Retry.MaxRetries && database.IsRetryable(err); retries++ {
+		err = run()
+	}
+
+	return err
+}
+
+// join runs the function in the fake transaction carried by the context like database.Database,
+// marking the transaction as rollback-only when the function fails.
+func (d *Database) join(ctx context.Context, tx dbtx, opts database.TxOptions, fn func(ctx context.Context) error) error {
+	if tx.readOnly && !opts.ReadOnly {
+		return database.ErrReadOnlyTransaction
+	}
+
+	err := fn(ctx)
+	if err != nil && tx.rollbackOnly != nil {
+		tx.rollbackOnly.Store(true)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.transactions = append(d.transactions, Transaction{
+		ReadOnly:  opts.ReadOnly,
+		Committed: err == nil,
+		Nested:    true,
+		Isolation: opts.Isolation,
+	})
+
+	return wrapErr(err)
+}
+
+// Conn returns the fake transaction carried by the context, or a fake DBTX outside of transactions.
+func (d *Database) Conn(ctx context.Context) database.DBTX {
+	if tx, ok := ctx.Value(txKey{}).(dbtx); ok {
+		return tx
+	}
+
+	return dbtx{}
+}
+
+// txKey is the context key of the fake transaction of Transactional.
+type txKey struct{}
+
+func (d *Database) run(
+	fn func(tx database.DBTX) error,
+	readOnly bool,
+	isolation database.IsolationLevel,
+	existingQ ...database.DBTX,
+) error {
+	var tx database.DBTX = dbtx{readOnly: readOnly, rollbackOnly: &atomic.Bool{}}
+
+	if len(existingQ) > 0 {
+		tx = existingQ[0]
+
+		// like the savepoints of database.Database, a read-write transaction cannot be nested in a read-only one
+		if outer, ok := existingQ[0].(dbtx); ok {
+			if outer.readOnly && !readOnly {
+				return database.ErrReadOnlyTransaction
+			}
+
+			tx = dbtx{readOnly: readOnly || outer.readOnly, rollbackOnly: &atomic.Bool{}}
+		}
+	}
+
+	err := wrapErr(fn(tx))
+	if fake, ok := tx.(dbtx); ok && err == nil && fake.rollbackOnly.Load() {
+		err = database.ErrRollbackOnly
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.transactions = append(d.transactions, Transaction{
+		ReadOnly:  readOnly,
+		Committed: err == nil,
+		Nested:    len(existingQ) > 0,
+		Isolation: isolation,
+	})
+
+	return err
+}
+
+// wrapErr wraps the error of a transaction function like database.Database.
+func wrapErr(err error) error {
+	if err != nil {
+		return fmt.Errorf("transaction function failed: %w", err)
+	}
+
+	return nil
+}
+
+// Transactions returns the recorded transactions in the order they finished.
+func (d *Database) Transactions() []Transaction {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Transaction{}, d.transactions...)
+}
+
+// Reset clears the recorded transactions.
+func (d *Database) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.transactions = nil
+}
+
+// dbtx is a database.DBTX which fails every query.
+type dbtx struct {
+	readOnly     bool
+	rollbackOnly *atomic.Bool // Whether a function which joined the transaction failed, nil outside of transactions
+}
+
+func (dbtx) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, ErrNotSupported
+}
+
+func (dbtx) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, ErrNotSupported
+}
+
+func (dbtx) QueryRow(context.Context, string, ...any) pgx.Row {
+	return errRow{}
+}
+
+func (dbtx) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+func (dbtx) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return errBatchResults{}
+}
+
+// errBatchResults fails every statement of a batch.
+type errBatchResults struct{}
+
+func (errBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, ErrNotSupported
+}
+
+func (errBatchResults) Query() (pgx.Rows, error) {
+	return nil, ErrNotSupported
+}
+
+func (errBatchResults) QueryRow() pgx.Row {
+	return errRow{}
+}
+
+func (errBatchResults) Close() error {
+	return ErrNotSupported
+}
+
+type errRow struct{}
+
+func (errRow) Scan(...any) error {
+	return ErrNotSupported
+}
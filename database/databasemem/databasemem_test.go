@@ -0,0 +1,309 @@
+package databasemem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/database"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	fnErr := errors.New("failed")
+
+	err := db.WithTX(ctx, func(tx database.DBTX) error {
+		return db.WithReadTX(ctx, func(tx database.DBTX) error {
+			return nil
+		}, tx)
+	})
+	assert.NoError(t, err)
+
+	err = db.WithReadTX(ctx, func(tx database.DBTX) error {
+		return fnErr
+	})
+	assert.ErrorIs(t, err, fnErr)
+
+	assert.Equal(t, []Transaction{
+		{ReadOnly: true, Committed: true, Nested: true},
+		{Committed: true},
+		{ReadOnly: true},
+	}, db.Transactions())
+
+	db.Reset()
+	assert.Empty(t, db.Transactions())
+}
+
+func TestReadWriteInReadOnlyTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	err := db.WithReadTX(ctx, func(tx database.DBTX) error {
+		return db.WithTX(ctx, func(tx database.DBTX) error {
+			return nil
+		}, tx)
+	})
+	assert.ErrorIs(t, err, database.ErrReadOnlyTransaction)
+}
+
+func TestQueriesAreNotSupported(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	err := db.WithTX(ctx, func(tx database.DBTX) error {
+		_, err := database.SelectRow[struct{}](ctx, tx, "SELECT 1")
+		return err
+	})
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
+
+func TestTransactional(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	err := db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+		err := db.WithTX(ctx, func(tx database.DBTX) error { return nil })
+		if err != nil {
+			return err
+		}
+
+		err = db.Transactional(ctx, database.TxOptions{Propagation: database.PropagationRequiresNew}, func(ctx context.Context) error {
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return db.Transactional(ctx, database.TxOptions{Propagation: database.PropagationNever}, func(ctx context.Context) error {
+			return nil
+		})
+	})
+	assert.ErrorIs(t, err, database.ErrTransactionExists)
+
+	assert.Equal(t, []Transaction{
+		{Committed: true, Nested: true},
+		{Committed: true},
+		{},
+	}, db.Transactions())
+}
+
+func TestTransactionalRequiredAndNested(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	fnErr := errors.New("failed")
+
+	err := db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+		err := db.Transactional(ctx, database.TxOptions{Propagation: database.PropagationNested}, func(ctx context.Context) error {
+			return fnErr
+		})
+		assert.ErrorIs(t, err, fnErr)
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+		err := db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+			return fnErr
+		})
+		assert.ErrorIs(t, err, fnErr)
+
+		return nil
+	})
+	assert.ErrorIs(t, err, database.ErrRollbackOnly)
+
+	assert.Equal(t, []Transaction{
+		{Nested: true},
+		{Committed: true},
+		{Nested: true},
+		{},
+	}, db.Transactions())
+}
+
+func TestTransactionalRetry(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	serializationFailure := &pgconn.PgError{Code: "40001"}
+
+	attempts := 0
+	opts := database.TxOptions{
+		Isolation: database.IsolationSerializable,
+		Retry:     database.RetryOptions{MaxRetries: 2},
+	}
+
+	err := db.Transactional(ctx, opts, func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return serializationFailure
+		}
+
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	err = db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+		return serializationFailure
+	})
+	assert.ErrorIs(t, err, serializationFailure)
+
+	assert.Equal(t, []Transaction{
+		{Isolation: database.IsolationSerializable},
+		{Committed: true, Isolation: database.IsolationSerializable},
+		{},
+	}, db.Transactions())
+}
+
+func TestListen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := New()
+
+	received := make(chan database.Notification, 1)
+	done := make(chan error)
+
+	go func() {
+		done <- db.Listen(ctx, "books", func(_ context.Context, n database.Notification) error {
+			received <- n
+			return nil
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		return len(db.listeners["books"]) == 1
+	}, time.Second, time.Millisecond)
+
+	db.Notify("authors", "ignored")
+	db.Notify("books", "1")
+
+	assert.Equal(t, database.Notification{Channel: "books", Payload: "1"}, <-received)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, db.listeners["books"])
+}
+
+func TestRunLeaderElection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := New()
+
+	events := make(chan string, 4)
+	done := make(chan error, 2)
+
+	for _, name := range []string{"a", "b"} {
+		go func() {
+			done <- db.RunLeaderElection(ctx, database.LeaderElection{
+				Key:       "scheduler",
+				OnElected: func(context.Context) { events <- name + " elected" },
+				OnRevoked: func() { events <- name + " revoked" },
+			})
+		}()
+	}
+
+	first := <-events
+
+	select {
+	case event := <-events:
+		t.Fatalf("only one election should lead, got %s after %s", event, first)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+	assert.Equal(t, first[:1]+" revoked", <-events)
+}
+
+func TestWithAdvisoryLock(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	err := db.WithAdvisoryLock(ctx, "cleanup", func(ctx context.Context) error {
+		err := db.WithAdvisoryLock(ctx, "cleanup", func(context.Context) error {
+			t.Error("held lock should not be acquired")
+			return nil
+		}, database.AdvisoryLockOptions{Try: true})
+		assert.ErrorIs(t, err, database.ErrLockNotAcquired)
+
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, db.WithAdvisoryLock(waitCtx, "cleanup", func(context.Context) error { return nil }), context.DeadlineExceeded)
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// a transaction lock runs the function in a transaction
+	err = db.WithAdvisoryLock(ctx, "cleanup", func(context.Context) error { return nil },
+		database.AdvisoryLockOptions{Transaction: true, Try: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Transaction{{Committed: true}}, db.Transactions())
+
+	err = db.Transactional(ctx, database.TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+		return db.WithAdvisoryLock(ctx, "cleanup", func(context.Context) error { return nil },
+			database.AdvisoryLockOptions{Transaction: true})
+	})
+	assert.ErrorIs(t, err, database.ErrReadOnlyLock)
+
+	assert.EqualError(t, db.WithAdvisoryLock(ctx, "", func(context.Context) error { return nil }), "lock key cannot be empty")
+}
+
+func TestNotifyDoesNotBlockOnSlowListeners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := New()
+
+	handling := make(chan struct{}, 1)
+	release := make(chan struct{})
+	done := make(chan error)
+
+	go func() {
+		done <- db.Listen(ctx, "books", func(context.Context, database.Notification) error {
+			select {
+			case handling <- struct{}{}:
+			default:
+			}
+
+			<-release
+
+			return nil
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		return len(db.listeners["books"]) == 1
+	}, time.Second, time.Millisecond)
+
+	db.Notify("books", "first")
+	<-handling
+
+	notified := make(chan struct{})
+
+	go func() {
+		// more notifications than the listener buffers while its handler is busy
+		for range 100 {
+			db.Notify("books", "pending")
+		}
+
+		close(notified)
+	}()
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("notify should not block on a slow listener")
+	}
+
+	cancel()
+	close(release)
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MaxFilterValues is the maximum number of values of an `in` filter condition.
+const MaxFilterValues = 100
+
+// ErrInvalidFilter is matched by every error caused by a filter condition which is malformed or not allowed.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// FilterError describes why a filter condition was rejected.
+// It matches ErrInvalidFilter and is returned to clients with HTTP status 400.
+type FilterError struct {
+	Condition string // The rejected condition, e.g: "title[gt]"
+	Reason    string // Why the condition was rejected
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("invalid filter %q: %s", e.Condition, e.Reason)
+}
+
+func (e *FilterError) Is(target error) bool {
+	return target == ErrInvalidFilter
+}
+
+// HTTPStatus returns the HTTP status code the error should be returned to clients with.
+func (e *FilterError) HTTPStatus() int {
+	return http.StatusBadRequest
+}
+
+// FilterOperator is an operator of a filter condition.
+type FilterOperator string
+
+const (
+	FilterEq     FilterOperator = "eq"    // Equal to the value
+	FilterNe     FilterOperator = "ne"    // Not equal to the value
+	FilterGt     FilterOperator = "gt"    // Greater than the value
+	FilterGte    FilterOperator = "gte"   // Greater than or equal to the value
+	FilterLt     FilterOperator = "lt"    // Less than the value
+	FilterLte    FilterOperator = "lte"   // Less than or equal to the value
+	FilterLike   FilterOperator = "like"  // Matches the LIKE pattern of the value, e.g: "%go%"
+	FilterILike  FilterOperator = "ilike" // Matches the case-insensitive LIKE pattern of the value
+	FilterIn     FilterOperator = "in"    // Equal to one of the comma separated values
+	FilterIsNull FilterOperator = "null"  // Is null when the value is true, is not null when false
+)
+
+// filterOperators maps the operators to their SQL comparison operators.
+var filterOperators = map[FilterOperator]string{
+	FilterEq:    "=",
+	FilterNe:    "<>",
+	FilterGt:    ">",
+	FilterGte:   ">=",
+	FilterLt:    "<",
+	FilterLte:   "<=",
+	FilterLike:  "LIKE",
+	FilterILike: "ILIKE",
+}
+
+// FilterCondition is a condition on a filter field.
+type FilterCondition struct {
+	Field    string         // The filter field as given by the client
+	Operator FilterOperator // The operator of the condition
+	Values   []string       // The values of the condition, only `in` conditions have multiple values
+}
+
+func (c FilterCondition) String() string {
+	return fmt.Sprintf("%s[%s]", c.Field, c.Operator)
+}
+
+// Filter is a list of filter conditions which all must match.
+// It is bound from the query parameters of the format `field[operator]=value` with the `query:"*"` tag,
+// where the `filter` tag documents the allowed fields and operators in the OpenAPI specification,
+// or the `filterable` tag names the Filterable variable whose fields and operators are documented.
+//
+// Example usage:
+//
+//	var req struct {
+//	    database.PageRequest
+//	    Filter database.Filter `query:"*" filter:"title:eq,ilike;createdAt:gte,lte;id:in"`
+//	}
+type Filter []FilterCondition
+
+// filterParamPattern matches the query parameters of filter conditions, e.g: "title[ilike]".
+var filterParamPattern = regexp.MustCompile(`^(\w+)\[(\w+)\]$`)
+
+// UnmarshalQuery parses the filter conditions of the query parameters, ignoring every other parameter.
+func (f *Filter) UnmarshalQuery(values url.Values) error {
+	filter := Filter{}
+
+	params := []string{}
+	for param := range values {
+		params = append(params, param)
+	}
+
+	slices.Sort(params)
+
+	for _, param := range params {
+		match := filterParamPattern.FindStringSubmatch(param)
+		if match == nil {
+			continue
+		}
+
+		operator := FilterOperator(match[2])
+		if _, ok := filterOperators[operator]; !ok && operator != FilterIn && operator != FilterIsNull {
+			return &FilterError{Condition: param, Reason: fmt.Sprintf("unknown operator %q", operator)}
+		}
+
+		if operator == FilterIn {
+			inValues := []string{}
+			for _, value := range values[param] {
+				inValues = append(inValues, strings.Split(value, ",")...)
+			}
+
+			filter = append(filter, FilterCondition{Field: match[1], Operator: operator, Values: inValues})
+
+			continue
+		}
+
+		for _, value := range values[param] {
+			filter = append(filter, FilterCondition{Field: match[1], Operator: operator, Values: []string{value}})
+		}
+	}
+
+	*f = filter
+
+	return nil
+}
+
+// FilterField is an allowed filter field.
+type FilterField struct {
+	Expression string           // The SQL column or expression of the field, never built from client input
+	Operators  []FilterOperator // The operators allowed on the field
+	// Parses the values compared with the field, except LIKE patterns, which are bound as strings if nil.
+	// A value which fails to parse is rejected with a FilterError, instead of failing the query when the column
+	// cannot hold it, e.g: ParseFilterValue(uuid.Parse) for a uuid column.
+	Parse func(value string) (any, error)
+}
+
+// ParseFilterValue adapts a typed parse function to FilterField.Parse.
+//
+// Example usage:
+//
+//	database.Filterable{
+//	    "id": {Expression: "id", Operators: []database.FilterOperator{database.FilterEq}, Parse: database.ParseFilterValue(uuid.Parse)},
+//	}
+func ParseFilterValue[T any](parse func(value string) (T, error)) func(value string) (any, error) {
+	return func(value string) (any, error) {
+		return parse(value)
+	}
+}
+
+// arg returns the argument a value of a condition on the field is bound as.
+func (f FilterField) arg(condition FilterCondition, value string) (any, error) {
+	if f.Parse == nil || condition.Operator == FilterLike || condition.Operator == FilterILike {
+		return value, nil
+	}
+
+	parsed, err := f.Parse(value)
+	if err != nil {
+		return nil, &FilterError{Condition: condition.String(), Reason: fmt.Sprintf("invalid value %q", value)}
+	}
+
+	return parsed, nil
+}
+
+// Filterable maps the filter fields accepted from clients to SQL columns or expressions and their allowed operators.
+//
+// Example usage:
+//
+//	database.Filterable{
+//	    "title":     {Expression: "title", Operators: []database.FilterOperator{database.FilterEq, database.FilterILike}},
+//	    "createdAt": {Expression: "created_at", Operators: []database.FilterOperator{database.FilterGte, database.FilterLte}},
+//	}
+type Filterable map[string]FilterField
+
+// where compiles the filter to a parameterized WHERE clause, validating every condition against the allow-list.
+// Placeholders are numbered after argOffset. It returns an empty string if there are no conditions.
+func (f Filterable) where(filter Filter, argOffset int) (string, []any, error) {
+	conditions := []string{}
+	args := []any{}
+
+	for _, condition := range filter {
+		field, ok := f[condition.Field]
+		if !ok {
+			return "", nil, &FilterError{Condition: condition.String(), Reason: fmt.Sprintf("unknown filter field %q", condition.Field)}
+		}
+
+		if !slices.Contains(field.Operators, condition.Operator) {
+			return "", nil, &FilterError{Condition: condition.String(), Reason: fmt.Sprintf("operator %q is not allowed", condition.Operator)}
+		}
+
+		if len(condition.Values) == 0 {
+			return "", nil, &FilterError{Condition: condition.String(), Reason: "value cannot be empty"}
+		}
+
+		switch condition.Operator {
+		case FilterIsNull:
+			isNull, err := strconv.ParseBool(condition.Values[0])
+			if err != nil {
+				return "", nil, &FilterError{Condition: condition.String(), Reason: "value must be true or false"}
+			}
+
+			if isNull {
+				conditions = append(conditions, field.Expression+" IS NULL")
+			} else {
+				conditions = append(conditions, field.Expression+" IS NOT NULL")
+			}
+		case FilterIn:
+			if len(condition.Values) > MaxFilterValues {
+				return "", nil, &FilterError{Condition: condition.String(), Reason: fmt.Sprintf("at most %d values are allowed", MaxFilterValues)}
+			}
+
+			placeholders := make([]string, len(condition.Values))
+			for i, value := range condition.Values {
+				if value == "" {
+					return "", nil, &FilterError{Condition: condition.String(), Reason: "values cannot be empty"}
+				}
+
+				arg, err := field.arg(condition, value)
+				if err != nil {
+					return "", nil, err
+				}
+
+				args = append(args, arg)
+				placeholders[i] = fmt.Sprintf("$%d", argOffset+len(args))
+			}
+
+			conditions = append(conditions, field.Expression+" IN ("+strings.Join(placeholders, ", ")+")")
+		default:
+			arg, err := field.arg(condition, condition.Values[0])
+			if err != nil {
+				return "", nil, err
+			}
+
+			args = append(args, arg)
+			conditions = append(conditions, fmt.Sprintf("%s %s $%d", field.Expression, filterOperators[condition.Operator], argOffset+len(args)))
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// filterQuery applies the filter to a query by wrapping it in a subquery,
+// so the filter expressions can only reference its result columns.
+// The query is returned unchanged if there are no conditions.
+func filterQuery(query string, args []any, filter Filter, filterable Filterable) (string, []any, error) {
+	where, filterArgs, err := filterable.where(filter, len(args))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if where == "" {
+		return query, args, nil
+	}
+
+	return "SELECT * FROM (" + query + ") AS filter_query" + where, append(append([]any{}, args...), filterArgs...), nil
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFilterable = Filterable{
+	"id":        {Expression: "id", Operators: []FilterOperator{FilterEq, FilterIn}},
+	"title":     {Expression: "title", Operators: []FilterOperator{FilterEq, FilterILike, FilterIsNull}},
+	"createdAt": {Expression: "created_at", Operators: []FilterOperator{FilterGte, FilterLt}},
+}
+
+func TestFilterUnmarshalQuery(t *testing.T) {
+	values, err := url.ParseQuery("page=1&sort=title&title[ilike]=%25go%25&id[in]=1,2&id[in]=3&createdAt[gte]=2024-01-01&createdAt[gte]=2024-02-01")
+	require.NoError(t, err)
+
+	var filter Filter
+	require.NoError(t, filter.UnmarshalQuery(values))
+
+	assert.Equal(t, Filter{
+		{Field: "createdAt", Operator: FilterGte, Values: []string{"2024-01-01"}},
+		{Field: "createdAt", Operator: FilterGte, Values: []string{"2024-02-01"}},
+		{Field: "id", Operator: FilterIn, Values: []string{"1", "2", "3"}},
+		{Field: "title", Operator: FilterILike, Values: []string{"%go%"}},
+	}, filter)
+
+	err = filter.UnmarshalQuery(url.Values{"title[regex]": {".*"}})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestFilterableWhere(t *testing.T) {
+	t.Run("no conditions", func(t *testing.T) {
+		where, args, err := testFilterable.where(nil, 0)
+		require.NoError(t, err)
+		assert.Empty(t, where)
+		assert.Empty(t, args)
+	})
+
+	t.Run("conditions", func(t *testing.T) {
+		where, args, err := testFilterable.where(Filter{
+			{Field: "title", Operator: FilterILike, Values: []string{"%go%"}},
+			{Field: "id", Operator: FilterIn, Values: []string{"1", "2"}},
+			{Field: "createdAt", Operator: FilterLt, Values: []string{"2024-01-01"}},
+			{Field: "title", Operator: FilterIsNull, Values: []string{"false"}},
+		}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, " WHERE title ILIKE $2 AND id IN ($3, $4) AND created_at < $5 AND title IS NOT NULL", where)
+		assert.Equal(t, []any{"%go%", "1", "2", "2024-01-01"}, args)
+	})
+
+	t.Run("rejected conditions", func(t *testing.T) {
+		for name, condition := range map[string]FilterCondition{
+			"unknown field":        {Field: "created_at", Operator: FilterGte, Values: []string{"2024-01-01"}},
+			"operator not allowed": {Field: "title", Operator: FilterGt, Values: []string{"a"}},
+			"no value":             {Field: "title", Operator: FilterEq},
+			"null not a bool":      {Field: "title", Operator: FilterIsNull, Values: []string{"maybe"}},
+			"too many values":      {Field: "id", Operator: FilterIn, Values: strings.Split(strings.Repeat("1,", MaxFilterValues)+"1", ",")},
+			"empty in value":       {Field: "id", Operator: FilterIn, Values: []string{""}},
+			"empty value in list":  {Field: "id", Operator: FilterIn, Values: []string{"1", "", "2"}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, _, err := testFilterable.where(Filter{condition}, 0)
+				require.ErrorIs(t, err, ErrInvalidFilter)
+
+				var filterErr *FilterError
+				require.ErrorAs(t, err, &filterErr)
+				assert.Equal(t, http.StatusBadRequest, filterErr.HTTPStatus())
+			})
+		}
+	})
+
+	t.Run("parsed values", func(t *testing.T) {
+		id := uuid.New()
+		filterable := Filterable{
+			"id":    {Expression: "id", Operators: []FilterOperator{FilterEq, FilterIn}, Parse: ParseFilterValue(uuid.Parse)},
+			"count": {Expression: "count", Operators: []FilterOperator{FilterGt, FilterILike}, Parse: ParseFilterValue(strconv.Atoi)},
+		}
+
+		where, args, err := filterable.where(Filter{
+			{Field: "id", Operator: FilterIn, Values: []string{id.String()}},
+			{Field: "count", Operator: FilterGt, Values: []string{"2"}},
+			{Field: "count", Operator: FilterILike, Values: []string{"1%"}},
+		}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, " WHERE id IN ($1) AND count > $2 AND count ILIKE $3", where)
+		assert.Equal(t, []any{id, 2, "1%"}, args)
+
+		for _, condition := range []FilterCondition{
+			{Field: "id", Operator: FilterEq, Values: []string{"abc"}},
+			{Field: "id", Operator: FilterIn, Values: []string{id.String(), "abc"}},
+			{Field: "count", Operator: FilterGt, Values: []string{"two"}},
+		} {
+			_, _, err := filterable.where(Filter{condition}, 0)
+
+			var filterErr *FilterError
+			require.ErrorAs(t, err, &filterErr)
+			assert.Equal(t, `invalid filter "`+condition.String()+`": invalid value "`+condition.Values[len(condition.Values)-1]+`"`, filterErr.Error())
+		}
+	})
+
+	t.Run("nil allow-list", func(t *testing.T) {
+		_, _, err := Filterable(nil).where(Filter{{Field: "title", Operator: FilterEq, Values: []string{"a"}}}, 0)
+		assert.ErrorIs(t, err, ErrInvalidFilter)
+	})
+}
+
+func TestFilterQuery(t *testing.T) {
+	query, args, err := filterQuery("SELECT * FROM books WHERE description = $1", []any{"description"}, nil, testFilterable)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM books WHERE description = $1", query)
+	assert.Equal(t, []any{"description"}, args)
+
+	query, args, err = filterQuery("SELECT * FROM books WHERE description = $1", []any{"description"},
+		Filter{{Field: "title", Operator: FilterEq, Values: []string{"title"}}}, testFilterable)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM books WHERE description = $1) AS filter_query WHERE title = $2", query)
+	assert.Equal(t, []any{"description", "title"}, args)
+}
+
+func TestSelectPageFilter(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	description := uuid.NewString()
+
+	err := db.WithTX(ctx, func(tx DBTX) error {
+		for _, title := range []string{"Learning Go", "Go in Action", "Rust in Action"} {
+			err := ExecQuery(ctx, tx, "INSERT INTO books (title, description) VALUES ($1, $2)", title, description)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = db.WithReadTX(ctx, func(tx DBTX) error {
+		page, err := SelectPage[Book](ctx, tx, PageQuery{
+			Request:    PageRequest{Size: 10, Sort: []string{"title"}},
+			Query:      "SELECT * FROM books WHERE description = $1",
+			Args:       []any{description},
+			Filter:     Filter{{Field: "title", Operator: FilterILike, Values: []string{"%go%"}}},
+			Filterable: testFilterable,
+		})
+		if err != nil {
+			return err
+		}
+
+		assert.Equal(t, int64(2), page.TotalElements)
+		assert.Len(t, page.Content, 2)
+		assert.Equal(t, "Go in Action", page.Content[0].Title)
+
+		ids := []string{}
+		for _, book := range page.Content {
+			ids = append(ids, strconv.Itoa(book.ID))
+		}
+
+		page, err = SelectPage[Book](ctx, tx, PageQuery{
+			Request:    PageRequest{Size: 10},
+			Query:      "SELECT * FROM books WHERE description = $1",
+			Args:       []any{description},
+			Filter:     Filter{{Field: "id", Operator: FilterIn, Values: ids}},
+			Filterable: testFilterable,
+		})
+		if err != nil {
+			return err
+		}
+
+		assert.Len(t, page.Content, 2)
+
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,284 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Defaults of the health checks and reconnects of the connection pool.
+const (
+	DefaultHealthCheckInterval = 5 * time.Second  // How often the pool is health checked while it is healthy
+	DefaultReconnectDelay      = time.Second      // The delay before the second reconnect attempt, doubled for each attempt
+	DefaultMaxReconnectDelay   = 30 * time.Second // The maximum delay between reconnect attempts
+	DefaultHealthCheckTimeout  = 30 * time.Second // How long the ping of the primary or of a replica, or a reconnect attempt, may take
+)
+
+// ReconnectEventType is the type of a ReconnectEvent.
+type ReconnectEventType string
+
+const (
+	ReconnectUnhealthy   ReconnectEventType = "unhealthy"        // The health check of the pool failed
+	ReconnectFailed      ReconnectEventType = "reconnect_failed" // A reconnect attempt failed
+	ReconnectSucceeded   ReconnectEventType = "reconnected"      // A new pool replaced the unhealthy pool
+	ReconnectReplicaDown ReconnectEventType = "replica_down"     // The health check of a replica failed
+	ReconnectReplicaUp   ReconnectEventType = "replica_up"       // A replica is healthy again
+)
+
+// ReconnectEvent is an event of the health checks and reconnects of the database, see OnReconnect.
+type ReconnectEvent struct {
+	Type    ReconnectEventType
+	Attempt int       // The number of the reconnect attempt, 0 for health checks
+	Replica string    // The host and port of the replica for replica events
+	Err     error     // The error of the health check or reconnect attempt
+	Time    time.Time // When the event occurred
+}
+
+// Health describes the connection pool of the database and its reconnects, e.g: for health checks.
+type Health struct {
+	Healthy             bool            `json:"healthy"`             // Whether the last health check succeeded
+	Reconnects          int64           `json:"reconnects"`          // The number of pools which replaced an unhealthy pool
+	FailedReconnects    int64           `json:"failedReconnects"`    // The number of failed reconnect attempts
+	ConsecutiveFailures int             `json:"consecutiveFailures"` // The number of failed reconnect attempts since the pool is unhealthy
+	LastError           string          `json:"lastError,omitempty"` // The error of the last failed health check or reconnect attempt
+	LastCheck           time.Time       `json:"lastCheck"`           // When the pool was last health checked
+	TotalConns          int32           `json:"totalConns"`          // The number of connections of the pool
+	IdleConns           int32           `json:"idleConns"`           // The number of idle connections of the pool
+	AcquiredConns       int32           `json:"acquiredConns"`       // The number of connections in use
+	Replicas            []ReplicaHealth `json:"replicas,omitempty"`  // The health of the replicas
+}
+
+// ReplicaHealth describes the health of a replica.
+type ReplicaHealth struct {
+	Name    string `json:"name"`    // The host and port of the replica
+	Healthy bool   `json:"healthy"` // Whether the replica receives read-only transactions
+}
+
+// reconnectPolicy defines how often the pool is health checked and reconnected.
+type reconnectPolicy struct {
+	interval time.Duration // How often a healthy pool is health checked
+	delay    time.Duration // The delay after the first failed reconnect attempt
+	maxDelay time.Duration // The maximum delay between reconnect attempts
+	timeout  time.Duration // How long each ping and reconnect attempt may take
+}
+
+var defaultReconnectPolicy = reconnectPolicy{
+	interval: DefaultHealthCheckInterval,
+	delay:    DefaultReconnectDelay,
+	maxDelay: DefaultMaxReconnectDelay,
+	timeout:  DefaultHealthCheckTimeout,
+}
+
+// backoff returns the delay after the given number of consecutive failed reconnect attempts,
+// doubling from the delay up to the maximum delay, with up to half of it as random jitter
+// so that the instances of a service do not reconnect at the same time.
+func (p reconnectPolicy) backoff(failures int) time.Duration {
+	delay := p.delay
+	for i := 1; i < failures && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, p.maxDelay)
+
+	return delay/2 + rand.N(delay/2+1) //nolint:gosec
+}
+
+// healthState is the health of the pool and the listeners of its events, guarded by a mutex
+// as it is written by the reconnect loop and read by health checks.
+type healthState struct {
+	mu        sync.Mutex
+	health    Health
+	listeners []func(ReconnectEvent)
+}
+
+// Health returns the health of the connection pool, its reconnects and the replicas.
+func (d *dbo) Health() Health {
+	d.state.mu.Lock()
+	health := d.state.health
+	d.state.mu.Unlock()
+
+	stat := d.pool.Load().Stat()
+	health.TotalConns = stat.TotalConns()
+	health.IdleConns = stat.IdleConns()
+	health.AcquiredConns = stat.AcquiredConns()
+
+	health.Replicas = make([]ReplicaHealth, 0, len(d.replicas))
+	for _, r := range d.replicas {
+		health.Replicas = append(health.Replicas, ReplicaHealth{Name: r.name, Healthy: r.healthy.Load()})
+	}
+
+	return health
+}
+
+// OnReconnect registers a listener of the health check and reconnect events, e.g: to export metrics.
+// The listeners are called by the reconnect loop, so they should return quickly.
+func (d *dbo) OnReconnect(listener func(event ReconnectEvent)) {
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	d.state.listeners = append(d.state.listeners, listener)
+}
+
+// emit updates the health with the event and calls the listeners with it.
+func (d *dbo) emit(event ReconnectEvent) {
+	event.Time = time.Now()
+
+	d.state.mu.Lock()
+
+	health := &d.state.health
+	if event.Err != nil {
+		health.LastError = event.Err.Error()
+	}
+
+	switch event.Type {
+	case ReconnectUnhealthy:
+		health.Healthy = false
+		health.LastCheck = event.Time
+	case ReconnectFailed:
+		health.FailedReconnects++
+		health.ConsecutiveFailures = event.Attempt
+	case ReconnectSucceeded:
+		health.Healthy = true
+		health.Reconnects++
+		health.ConsecutiveFailures = 0
+	case ReconnectReplicaDown, ReconnectReplicaUp:
+	}
+
+	listeners := append([]func(ReconnectEvent){}, d.state.listeners...)
+
+	d.state.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// markHealthy records a successful health check of the pool.
+func (d *dbo) markHealthy() {
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	d.state.health.Healthy = true
+	d.state.health.LastCheck = time.Now()
+}
+
+// runReconnect starts a goroutine that periodically checks the health of the database connection pool,
+// and reconnects with backoff while it is unhealthy. It stops when Disconnect tears down the database.
+func (d *dbo) runReconnect() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.teardown = ctx
+	d.stopReconnect = cancel
+	d.reconnectDone = make(chan struct{})
+
+	go func() {
+		defer close(d.reconnectDone)
+
+		failures := 0
+
+		for {
+			delay := d.reconnectPolicy.interval
+			if !d.healthCheckPool(ctx, failures) {
+				failures++
+				delay = d.reconnectPolicy.backoff(failures)
+			} else {
+				failures = 0
+			}
+
+			select {
+			case <-ctx.Done():
+				slog.Info("db is being torn down, stopping health checks")
+				return
+			case <-time.After(delay):
+			}
+		}
+	}()
+}
+
+// healthCheckPool checks the health of the database connection pool and of the replicas,
+// and replaces the pool with a new pool if it is unhealthy. failures is the number of failed reconnect attempts
+// so far, and it returns whether the pool is healthy.
+// Every ping and the reconnect attempt have their own timeout, so that a hanging replica does not fail the others.
+func (d *dbo) healthCheckPool(ctx context.Context, failures int) bool {
+	d.healthCheckReplicas(ctx)
+
+	pingCtx, cancel := context.WithTimeout(ctx, d.reconnectPolicy.timeout)
+	err := d.pool.Load().Ping(pingCtx)
+
+	cancel()
+
+	if err == nil {
+		d.markHealthy()
+		return true
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if failures == 0 {
+		slog.Error("db is not healthy", "error", err)
+		d.emit(ReconnectEvent{Type: ReconnectUnhealthy, Err: err})
+	}
+
+	// migrations are not run again, as they were applied when the database was created
+	reconnectCtx, cancel := context.WithTimeout(ctx, d.reconnectPolicy.timeout)
+	defer cancel()
+
+	pool, err := d.newPool(reconnectCtx)
+	if err != nil {
+		slog.Error("failed to reconnect to db", "attempt", failures+1, "error", err)
+		d.emit(ReconnectEvent{Type: ReconnectFailed, Attempt: failures + 1, Err: err})
+
+		return false
+	}
+
+	d.swapPool(pool)
+
+	slog.Info("reconnected to db", "attempt", failures+1)
+	d.emit(ReconnectEvent{Type: ReconnectSucceeded, Attempt: failures + 1})
+
+	return true
+}
+
+// swapPool replaces the pool atomically, and closes the old pool once its acquired connections are released,
+// so that queries and transactions which are in flight can finish.
+func (d *dbo) swapPool(pool *pgxpool.Pool) {
+	old := d.pool.Swap(pool)
+	if old == nil {
+		return
+	}
+
+	d.draining.Add(1)
+
+	go func() {
+		defer d.draining.Done()
+
+		old.Close()
+	}()
+}
+
+// newPool connects to the database.
+// It creates a connection pool from a copy of the parsed configuration.
+func (d *dbo) newPool(ctx context.Context) (*pgxpool.Pool, error) {
+	// give 15 seconds for the db to be ready
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, d.poolConfig.Copy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection pool: %w", err)
+	}
+
+	err = pool.Ping(ctx)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableDatabase returns a database whose pools connect lazily to a port nothing listens on.
+func unreachableDatabase(t *testing.T) *dbo {
+	t.Helper()
+
+	poolCfg, err := PoolConfig(config.DatabaseConfig{Host: "127.0.0.1", Port: 1, User: "postgres", Name: "zumi"})
+	require.NoError(t, err)
+
+	poolCfg.ConnConfig.ConnectTimeout = time.Second
+
+	d := &dbo{
+		poolConfig: poolCfg,
+		reconnectPolicy: reconnectPolicy{
+			interval: 10 * time.Millisecond,
+			delay:    time.Millisecond,
+			maxDelay: 5 * time.Millisecond,
+			timeout:  time.Second,
+		},
+	}
+	d.pool.Store(newLazyPool(t, poolCfg))
+
+	return d
+}
+
+// newLazyPool creates a pool which does not connect until a connection is acquired.
+func newLazyPool(t *testing.T, poolCfg *pgxpool.Config) *pgxpool.Pool {
+	t.Helper()
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg.Copy())
+	require.NoError(t, err)
+
+	return pool
+}
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	policy := reconnectPolicy{delay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	for failures, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		50: time.Second,
+	} {
+		for range 20 {
+			delay := policy.backoff(failures)
+			assert.GreaterOrEqual(t, delay, want/2, "failures %d", failures)
+			assert.LessOrEqual(t, delay, want, "failures %d", failures)
+		}
+	}
+}
+
+func TestSwapPool(t *testing.T) {
+	d := unreachableDatabase(t)
+	initial := d.pool.Load()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	// requests read the pool while it is swapped
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				assert.NotNil(t, d.Conn(ctx))
+				d.Health()
+			}
+		}()
+	}
+
+	pools := []*pgxpool.Pool{initial}
+	for range 10 {
+		pool := newLazyPool(t, d.poolConfig)
+		d.swapPool(pool)
+		pools = append(pools, pool)
+	}
+
+	cancel()
+	wg.Wait()
+	d.draining.Wait()
+
+	assert.Same(t, pools[len(pools)-1], d.pool.Load())
+
+	// the replaced pools are closed, so acquiring a connection fails immediately
+	for _, pool := range pools[:len(pools)-1] {
+		_, err := pool.Acquire(context.Background())
+		assert.ErrorContains(t, err, "closed pool")
+	}
+
+	d.Disconnect()
+}
+
+func TestReconnect(t *testing.T) {
+	d := unreachableDatabase(t)
+
+	var (
+		mu     sync.Mutex
+		events []ReconnectEvent
+	)
+
+	d.OnReconnect(func(event ReconnectEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events = append(events, event)
+	})
+
+	d.runReconnect()
+
+	assert.Eventually(t, func() bool {
+		return d.Health().FailedReconnects >= 3
+	}, 10*time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+
+	d.Disconnect()
+
+	assert.Less(t, time.Since(start), time.Second, "disconnect should stop the reconnect loop")
+
+	health := d.Health()
+	assert.False(t, health.Healthy)
+	assert.Zero(t, health.Reconnects)
+	assert.GreaterOrEqual(t, health.ConsecutiveFailures, 3)
+	assert.NotEmpty(t, health.LastError)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the pool is reported unhealthy once, followed by the failed attempts
+	require.NotEmpty(t, events)
+	assert.Equal(t, ReconnectUnhealthy, events[0].Type)
+
+	for i, event := range events[1:] {
+		assert.Equal(t, ReconnectFailed, event.Type)
+		assert.Equal(t, i+1, event.Attempt)
+		assert.Error(t, event.Err)
+	}
+
+	// no event is emitted after Disconnect returns
+	count := len(events)
+
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+
+	assert.Len(t, events, count)
+}
+
+func TestHealthEvents(t *testing.T) {
+	d := &dbo{}
+
+	var reconnects atomic.Int64
+
+	d.OnReconnect(func(event ReconnectEvent) {
+		if event.Type == ReconnectSucceeded {
+			reconnects.Add(1)
+		}
+	})
+
+	d.markHealthy()
+	assert.True(t, d.state.health.Healthy)
+
+	d.emit(ReconnectEvent{Type: ReconnectUnhealthy, Err: assert.AnError})
+	d.emit(ReconnectEvent{Type: ReconnectFailed, Attempt: 1, Err: assert.AnError})
+	d.emit(ReconnectEvent{Type: ReconnectFailed, Attempt: 2, Err: assert.AnError})
+
+	assert.False(t, d.state.health.Healthy)
+	assert.Equal(t, 2, d.state.health.ConsecutiveFailures)
+	assert.Equal(t, int64(2), d.state.health.FailedReconnects)
+	assert.Equal(t, assert.AnError.Error(), d.state.health.LastError)
+
+	d.emit(ReconnectEvent{Type: ReconnectSucceeded, Attempt: 3})
+
+	assert.True(t, d.state.health.Healthy)
+	assert.Zero(t, d.state.health.ConsecutiveFailures)
+	assert.Equal(t, int64(1), d.state.health.Reconnects)
+	assert.Equal(t, int64(1), reconnects.Load())
+}
+
+func TestHealthCheckHangingReplicas(t *testing.T) {
+	// a server which accepts connections and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	accepted := make(chan net.Conn, 10)
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+
+		for len(accepted) > 0 {
+			_ = (<-accepted).Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			select {
+			case accepted <- conn:
+			default:
+				_ = conn.Close()
+			}
+		}
+	}()
+
+	d := unreachableDatabase(t)
+	d.reconnectPolicy.timeout = 100 * time.Millisecond
+
+	port := listener.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert
+
+	for range 3 {
+		poolCfg, err := PoolConfig(config.DatabaseConfig{Host: "127.0.0.1", Port: port, User: "postgres", Name: "zumi"})
+		require.NoError(t, err)
+
+		r := &replica{name: "hanging", pool: newLazyPool(t, poolCfg)}
+		r.healthy.Store(true)
+		d.replicas = append(d.replicas, r)
+	}
+
+	start := time.Now()
+
+	d.healthCheckReplicas(context.Background())
+
+	// every replica is pinged with its own timeout, instead of sharing one
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+
+	for _, r := range d.replicas {
+		assert.False(t, r.healthy.Load())
+	}
+}
@@ -0,0 +1,188 @@
+// Package jobs provides a job queue stored in Postgres, for background jobs without a message broker.
+// Jobs are enqueued in the transaction of the change they belong to, so that they only run if it is committed,
+// and workers claim them with `FOR UPDATE SKIP LOCKED`, so that every job is processed by one worker at a time.
+//
+// Example usage:
+//
+//	err := jobs.Migrate(ctx, db)
+//
+//	err = db.WithTX(ctx, func(tx database.DBTX) error {
+//	    _, err := jobs.Enqueue(ctx, tx, "send_welcome_email", Email{To: user.Email}, jobs.EnqueueOptions{})
+//	    return err
+//	})
+//
+//	worker, err := jobs.NewWorker(db, jobs.WorkerConfig{
+//	    Handlers: map[string]jobs.Handler{
+//	        "send_welcome_email": func(ctx context.Context, job jobs.Job) error {
+//	            var email Email
+//	            if err := job.Decode(&email); err != nil {
+//	                return err
+//	            }
+//
+//	            return mailer.Send(ctx, email)
+//	        },
+//	    },
+//	})
+//
+//	go worker.Run(ctx)
+package jobs
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/SeaRoll/zumi/database"
+	"github.com/SeaRoll/zumi/database/migrate"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Table is the table of the jobs, created by Migrate.
+const Table = "zumi_jobs"
+
+// MigrationTable is the table of the applied migration versions of the jobs, separate from those of the service.
+const MigrationTable = "zumi_jobs_db_version"
+
+// NotifyChannel is the channel workers are notified on when a job is enqueued, see database.Notify.
+const NotifyChannel = "zumi_jobs"
+
+// DefaultMaxAttempts is the number of attempts of a job which has none.
+const DefaultMaxAttempts = 5
+
+// Migrations are the goose migrations of the jobs table.
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+var (
+	// ErrDuplicateJob is returned by Enqueue when a pending or running job has the same unique key.
+	ErrDuplicateJob = errors.New("job with the same unique key exists")
+	// ErrNotPool is returned by Migrate when the database has no connection pool, e.g: a fake database.
+	ErrNotPool = errors.New("database has no connection pool")
+)
+
+// State is the state of a job.
+type State string
+
+const (
+	StatePending   State = "pending"   // The job waits to run at its run-at time
+	StateRunning   State = "running"   // A worker claimed the job and is running it
+	StateCompleted State = "completed" // The job succeeded
+	StateFailed    State = "failed"    // The job failed on its last attempt
+)
+
+// Job is a claimed job, which is handed to the handler of its kind.
+type Job struct {
+	ID          int64           `db:"id"`
+	Kind        string          `db:"kind"`         // The kind of the job, which selects its handler
+	Payload     json.RawMessage `db:"payload"`      // The JSON payload, see Decode
+	Priority    int             `db:"priority"`     // Jobs with a higher priority are claimed first
+	UniqueKey   *string         `db:"unique_key"`   // The unique key of the job, nil if it has none
+	RunAt       time.Time       `db:"run_at"`       // When the job became due
+	Attempt     int             `db:"attempts"`     // The number of the attempt, starting at 1
+	MaxAttempts int             `db:"max_attempts"` // The number of attempts before the job fails
+}
+
+// Decode unmarshals the JSON payload of the job into v.
+func (j Job) Decode(v any) error {
+	err := json.Unmarshal(j.Payload, v)
+	if err != nil {
+		return fmt.Errorf("failed to decode payload of job %d: %w", j.ID, err)
+	}
+
+	return nil
+}
+
+// EnqueueOptions are the options of an enqueued job.
+type EnqueueOptions struct {
+	Priority    int       // Jobs with a higher priority are claimed first, defaults to 0
+	RunAt       time.Time // When the job should run, defaults to now
+	MaxAttempts int       // The number of attempts before the job fails, defaults to DefaultMaxAttempts
+	// A key which no other pending or running job may have, e.g: "reindex:42",
+	// so that a job is not enqueued twice. The key is free again once the job is finished.
+	UniqueKey string
+}
+
+// Enqueue adds a job of the kind with the payload marshaled as JSON, and returns the id of the job.
+// Enqueue it in the transaction of the change it belongs to, so that the job is only visible to workers,
+// which are notified of it, once the transaction is committed.
+// It returns ErrDuplicateJob if a pending or running job has the same unique key.
+func Enqueue(ctx context.Context, tx database.DBTX, kind string, payload any, opts EnqueueOptions) (int64, error) {
+	if kind == "" {
+		return 0, errors.New("job kind cannot be empty")
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal payload of job %s: %w", kind, err)
+	}
+
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	var runAt *time.Time
+	if !opts.RunAt.IsZero() {
+		runAt = &opts.RunAt
+	}
+
+	var uniqueKey *string
+	if opts.UniqueKey != "" {
+		uniqueKey = &opts.UniqueKey
+	}
+
+	rows, err := tx.Query(ctx, `INSERT INTO `+Table+` (kind, payload, priority, run_at, max_attempts, unique_key)
+VALUES ($1, $2, $3, COALESCE($4, now()), $5, $6)
+ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL AND state IN ('pending', 'running') DO NOTHING
+RETURNING id`, kind, data, opts.Priority, runAt, maxAttempts, uniqueKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue job %s: %w", kind, err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue job %s: %w", kind, err)
+	}
+
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("failed to enqueue job %s with unique key %s: %w", kind, opts.UniqueKey, ErrDuplicateJob)
+	}
+
+	err = database.Notify(ctx, tx, NotifyChannel, kind)
+	if err != nil {
+		return 0, err
+	}
+
+	return ids[0], nil
+}
+
+// Migrate creates or migrates the jobs table of the database, recording its versions in MigrationTable.
+// It runs on the pool of the database, outside of any transaction carried by the context.
+func Migrate(ctx context.Context, db database.Database) error {
+	pool, ok := db.Conn(context.Background()).(*pgxpool.Pool)
+	if !ok {
+		return ErrNotPool
+	}
+
+	migrator, err := migrate.New(stdlib.OpenDBFromPool(pool), Migrations, config.DatabaseMigrationConfig{
+		Dir:   "migrations",
+		Table: MigrationTable,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create jobs migrator: %w", err)
+	}
+
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate jobs table: %w", err)
+	}
+
+	return nil
+}
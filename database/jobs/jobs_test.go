@@ -0,0 +1,360 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/SeaRoll/zumi/database"
+	"github.com/SeaRoll/zumi/database/databasemem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const cfgYaml = `
+database:
+  enabled: true
+  host: localhost
+  port: 5432
+  user: postgres
+  password: mysecretpassword
+  name: foodie
+`
+
+func setupDatabase(ctx context.Context, t *testing.T) database.Database {
+	t.Helper()
+
+	cfg, err := config.FromYAML[config.BaseConfig](cfgYaml)
+	require.NoError(t, err)
+
+	db, err := database.NewDatabase(ctx, cfg.Database, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.Disconnect()
+	})
+
+	require.NoError(t, Migrate(ctx, db))
+
+	return db
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, Backoff(1))
+	assert.Equal(t, 2*time.Second, Backoff(2))
+	assert.Equal(t, 8*time.Second, Backoff(4))
+	assert.Equal(t, DefaultMaxBackoff, Backoff(100))
+}
+
+func TestNewWorker(t *testing.T) {
+	db := databasemem.New()
+
+	_, err := NewWorker(db, WorkerConfig{})
+	assert.Error(t, err)
+
+	// running jobs would be recovered between their heartbeats, and run twice
+	_, err = NewWorker(db, WorkerConfig{
+		Handlers:          map[string]Handler{"a": func(context.Context, Job) error { return nil }},
+		HeartbeatInterval: 2 * time.Minute,
+	})
+	assert.EqualError(t, err, "stuck timeout 1m0s must be more than twice the heartbeat interval 2m0s")
+
+	worker, err := NewWorker(db, WorkerConfig{Handlers: map[string]Handler{
+		"b": func(context.Context, Job) error { return nil },
+		"a": func(context.Context, Job) error { panic("boom") },
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "b"}, worker.kinds)
+	assert.Equal(t, DefaultConcurrency, worker.config.Concurrency)
+	assert.Equal(t, DefaultPollInterval, worker.config.PollInterval)
+	assert.Equal(t, DefaultHeartbeatInterval, worker.config.HeartbeatInterval)
+	assert.Equal(t, DefaultStuckTimeout, worker.config.StuckTimeout)
+	assert.NotEmpty(t, worker.config.ID)
+
+	assert.EqualError(t, worker.handle(context.Background(), Job{Kind: "a"}), "job panicked: boom")
+
+	_, err = worker.RunNext(context.Background())
+	assert.ErrorIs(t, err, databasemem.ErrNotSupported)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.NoError(t, worker.Run(ctx))
+}
+
+// missingTableDatabase is a fake database whose queries fail as the jobs table does not exist.
+type missingTableDatabase struct {
+	*databasemem.Database
+}
+
+func (missingTableDatabase) Conn(context.Context) database.DBTX {
+	return missingTableConn{}
+}
+
+type missingTableConn struct {
+	database.DBTX
+}
+
+func (missingTableConn) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, &pgconn.PgError{Code: "42P01", Message: `relation "zumi_jobs" does not exist`}
+}
+
+func TestWorkerStopsOnUnrecoverableErrors(t *testing.T) {
+	worker, err := NewWorker(missingTableDatabase{databasemem.New()}, WorkerConfig{Handlers: map[string]Handler{
+		"a": func(context.Context, Job) error { return nil },
+	}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var pgErr *pgconn.PgError
+	assert.ErrorAs(t, worker.Run(ctx), &pgErr)
+	assert.NoError(t, ctx.Err(), "the worker stops without waiting for the context")
+}
+
+func TestEnqueueValidation(t *testing.T) {
+	ctx := context.Background()
+	conn := databasemem.New().Conn(ctx)
+
+	_, err := Enqueue(ctx, conn, "", nil, EnqueueOptions{})
+	assert.EqualError(t, err, "job kind cannot be empty")
+
+	_, err = Enqueue(ctx, conn, "kind", make(chan int), EnqueueOptions{})
+	assert.ErrorContains(t, err, "failed to marshal payload")
+
+	assert.ErrorIs(t, Migrate(ctx, databasemem.New()), ErrNotPool)
+}
+
+func TestJobs(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	// every test uses its own kind, so that jobs of other tests are not claimed
+	newKind := func() string { return "test_" + uuid.NewString() }
+
+	type payload struct {
+		Value string `json:"value"`
+	}
+
+	t.Run("run in order of priority", func(t *testing.T) {
+		kind := newKind()
+		ran := []string{}
+
+		err := db.WithTX(ctx, func(tx database.DBTX) error {
+			for _, job := range []struct {
+				value    string
+				priority int
+			}{{"low", 0}, {"high", 10}, {"medium", 5}} {
+				_, err := Enqueue(ctx, tx, kind, payload{Value: job.value}, EnqueueOptions{Priority: job.priority})
+				require.NoError(t, err)
+			}
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		worker, err := NewWorker(db, WorkerConfig{Handlers: map[string]Handler{kind: func(_ context.Context, job Job) error {
+			var p payload
+			require.NoError(t, job.Decode(&p))
+
+			ran = append(ran, p.Value)
+
+			return nil
+		}}})
+		require.NoError(t, err)
+
+		for range 3 {
+			ok, err := worker.RunNext(ctx)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		}
+
+		ok, err := worker.RunNext(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.Equal(t, []string{"high", "medium", "low"}, ran)
+	})
+
+	t.Run("rolled back jobs do not run", func(t *testing.T) {
+		kind := newKind()
+
+		err := db.WithTX(ctx, func(tx database.DBTX) error {
+			_, err := Enqueue(ctx, tx, kind, nil, EnqueueOptions{})
+			require.NoError(t, err)
+
+			return errors.New("rollback")
+		})
+		require.Error(t, err)
+
+		worker, err := NewWorker(db, WorkerConfig{Handlers: map[string]Handler{kind: func(context.Context, Job) error {
+			t.Error("rolled back job should not run")
+			return nil
+		}}})
+		require.NoError(t, err)
+
+		ok, err := worker.RunNext(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("scheduled jobs run at their time", func(t *testing.T) {
+		kind := newKind()
+
+		_, err := Enqueue(ctx, db.Conn(ctx), kind, nil, EnqueueOptions{RunAt: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+
+		worker, err := NewWorker(db, WorkerConfig{Handlers: map[string]Handler{kind: func(context.Context, Job) error {
+			return nil
+		}}})
+		require.NoError(t, err)
+
+		ok, err := worker.RunNext(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("failed jobs are retried until their last attempt", func(t *testing.T) {
+		kind := newKind()
+
+		id, err := Enqueue(ctx, db.Conn(ctx), kind, nil, EnqueueOptions{MaxAttempts: 2})
+		require.NoError(t, err)
+
+		attempts := []int{}
+
+		worker, err := NewWorker(db, WorkerConfig{
+			Handlers: map[string]Handler{kind: func(_ context.Context, job Job) error {
+				attempts = append(attempts, job.Attempt)
+				return errors.New("failed")
+			}},
+			Backoff: func(int) time.Duration { return 0 },
+		})
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err := worker.RunNext(ctx)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, []int{1, 2}, attempts)
+		assert.Equal(t, StateFailed, jobState(ctx, t, db, id))
+	})
+
+	t.Run("unique keys", func(t *testing.T) {
+		kind := newKind()
+		key := uuid.NewString()
+
+		_, err := Enqueue(ctx, db.Conn(ctx), kind, nil, EnqueueOptions{UniqueKey: key})
+		require.NoError(t, err)
+
+		_, err = Enqueue(ctx, db.Conn(ctx), kind, nil, EnqueueOptions{UniqueKey: key})
+		require.ErrorIs(t, err, ErrDuplicateJob)
+
+		worker, err := NewWorker(db, WorkerConfig{Handlers: map[string]Handler{kind: func(context.Context, Job) error {
+			return nil
+		}}})
+		require.NoError(t, err)
+
+		_, err = worker.RunNext(ctx)
+		require.NoError(t, err)
+
+		// the key is free once the job is completed
+		_, err = Enqueue(ctx, db.Conn(ctx), kind, nil, EnqueueOptions{UniqueKey: key})
+		require.NoError(t, err)
+	})
+
+	t.Run("stuck jobs are recovered", func(t *testing.T) {
+		kind := newKind()
+
+		id, err := Enqueue(ctx, db.Conn(ctx), kind, nil, EnqueueOptions{})
+		require.NoError(t, err)
+
+		// a worker which crashed after claiming the job
+		err = database.ExecQuery(ctx, db.Conn(ctx), `UPDATE `+Table+`
+SET state = 'running', attempts = 1, locked_by = 'crashed', heartbeat_at = now() - interval '1 hour'
+WHERE id = $1`, id)
+		require.NoError(t, err)
+
+		ran := false
+
+		worker, err := NewWorker(db, WorkerConfig{Handlers: map[string]Handler{kind: func(_ context.Context, job Job) error {
+			ran = true
+
+			assert.Equal(t, 2, job.Attempt)
+
+			return nil
+		}}})
+		require.NoError(t, err)
+
+		recovered, err := worker.RecoverStuck(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, recovered, int64(1))
+
+		_, err = worker.RunNext(ctx)
+		require.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, StateCompleted, jobState(ctx, t, db, id))
+	})
+
+	t.Run("workers are notified of enqueued jobs", func(t *testing.T) {
+		kind := newKind()
+		done := make(chan int64, 1)
+
+		worker, err := NewWorker(db, WorkerConfig{
+			Handlers: map[string]Handler{kind: func(_ context.Context, job Job) error {
+				done <- job.ID
+				return nil
+			}},
+			Concurrency:  2,
+			PollInterval: time.Hour,
+		})
+		require.NoError(t, err)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		stopped := make(chan error)
+
+		go func() {
+			stopped <- worker.Run(runCtx)
+		}()
+
+		// enqueue until the worker listens, as the first notifications may be sent before
+		var id int64
+
+		require.Eventually(t, func() bool {
+			if id == 0 {
+				id, err = Enqueue(ctx, db.Conn(ctx), kind, nil, EnqueueOptions{UniqueKey: kind})
+				require.NoError(t, err)
+			} else {
+				require.NoError(t, database.Notify(ctx, db.Conn(ctx), NotifyChannel, kind))
+			}
+
+			select {
+			case ran := <-done:
+				return ran == id
+			case <-time.After(100 * time.Millisecond):
+				return false
+			}
+		}, 10*time.Second, time.Millisecond)
+
+		cancel()
+		assert.NoError(t, <-stopped)
+	})
+}
+
+// jobState returns the state of the job.
+func jobState(ctx context.Context, t *testing.T, db database.Database, id int64) State {
+	t.Helper()
+
+	var state State
+
+	require.NoError(t, db.Conn(ctx).QueryRow(ctx, "SELECT state FROM "+Table+" WHERE id = $1", id).Scan(&state))
+
+	return state
+}
@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS zumi_jobs (
+  id BIGSERIAL PRIMARY KEY,
+  kind TEXT NOT NULL,
+  payload JSONB NOT NULL DEFAULT '{}',
+  priority INT NOT NULL DEFAULT 0,
+  unique_key TEXT,
+  state TEXT NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  max_attempts INT NOT NULL DEFAULT 5,
+  run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_by TEXT,
+  heartbeat_at TIMESTAMPTZ,
+  last_error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+
+-- a unique key is unique among the jobs which are not finished
+CREATE UNIQUE INDEX IF NOT EXISTS zumi_jobs_unique_key ON zumi_jobs (unique_key)
+  WHERE unique_key IS NOT NULL AND state IN ('pending', 'running');
+
+CREATE INDEX IF NOT EXISTS zumi_jobs_pending ON zumi_jobs (priority DESC, run_at, id) WHERE state = 'pending';
+
+CREATE INDEX IF NOT EXISTS zumi_jobs_running ON zumi_jobs (heartbeat_at) WHERE state = 'running';
+
+-- +goose Down
+DROP TABLE zumi_jobs;
@@ -0,0 +1,374 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SeaRoll/zumi/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Defaults of the worker configuration.
+const (
+	DefaultConcurrency       = 1                // The number of jobs a worker runs at the same time
+	DefaultPollInterval      = time.Second      // How often a worker looks for due jobs without being notified
+	DefaultHeartbeatInterval = 10 * time.Second // How often a worker records that its running jobs are alive
+	DefaultStuckTimeout      = time.Minute      // How long a running job may go without heartbeat before it is recovered
+	DefaultMaxBackoff        = time.Hour        // The maximum delay before a failed job is retried
+)
+
+// Handler runs a job. An error fails the attempt, and the job is retried with backoff until its last attempt.
+type Handler func(ctx context.Context, job Job) error
+
+// WorkerConfig is the configuration of a worker.
+type WorkerConfig struct {
+	Handlers          map[string]Handler // The handlers of the job kinds the worker runs
+	Concurrency       int                // The number of jobs run at the same time, defaults to DefaultConcurrency
+	PollInterval      time.Duration      // How often due jobs are looked for, defaults to DefaultPollInterval
+	HeartbeatInterval time.Duration      // How often running jobs are kept alive, defaults to DefaultHeartbeatInterval
+	// How long a running job may go without heartbeat before it is recovered, e.g: after its worker crashed,
+	// defaults to DefaultStuckTimeout. It must be more than two heartbeat intervals, so that a job which is still
+	// running is not recovered and run twice when a heartbeat is late.
+	StuckTimeout time.Duration
+	// The delay before the next attempt after a failed attempt, defaults to Backoff.
+	Backoff func(attempt int) time.Duration
+	// The identity of the worker recorded on the jobs it claims, defaults to the hostname and a random suffix.
+	ID string
+}
+
+// Backoff doubles the delay before the next attempt from a second for every failed attempt, up to DefaultMaxBackoff.
+func Backoff(attempt int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempt && delay < DefaultMaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, DefaultMaxBackoff)
+}
+
+// Worker claims and runs the due jobs of the kinds it has handlers for.
+type Worker struct {
+	db     database.Database
+	config WorkerConfig
+	kinds  []string
+
+	mu      sync.Mutex
+	running map[int64]struct{} // the ids of the running jobs, which receive heartbeats
+}
+
+// NewWorker creates a worker of the database with the configuration.
+func NewWorker(db database.Database, cfg WorkerConfig) (*Worker, error) {
+	if len(cfg.Handlers) == 0 {
+		return nil, errors.New("worker needs at least one handler")
+	}
+
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+
+	if cfg.StuckTimeout <= 0 {
+		cfg.StuckTimeout = DefaultStuckTimeout
+	}
+
+	if cfg.StuckTimeout <= 2*cfg.HeartbeatInterval {
+		return nil, fmt.Errorf("stuck timeout %s must be more than twice the heartbeat interval %s", cfg.StuckTimeout, cfg.HeartbeatInterval)
+	}
+
+	if cfg.Backoff == nil {
+		cfg.Backoff = Backoff
+	}
+
+	if cfg.ID == "" {
+		hostname, _ := os.Hostname()
+		cfg.ID = hostname + "-" + uuid.NewString()[:8]
+	}
+
+	return &Worker{
+		db:      db,
+		config:  cfg,
+		kinds:   slices.Sorted(maps.Keys(cfg.Handlers)),
+		running: map[int64]struct{}{},
+	}, nil
+}
+
+// Run claims and runs jobs until the context is done, then waits for the running jobs to finish.
+// Workers are woken up when a job is enqueued, and look for due jobs every poll interval otherwise,
+// e.g: for scheduled and retried jobs. Running jobs whose worker stopped sending heartbeats are recovered,
+// and retried unless it was their last attempt.
+// Errors of claiming jobs are logged and retried, except for those which retrying cannot fix, e.g: a missing jobs table,
+// which stop the worker and are returned once the running jobs finished. It returns nil when the context is done.
+// OBS: This function is blocking, so make sure to run it in a goroutine.
+func (w *Worker) Run(parent context.Context) error {
+	ctx, stop := context.WithCancelCause(parent)
+	defer stop(nil)
+
+	wake := make(chan struct{}, w.config.Concurrency)
+
+	var wg sync.WaitGroup
+
+	wg.Add(2 + w.config.Concurrency)
+
+	go func() {
+		defer wg.Done()
+
+		err := w.db.Listen(ctx, NotifyChannel, func(_ context.Context, n database.Notification) error {
+			if slices.Contains(w.kinds, n.Payload) {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			slog.Error("Failed to listen for enqueued jobs", "worker", w.config.ID, "error", err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		w.runHeartbeats(ctx)
+	}()
+
+	for range w.config.Concurrency {
+		go func() {
+			defer wg.Done()
+
+			w.runJobs(ctx, wake, stop)
+		}()
+	}
+
+	slog.Info("Worker started", "worker", w.config.ID, "kinds", w.kinds, "concurrency", w.config.Concurrency)
+
+	wg.Wait()
+
+	slog.Info("Worker stopped", "worker", w.config.ID)
+
+	if parent.Err() == nil {
+		return fmt.Errorf("worker %s stopped: %w", w.config.ID, context.Cause(ctx))
+	}
+
+	return nil
+}
+
+// runJobs runs due jobs one after the other, and waits for a notification or the poll interval when there is none.
+// It stops the worker with an error which retrying cannot fix, see isUnrecoverable.
+func (w *Worker) runJobs(ctx context.Context, wake <-chan struct{}, stop context.CancelCauseFunc) {
+	for {
+		ran, err := w.RunNext(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to run job", "worker", w.config.ID, "error", err)
+
+			if isUnrecoverable(err) {
+				stop(err)
+				return
+			}
+		}
+
+		if ran && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(w.config.PollInterval):
+		}
+	}
+}
+
+// isUnrecoverable returns whether the error is caused by a statement which fails every time it is executed,
+// e.g: as the jobs table does not exist or access to it is denied (SQLSTATE class 42).
+func isUnrecoverable(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "42")
+}
+
+// runHeartbeats keeps the running jobs alive and recovers stuck jobs every heartbeat interval.
+func (w *Worker) runHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(w.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := w.heartbeat(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to send heartbeat of jobs", "worker", w.config.ID, "error", err)
+		}
+
+		recovered, err := w.RecoverStuck(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to recover stuck jobs", "worker", w.config.ID, "error", err)
+		}
+
+		if recovered > 0 {
+			slog.Warn("Recovered stuck jobs", "worker", w.config.ID, "count", recovered)
+		}
+	}
+}
+
+// RunNext claims the due job of the highest priority and runs it, and returns whether there was a job.
+// The error is that of claiming the job or of recording its result, a failed attempt is not an error.
+func (w *Worker) RunNext(ctx context.Context) (bool, error) {
+	job, ok, err := w.claim(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	w.track(job.ID, true)
+	defer w.track(job.ID, false)
+
+	slog.Info("Running job", "worker", w.config.ID, "job", job.ID, "kind", job.Kind, "attempt", job.Attempt)
+
+	handlerErr := w.handle(ctx, job)
+
+	// the result is recorded even if the worker is stopping
+	ctx = context.WithoutCancel(ctx)
+
+	if handlerErr == nil {
+		return true, w.complete(ctx, job)
+	}
+
+	slog.Error("Job failed", "worker", w.config.ID, "job", job.ID, "kind", job.Kind, "attempt", job.Attempt,
+		"error", handlerErr)
+
+	return true, w.fail(ctx, job, handlerErr)
+}
+
+// claim claims the due job of the highest priority of the kinds of the worker,
+// skipping the jobs locked by other workers claiming at the same time.
+func (w *Worker) claim(ctx context.Context) (Job, bool, error) {
+	job, err := database.SelectRow[Job](ctx, w.db.Conn(ctx), `UPDATE `+Table+`
+SET state = 'running', attempts = attempts + 1, locked_by = $1, heartbeat_at = now()
+WHERE id = (
+	SELECT id FROM `+Table+`
+	WHERE state = 'pending' AND run_at <= now() AND kind = ANY($2)
+	ORDER BY priority DESC, run_at, id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, kind, payload, priority, unique_key, run_at, attempts, max_attempts`, w.config.ID, w.kinds)
+	if errors.Is(err, database.ErrNoRows) {
+		return job, false, nil
+	}
+
+	if err != nil {
+		return job, false, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return job, true, nil
+}
+
+// handle runs the handler of the job, turning a panic into an error.
+func (w *Worker) handle(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return w.config.Handlers[job.Kind](ctx, job)
+}
+
+// complete records that the job succeeded, unless it was recovered from the worker in the meantime.
+func (w *Worker) complete(ctx context.Context, job Job) error {
+	err := database.ExecQuery(ctx, w.db.Conn(ctx), `UPDATE `+Table+`
+SET state = 'completed', completed_at = now(), locked_by = NULL, heartbeat_at = NULL, last_error = NULL
+WHERE id = $1 AND state = 'running' AND locked_by = $2`, job.ID, w.config.ID)
+	if err != nil {
+		return fmt.Errorf("failed to complete job %d: %w", job.ID, err)
+	}
+
+	return nil
+}
+
+// fail records the failed attempt, and schedules the next attempt with backoff unless it was the last attempt.
+func (w *Worker) fail(ctx context.Context, job Job, handlerErr error) error {
+	retryAt := time.Now().Add(w.config.Backoff(job.Attempt))
+
+	err := database.ExecQuery(ctx, w.db.Conn(ctx), `UPDATE `+Table+`
+SET state = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'pending' END,
+	run_at = CASE WHEN attempts >= max_attempts THEN run_at ELSE $3 END,
+	completed_at = CASE WHEN attempts >= max_attempts THEN now() END,
+	locked_by = NULL, heartbeat_at = NULL, last_error = $4
+WHERE id = $1 AND state = 'running' AND locked_by = $2`, job.ID, w.config.ID, retryAt, handlerErr.Error())
+	if err != nil {
+		return fmt.Errorf("failed to record failure of job %d: %w", job.ID, err)
+	}
+
+	return nil
+}
+
+// heartbeat records that the running jobs of the worker are alive.
+func (w *Worker) heartbeat(ctx context.Context) error {
+	w.mu.Lock()
+	ids := slices.Collect(maps.Keys(w.running))
+	w.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := database.ExecQuery(ctx, w.db.Conn(ctx), `UPDATE `+Table+`
+SET heartbeat_at = now()
+WHERE id = ANY($1) AND state = 'running' AND locked_by = $2`, ids, w.config.ID)
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+
+	return nil
+}
+
+// RecoverStuck returns the running jobs without heartbeat for longer than the stuck timeout to the pending jobs,
+// or fails them if it was their last attempt, and returns the number of recovered jobs.
+// Every worker recovers stuck jobs periodically, it is exported to recover them on demand.
+func (w *Worker) RecoverStuck(ctx context.Context) (int64, error) {
+	tag, err := w.db.Conn(ctx).Exec(ctx, `UPDATE `+Table+`
+SET state = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'pending' END,
+	completed_at = CASE WHEN attempts >= max_attempts THEN now() END,
+	locked_by = NULL, heartbeat_at = NULL, last_error = 'heartbeat timed out'
+WHERE state = 'running' AND heartbeat_at < now() - make_interval(secs => $1)`, w.config.StuckTimeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to recover stuck jobs: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// track adds or removes a running job of the worker.
+func (w *Worker) track(id int64, running bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if running {
+		w.running[id] = struct{}{}
+	} else {
+		delete(w.running, id)
+	}
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Notification is a notification received on a channel, see Listen and Notify.
+type Notification struct {
+	Channel string // The channel the notification was sent on
+	Payload string // The payload of the notification, empty if it has none
+	PID     uint32 // The process ID of the session which sent the notification
+}
+
+// Listen listens to a channel on a dedicated connection and calls the handler for each notification received.
+// It blocks until the context is done or the database is torn down, so run it in a goroutine.
+// The connection is reconnected with backoff when it is lost and the channel is listened to again,
+// notifications sent while reconnecting are lost, so the handler should not rely on receiving every notification,
+// e.g: invalidating a whole cache instead of an entry.
+//
+// Example usage:
+//
+//	go db.Listen(ctx, "books_changed", func(ctx context.Context, n database.Notification) error {
+//	    return cache.Invalidate(ctx, n.Payload)
+//	})
+func (d *dbo) Listen(ctx context.Context, channel string, handler func(ctx context.Context, n Notification) error) error {
+	if channel == "" {
+		return errors.New("channel cannot be empty")
+	}
+
+	ctx, done := d.startSession(ctx)
+	defer done()
+
+	failures := 0
+
+	for {
+		subscribed, err := d.listen(ctx, channel, handler)
+		if ctx.Err() != nil {
+			slog.Info("Stopped listening to channel", "channel", channel)
+			return nil
+		}
+
+		if subscribed {
+			failures = 0
+		}
+
+		failures++
+
+		slog.Error("Lost connection listening to channel, reconnecting", "channel", channel, "attempt", failures, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.reconnectPolicy.backoff(failures)):
+		}
+	}
+}
+
+// listen listens to the channel on a new connection until the connection fails or the context is done,
+// and returns whether it listened to the channel.
+func (d *dbo) listen(
+	ctx context.Context,
+	channel string,
+	handler func(ctx context.Context, n Notification) error,
+) (bool, error) {
+	conn, closeConn, err := d.connectSession(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer closeConn()
+
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+	if err != nil {
+		return false, fmt.Errorf("failed to listen to channel %s: %w", channel, err)
+	}
+
+	slog.Info("Listening to channel", "channel", channel)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, fmt.Errorf("failed to wait for notification: %w", err)
+		}
+
+		err = handler(ctx, Notification{
+			Channel: notification.Channel,
+			Payload: notification.Payload,
+			PID:     notification.PID,
+		})
+		if err != nil {
+			slog.Error("Error handling notification", "channel", channel, "payload", notification.Payload, "error", err)
+		}
+	}
+}
+
+// startSession returns a context of a session on a dedicated connection, which is done when the context is done
+// or the database is torn down, and a function ending the session. Disconnect waits for the sessions to end.
+func (d *dbo) startSession(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := func() bool { return false }
+
+	if d.teardown != nil {
+		stop = context.AfterFunc(d.teardown, cancel)
+	}
+
+	d.sessions.Add(1)
+
+	return ctx, func() {
+		stop()
+		cancel()
+		d.sessions.Done()
+	}
+}
+
+// connectSession connects a dedicated connection outside the pool, and returns a function closing it.
+func (d *dbo) connectSession(ctx context.Context) (*pgx.Conn, func(), error) {
+	conn, err := pgx.ConnectConfig(ctx, d.poolConfig.ConnConfig.Copy())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return conn, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = conn.Close(ctx)
+	}, nil
+}
+
+// Notify sends a notification with the payload on the channel, see Listen.
+// In a transaction, the notification is sent when the transaction is committed, and not at all if it is rolled back,
+// and identical notifications of a transaction are sent once.
+//
+// Example usage:
+//
+//	err := database.Notify(ctx, db.Conn(ctx), "books_changed", book.ID.String())
+func Notify(ctx context.Context, dbtx DBTX, channel string, payload string) error {
+	if channel == "" {
+		return errors.New("channel cannot be empty")
+	}
+
+	_, err := dbtx.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	if err != nil {
+		return fmt.Errorf("failed to notify channel %s: %w", channel, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenStops(t *testing.T) {
+	handler := func(context.Context, Notification) error { return nil }
+
+	t.Run("empty channel", func(t *testing.T) {
+		assert.EqualError(t, unreachableDatabase(t).Listen(context.Background(), "", handler), "channel cannot be empty")
+	})
+
+	t.Run("context done while reconnecting", func(t *testing.T) {
+		d := unreachableDatabase(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		assert.NoError(t, d.Listen(ctx, "books", handler))
+	})
+
+	t.Run("teardown while reconnecting", func(t *testing.T) {
+		d := unreachableDatabase(t)
+		d.runReconnect()
+
+		done := make(chan error)
+
+		go func() {
+			done <- d.Listen(context.Background(), "books", handler)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		d.Disconnect()
+
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("listen should stop when the database is torn down")
+		}
+	})
+}
+
+func TestListenNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := setupDatabase(ctx, t)
+	channel := "test_" + uuid.NewString()
+
+	received := make(chan Notification, 10)
+
+	go func() {
+		_ = db.Listen(ctx, channel, func(_ context.Context, n Notification) error {
+			received <- n
+			return nil
+		})
+	}()
+
+	// notify until the listener is listening, as Listen does not signal it
+	require.Eventually(t, func() bool {
+		require.NoError(t, Notify(ctx, db.Conn(ctx), channel, "ready"))
+
+		select {
+		case <-received:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+
+	for len(received) > 0 {
+		<-received
+	}
+
+	err := db.WithTX(ctx, func(tx DBTX) error {
+		require.NoError(t, Notify(ctx, tx, channel, "rolled back"))
+		return errors.New("rollback")
+	})
+	require.Error(t, err)
+
+	err = db.WithTX(ctx, func(tx DBTX) error {
+		require.NoError(t, Notify(ctx, tx, channel, "committed"))
+
+		select {
+		case n := <-received:
+			t.Errorf("notification %q received before commit", n.Payload)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	select {
+	case n := <-received:
+		assert.Equal(t, channel, n.Channel)
+		assert.Equal(t, "committed", n.Payload)
+		assert.NotZero(t, n.PID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not received after commit")
+	}
+}
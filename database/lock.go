@@ -0,0 +1,300 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultLeaderInterval is how often a leader election tries to acquire the lock, and checks the lock while it is held.
+const DefaultLeaderInterval = 5 * time.Second
+
+var (
+	// ErrLockNotAcquired is returned by WithAdvisoryLock with Try when the lock is held by another session.
+	ErrLockNotAcquired = errors.New("advisory lock is held by another session")
+	// ErrReadOnlyLock is returned by WithAdvisoryLock with Transaction when the context carries a read-only transaction,
+	// which may run on a replica, where an advisory lock does not exclude the sessions of the primary and other replicas.
+	ErrReadOnlyLock = errors.New("cannot acquire a transaction advisory lock in a read-only transaction")
+)
+
+// lockKey is the SQL of the 64-bit key of an advisory lock hashed from its name.
+const lockKey = "hashtextextended($1, 0)"
+
+// AdvisoryLockOptions configures WithAdvisoryLock.
+type AdvisoryLockOptions struct {
+	// Whether the lock is scoped to the transaction, and released when it commits or rolls back,
+	// instead of to the session, and released when the function returns.
+	Transaction bool
+	// Whether to fail with ErrLockNotAcquired when the lock is held, instead of waiting until it is released.
+	Try bool
+}
+
+// WithAdvisoryLock executes the function while holding the Postgres advisory lock of the key,
+// so that it is executed by one instance of a service at a time, e.g: a periodic cleanup.
+// It waits until the lock is released by other sessions, or the context is done,
+// unless Try is set, which fails with ErrLockNotAcquired instead.
+//
+// A session lock is held on a connection of the pool reserved for the lock,
+// and released when the function returns, independent of the transactions of the function.
+// A transaction lock is held by the transaction of the database carried by the context, or by a new transaction
+// on the primary carried by the context passed to the function, and released when that transaction ends.
+// It fails with ErrReadOnlyLock if the transaction of the context is read-only.
+//
+// Example usage:
+//
+//	err := db.WithAdvisoryLock(ctx, "cleanup", func(ctx context.Context) error {
+//	    return database.ExecQuery(ctx, db.Conn(ctx), "DELETE FROM sessions WHERE expires_at < now()")
+//	}, database.AdvisoryLockOptions{Try: true})
+//	if errors.Is(err, database.ErrLockNotAcquired) {
+//	    return nil // another instance is cleaning up
+//	}
+func (d *dbo) WithAdvisoryLock(ctx context.Context, key string, fn func(ctx context.Context) error, opts ...AdvisoryLockOptions) error {
+	if key == "" {
+		return errors.New("lock key cannot be empty")
+	}
+
+	var o AdvisoryLockOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.Transaction {
+		return d.withTransactionLock(ctx, key, fn, o.Try)
+	}
+
+	return d.withSessionLock(ctx, key, fn, o.Try)
+}
+
+// withTransactionLock executes the function in the transaction of the context, or a new transaction,
+// after acquiring the transaction advisory lock of the key.
+func (d *dbo) withTransactionLock(ctx context.Context, key string, fn func(ctx context.Context) error, try bool) error {
+	lock := func(ctx context.Context) error {
+		err := acquireLock(ctx, d.Conn(ctx), key, "pg_advisory_xact_lock", try)
+		if err != nil {
+			return err
+		}
+
+		return fn(ctx)
+	}
+
+	if ambient := d.ambientTx(ctx); ambient != nil {
+		if ambient.readOnly {
+			return ErrReadOnlyLock
+		}
+
+		return lock(ctx)
+	}
+
+	return d.Transactional(ctx, TxOptions{}, lock)
+}
+
+// withSessionLock executes the function after acquiring the session advisory lock of the key
+// on a connection of the pool, and releases the lock afterwards.
+func (d *dbo) withSessionLock(ctx context.Context, key string, fn func(ctx context.Context) error, try bool) error {
+	conn, err := d.pool.Load().Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection for lock %s: %w", key, err)
+	}
+	defer conn.Release()
+
+	err = acquireLock(ctx, conn, key, "pg_advisory_lock", try)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// the lock is released even if the context is done
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		_, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock("+lockKey+")", key)
+		if err != nil {
+			slog.Error("Failed to release advisory lock, closing its connection", "key", key, "error", err)
+
+			// closing the session releases its locks, and the pool discards the closed connection
+			_ = conn.Conn().Close(unlockCtx)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// acquireLock acquires the advisory lock of the key with the lock function, or its try variant.
+func acquireLock(ctx context.Context, dbtx DBTX, key string, function string, try bool) error {
+	if !try {
+		_, err := dbtx.Exec(ctx, "SELECT "+function+"("+lockKey+")", key)
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock %s: %w", key, err)
+		}
+
+		return nil
+	}
+
+	var acquired bool
+
+	err := dbtx.QueryRow(ctx, "SELECT "+tryFunction(function)+"("+lockKey+")", key).Scan(&acquired)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+
+	if !acquired {
+		return fmt.Errorf("failed to acquire lock %s: %w", key, ErrLockNotAcquired)
+	}
+
+	return nil
+}
+
+// tryFunction returns the try variant of an advisory lock function, e.g: pg_try_advisory_lock of pg_advisory_lock.
+func tryFunction(function string) string {
+	return "pg_try_" + function[len("pg_"):]
+}
+
+// LeaderElection configures RunLeaderElection.
+type LeaderElection struct {
+	Key string // The key of the advisory lock held by the leader, which is shared by the candidates
+	// How often the lock is tried while not leading, and checked while leading, defaults to DefaultLeaderInterval
+	Interval time.Duration
+	// Called in a goroutine when the lock is acquired, with a context which is done when leadership is lost.
+	// Leadership is kept until it is lost, or the context of RunLeaderElection is done, even if it returns.
+	OnElected func(ctx context.Context)
+	// Called when leadership is lost, after OnElected returned, optional
+	OnRevoked func()
+}
+
+// RunLeaderElection elects one leader among the instances of a service, which holds the session advisory lock
+// of the key on a dedicated connection. The other instances try to acquire the lock every interval,
+// and one of them is elected once the leader disconnects. Leadership is lost when the connection of the leader fails,
+// and the lock is acquired again after reconnecting with backoff, unless another instance acquired it meanwhile.
+// It blocks until the context is done or the database is torn down, so run it in a goroutine.
+//
+// The connection of the leader is checked every interval, so a leader may not notice that its session was terminated
+// until the next check, while another instance is elected already. Use a transaction lock of WithAdvisoryLock
+// for work which must never overlap.
+//
+// Example usage:
+//
+//	go db.RunLeaderElection(ctx, database.LeaderElection{
+//	    Key: "scheduler",
+//	    OnElected: func(ctx context.Context) {
+//	        scheduler.Run(ctx)
+//	    },
+//	})
+func (d *dbo) RunLeaderElection(ctx context.Context, election LeaderElection) error {
+	if election.Key == "" {
+		return errors.New("leader election key cannot be empty")
+	}
+
+	if election.OnElected == nil {
+		return errors.New("leader election needs OnElected")
+	}
+
+	if election.Interval <= 0 {
+		election.Interval = DefaultLeaderInterval
+	}
+
+	ctx, done := d.startSession(ctx)
+	defer done()
+
+	failures := 0
+
+	for {
+		connected, err := d.campaign(ctx, election)
+		if ctx.Err() != nil {
+			slog.Info("Stopped leader election", "key", election.Key)
+			return nil
+		}
+
+		if connected {
+			failures = 0
+		}
+
+		failures++
+
+		slog.Error("Lost connection of leader election, reconnecting", "key", election.Key, "attempt", failures, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.reconnectPolicy.backoff(failures)):
+		}
+	}
+}
+
+// campaign tries to acquire the lock of the election every interval on a new connection, and leads once it is acquired,
+// until the connection fails or the context is done. It returns whether it connected.
+func (d *dbo) campaign(ctx context.Context, election LeaderElection) (bool, error) {
+	conn, closeConn, err := d.connectSession(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer closeConn()
+
+	ticker := time.NewTicker(election.Interval)
+	defer ticker.Stop()
+
+	for {
+		var acquired bool
+
+		err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock("+lockKey+")", election.Key).Scan(&acquired)
+		if err != nil {
+			return true, fmt.Errorf("failed to acquire leader lock %s: %w", election.Key, err)
+		}
+
+		if acquired {
+			return true, lead(ctx, conn, election, ticker)
+		}
+
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead runs OnElected while the connection holding the lock of the election is alive and the context is not done,
+// then revokes the leadership.
+func lead(ctx context.Context, conn *pgx.Conn, election LeaderElection, ticker *time.Ticker) error {
+	slog.Info("Elected leader", "key", election.Key)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		election.OnElected(leaderCtx)
+	}()
+
+	defer func() {
+		cancel()
+		wg.Wait()
+
+		slog.Info("Revoked leader", "key", election.Key)
+
+		if election.OnRevoked != nil {
+			election.OnRevoked()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		err := conn.Ping(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check leader lock %s: %w", election.Key, err)
+		}
+	}
+}
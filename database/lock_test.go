@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryFunction(t *testing.T) {
+	assert.Equal(t, "pg_try_advisory_lock", tryFunction("pg_advisory_lock"))
+	assert.Equal(t, "pg_try_advisory_xact_lock", tryFunction("pg_advisory_xact_lock"))
+}
+
+func TestWithAdvisoryLockValidation(t *testing.T) {
+	ctx := context.Background()
+	d := unreachableDatabase(t)
+	fn := func(context.Context) error {
+		t.Error("lock of an unreachable database should not be acquired")
+		return nil
+	}
+
+	assert.EqualError(t, d.WithAdvisoryLock(ctx, "", fn), "lock key cannot be empty")
+
+	// the lock is acquired on the database of the method, not on a transaction of another database
+	assert.ErrorContains(t, d.WithAdvisoryLock(ctx, "key", fn), "failed to acquire connection for lock key")
+	assert.Error(t, d.WithAdvisoryLock(contextWithTX(ctx, &transaction{db: unreachableDatabase(t)}), "key", fn, AdvisoryLockOptions{Transaction: true}))
+
+	// a read-only transaction may run on a replica, where the lock would not exclude the primary
+	readOnly := contextWithTX(ctx, &transaction{db: d, readOnly: true})
+	assert.ErrorIs(t, d.WithAdvisoryLock(readOnly, "key", fn, AdvisoryLockOptions{Transaction: true}), ErrReadOnlyLock)
+}
+
+func TestRunLeaderElectionStops(t *testing.T) {
+	onElected := func(context.Context) { t.Error("unreachable database should not elect") }
+
+	t.Run("invalid election", func(t *testing.T) {
+		d := unreachableDatabase(t)
+
+		assert.EqualError(t, d.RunLeaderElection(context.Background(), LeaderElection{OnElected: onElected}),
+			"leader election key cannot be empty")
+		assert.EqualError(t, d.RunLeaderElection(context.Background(), LeaderElection{Key: "key"}),
+			"leader election needs OnElected")
+	})
+
+	t.Run("context done while reconnecting", func(t *testing.T) {
+		d := unreachableDatabase(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		assert.NoError(t, d.RunLeaderElection(ctx, LeaderElection{Key: "key", OnElected: onElected}))
+	})
+
+	t.Run("teardown while reconnecting", func(t *testing.T) {
+		d := unreachableDatabase(t)
+		d.runReconnect()
+
+		done := make(chan error)
+
+		go func() {
+			done <- d.RunLeaderElection(context.Background(), LeaderElection{Key: "key", OnElected: onElected})
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		d.Disconnect()
+
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("leader election should stop when the database is torn down")
+		}
+	})
+}
+
+func TestWithAdvisoryLock(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	t.Run("session lock excludes other sessions until released", func(t *testing.T) {
+		key := uuid.NewString()
+
+		err := db.WithAdvisoryLock(ctx, key, func(ctx context.Context) error {
+			err := db.WithAdvisoryLock(ctx, key, func(context.Context) error {
+				t.Error("held lock should not be acquired")
+				return nil
+			}, AdvisoryLockOptions{Try: true})
+			assert.ErrorIs(t, err, ErrLockNotAcquired)
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		ran := false
+
+		err = db.WithAdvisoryLock(ctx, key, func(context.Context) error {
+			ran = true
+			return nil
+		}, AdvisoryLockOptions{Try: true})
+		require.NoError(t, err)
+		assert.True(t, ran)
+	})
+
+	t.Run("blocking lock waits until released", func(t *testing.T) {
+		key := uuid.NewString()
+		locked := make(chan struct{})
+		release := make(chan struct{})
+		done := make(chan error)
+
+		go func() {
+			done <- db.WithAdvisoryLock(ctx, key, func(context.Context) error {
+				close(locked)
+				<-release
+
+				return nil
+			})
+		}()
+
+		<-locked
+
+		waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		err := db.WithAdvisoryLock(waitCtx, key, func(context.Context) error { return nil })
+		require.Error(t, err)
+
+		close(release)
+		require.NoError(t, <-done)
+
+		require.NoError(t, db.WithAdvisoryLock(ctx, key, func(context.Context) error { return nil }))
+	})
+
+	t.Run("session lock is released when the function fails", func(t *testing.T) {
+		key := uuid.NewString()
+
+		err := db.WithAdvisoryLock(ctx, key, func(context.Context) error { return errors.New("failed") })
+		require.EqualError(t, err, "failed")
+
+		require.NoError(t, db.WithAdvisoryLock(ctx, key, func(context.Context) error { return nil }, AdvisoryLockOptions{Try: true}))
+	})
+
+	t.Run("transaction lock is held until the transaction ends", func(t *testing.T) {
+		key := uuid.NewString()
+
+		err := db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+			err := db.WithAdvisoryLock(ctx, key, func(context.Context) error { return nil },
+				AdvisoryLockOptions{Transaction: true})
+			require.NoError(t, err)
+
+			// the lock outlives the function until the transaction commits
+			err = db.WithAdvisoryLock(context.Background(), key, func(context.Context) error { return nil },
+				AdvisoryLockOptions{Try: true})
+			assert.ErrorIs(t, err, ErrLockNotAcquired)
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		// without a transaction in the context, the function runs in a new transaction
+		err = db.WithAdvisoryLock(ctx, key, func(ctx context.Context) error {
+			_, ok := db.Conn(ctx).(*transaction)
+			assert.True(t, ok)
+
+			return nil
+		}, AdvisoryLockOptions{Transaction: true, Try: true})
+		require.NoError(t, err)
+	})
+}
+
+func TestRunLeaderElection(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+	key := uuid.NewString()
+
+	events := make(chan string, 10)
+	cancels := map[string]context.CancelFunc{}
+	done := make(chan error, 2)
+
+	for _, name := range []string{"a", "b"} {
+		electionCtx, cancel := context.WithCancel(ctx)
+		cancels[name] = cancel
+
+		go func() {
+			done <- db.RunLeaderElection(electionCtx, LeaderElection{
+				Key:       key,
+				Interval:  20 * time.Millisecond,
+				OnElected: func(context.Context) { events <- name + " elected" },
+				OnRevoked: func() { events <- name + " revoked" },
+			})
+		}()
+	}
+
+	var leader string
+
+	select {
+	case event := <-events:
+		leader = event[:1]
+		assert.Equal(t, leader+" elected", event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("a leader should be elected")
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("only one leader should be elected, got %s", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the other candidate is elected once the leader stops
+	cancels[leader]()
+	require.NoError(t, <-done)
+	assert.Equal(t, leader+" revoked", <-events)
+
+	follower := map[string]string{"a": "b", "b": "a"}[leader]
+
+	select {
+	case event := <-events:
+		assert.Equal(t, follower+" elected", event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the follower should be elected")
+	}
+
+	cancels[follower]()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,45 @@
+// A program that manages the SQL migrations of a database, configured by the database section of a config file.
+// The migrations are read from the configured directory, which is relative to the working directory unless it is absolute.
+//
+// It does not know the Go migrations of a service, see database.Migration, so the down, redo and status commands
+// fail on their applied versions. A service with Go migrations must build its own CLI with migratecli.Run instead.
+//
+// Usage:
+//
+//	go run github.com/SeaRoll/zumi/database/migrate/cmd [-config config.yaml] [-dir migrations] [-table goose_db_version] <command>
+//
+// Commands:
+//
+//	up           Apply every pending migration
+//	down         Roll back the most recently applied migration
+//	redo         Roll back the most recently applied migration and apply it again
+//	status       Print the state of every migration
+//	version      Print the version of the most recently applied migration
+//	create NAME  Create an empty SQL migration
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/SeaRoll/zumi/database/migrate/migratecli"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := migratecli.Run(ctx, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		stop()
+		log.Fatalf("Error running migrations: %v", err)
+	}
+}
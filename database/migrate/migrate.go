@@ -0,0 +1,240 @@
+// Package migrate manages the migrations of a database with goose, independent of its global state.
+// Only one migrator at a time migrates a database, as migrating takes a Postgres advisory lock,
+// so that replicas of a service can migrate on startup concurrently.
+//
+// Example usage:
+//
+//	migrator, err := migrate.New(db, embedMigrations, cfg.Database.Migrations)
+//	if err != nil {
+//	    return err
+//	}
+//
+//	_, err = migrator.Up(ctx)
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Defaults of the migration configuration.
+const (
+	DefaultDir   = "migrations"           // The directory of the migrations
+	DefaultTable = goose.DefaultTablename // The table of the applied migration versions
+)
+
+// Migrator migrates a database with the migrations of a directory.
+type Migrator struct {
+	provider *goose.Provider // nil if there are no migrations
+}
+
+// New creates a migrator of the migrations in the configured directory of the filesystem,
+// and of the Go migrations, see database.GoMigrations.
+// The migrations are SQL files in the goose format, e.g: 00001_create_books.sql.
+// A migration annotated with `-- +goose NO TRANSACTION` runs outside a transaction, e.g: for CREATE INDEX CONCURRENTLY.
+// Without any migrations, e.g: an empty embedded directory, the migrator has nothing to apply.
+func New(db *sql.DB, migrations fs.FS, cfg config.DatabaseMigrationConfig, goMigrations ...*goose.Migration) (*Migrator, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = DefaultDir
+	}
+
+	table := cfg.Table
+	if table == "" {
+		table = DefaultTable
+	}
+
+	var migrationsDir fs.FS
+
+	// only Go migrations are run without a filesystem
+	if migrations != nil {
+		var err error
+
+		migrationsDir, err = fs.Sub(migrations, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open migrations directory %q: %w", dir, err)
+		}
+	}
+
+	store, err := database.NewStore(database.DialectPostgres, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration store: %w", err)
+	}
+
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration lock: %w", err)
+	}
+
+	provider, err := goose.NewProvider("", db, migrationsDir,
+		goose.WithStore(store),
+		goose.WithSessionLocker(locker),
+		goose.WithGoMigrations(goMigrations...),
+	)
+	if errors.Is(err, goose.ErrNoMigrations) {
+		return &Migrator{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration provider: %w", err)
+	}
+
+	return &Migrator{provider: provider}, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	if m.provider == nil {
+		return nil, nil
+	}
+
+	results, err := m.provider.Up(ctx)
+	if err != nil {
+		return results, fmt.Errorf("failed to migrate up: %w", err)
+	}
+
+	return results, nil
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	if m.provider == nil {
+		return nil, fmt.Errorf("failed to migrate down: %w", goose.ErrNoNextVersion)
+	}
+
+	result, err := m.provider.Down(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to migrate down: %w", err)
+	}
+
+	return result, nil
+}
+
+// Redo rolls back the most recently applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) ([]*goose.MigrationResult, error) {
+	down, err := m.Down(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	up, err := m.provider.UpByOne(ctx)
+	if err != nil {
+		return []*goose.MigrationResult{down, up}, fmt.Errorf("failed to migrate up: %w", err)
+	}
+
+	return []*goose.MigrationResult{down, up}, nil
+}
+
+// Status returns the state of every migration.
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	if m.provider == nil {
+		return nil, nil
+	}
+
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration status: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// Version returns the version of the most recently applied migration, 0 if none is applied.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	if m.provider == nil {
+		return 0, nil
+	}
+
+	version, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get migration version: %w", err)
+	}
+
+	return version, nil
+}
+
+// migrationNamePattern matches the characters which are replaced in the file names of migrations.
+var migrationNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// migrationFilePattern matches the version of a migration file.
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_.*\.(sql|go)$`)
+
+// timestampVersion is the smallest version of a migration versioned with a timestamp, e.g: 20250101120000.
+const timestampVersion = 10_000_000_000_000
+
+// Create creates an empty SQL migration in the directory and returns the path of the file.
+// It is versioned sequentially if the existing migrations are, e.g: 00002_add_authors.sql,
+// or with the current time otherwise, e.g: 20250101120000_add_authors.sql.
+func Create(dir string, name string) (string, error) {
+	name = strings.Trim(migrationNamePattern.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", errors.New("migration name cannot be empty")
+	}
+
+	version, err := nextVersion(dir, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create migrations directory: %w", err)
+	}
+
+	path := filepath.Join(dir, version+"_"+name+".sql")
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("failed to create migration: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString("-- +goose Up\n\n-- +goose Down\n")
+	if err != nil {
+		return "", fmt.Errorf("failed to write migration: %w", err)
+	}
+
+	return path, nil
+}
+
+// nextVersion returns the version of a new migration in the directory.
+func nextVersion(dir string, now time.Time) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	var latest int64
+
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil {
+			latest = max(latest, version)
+		}
+	}
+
+	if latest > 0 && latest < timestampVersion {
+		return fmt.Sprintf("%05d", latest+1), nil
+	}
+
+	return now.UTC().Format("20060102150405"), nil
+}
@@ -0,0 +1,197 @@
+// Package migratecli is the CLI which manages the migrations of a database, configured by the database section of a config file.
+// The migrations are read from the configured directory relative to the working directory.
+// The database/migrate/cmd program runs it with the SQL migrations only, so a service with Go migrations
+// must build its own CLI which passes them to Run, because the applied versions of unknown Go migrations
+// cannot be rolled back or reported.
+//
+// Commands:
+//
+//	up           Apply every pending migration
+//	down         Roll back the most recently applied migration
+//	redo         Roll back the most recently applied migration and apply it again
+//	status       Print the state of every migration
+//	version      Print the version of the most recently applied migration
+//	create NAME  Create an empty SQL migration
+package migratecli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/SeaRoll/zumi/database"
+	"github.com/SeaRoll/zumi/database/migrate"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+// Run runs the CLI with its arguments, e.g: os.Args[1:], and the Go migrations of the service.
+//
+// Example usage:
+//
+//	func main() {
+//	    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	    defer stop()
+//
+//	    err := migratecli.Run(ctx, os.Args[1:], migrations.SeedAuthors, migrations.BackfillSlugs)
+//	    if err != nil {
+//	        log.Fatal(err)
+//	    }
+//	}
+func Run(ctx context.Context, args []string, goMigrations ...database.Migration) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	configFile := flags.String("config", "config.yaml", "Config file with the database section")
+	dir := flags.String("dir", "", "Directory of the migrations, overrides the configured directory")
+	table := flags.String("table", "", "Table of the applied migration versions, overrides the configured table")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: migrate [flags] up|down|redo|status|version|create NAME\n")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("expected a command")
+	}
+
+	cfg, err := loadConfig(*configFile, *dir, *table)
+	if err != nil {
+		return err
+	}
+
+	return run(ctx, cfg, flags.Arg(0), flags.Args()[1:], database.GoMigrations(goMigrations...))
+}
+
+// run runs the command with its arguments.
+func run(ctx context.Context, cfg config.DatabaseConfig, command string, args []string, goMigrations []*goose.Migration) error {
+	if command == "create" {
+		if len(args) != 1 {
+			return fmt.Errorf("expected the name of the migration, got %d arguments", len(args))
+		}
+
+		path, err := migrate.Create(cfg.Migrations.Dir, args[0])
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Created migration %s\n", path)
+
+		return nil
+	}
+
+	poolConfig, err := database.PoolConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create database connection pool: %w", err)
+	}
+	defer pool.Close()
+
+	// the directory is opened itself, as it may be absolute or outside of the working directory
+	migrations := cfg.Migrations
+	migrations.Dir = "."
+
+	migrator, err := migrate.New(stdlib.OpenDBFromPool(pool), os.DirFS(cfg.Migrations.Dir), migrations, goMigrations...)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		results, err := migrator.Up(ctx)
+		for _, result := range results {
+			log.Println(result)
+		}
+
+		if err == nil && len(results) == 0 {
+			log.Println("No pending migrations")
+		}
+
+		return err
+	case "down":
+		result, err := migrator.Down(ctx)
+		if result != nil {
+			log.Println(result)
+		}
+
+		return err
+	case "redo":
+		results, err := migrator.Redo(ctx)
+		for _, result := range results {
+			if result != nil {
+				log.Println(result)
+			}
+		}
+
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%-20s %s\n", appliedAt, status.Source.Path)
+		}
+
+		return nil
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(version)
+
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// loadConfig loads the database section of the config file, applying the directory and table flags.
+func loadConfig(configFile string, dir string, table string) (config.DatabaseConfig, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return config.DatabaseConfig{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg, err := config.FromYAML[config.BaseConfig](string(data))
+	if err != nil {
+		return config.DatabaseConfig{}, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	databaseConfig := cfg.Database
+
+	if dir != "" {
+		databaseConfig.Migrations.Dir = dir
+	}
+
+	if databaseConfig.Migrations.Dir == "" {
+		databaseConfig.Migrations.Dir = migrate.DefaultDir
+	}
+
+	if table != "" {
+		databaseConfig.Migrations.Table = table
+	}
+
+	return databaseConfig, nil
+}
@@ -0,0 +1,41 @@
+package migratecli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("database:\n  migrations:\n    dir: "+dir+"\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00001_init.sql"), nil, 0o600))
+
+	t.Run("create", func(t *testing.T) {
+		require.NoError(t, Run(ctx, []string{"-config", configFile, "create", "books"}))
+
+		_, err := os.Stat(filepath.Join(dir, "00002_books.sql"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("directory outside of the working directory", func(t *testing.T) {
+		unreachable := filepath.Join(dir, "unreachable.yaml")
+		require.NoError(t, os.WriteFile(unreachable, []byte("database:\n  host: 127.0.0.1\n  port: 1\n"), 0o600))
+
+		// the migrations are found, and the status fails to connect to the database
+		err := Run(ctx, []string{"-config", unreachable, "-dir", dir, "status"})
+		assert.ErrorContains(t, err, "failed to get migration status")
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		assert.EqualError(t, Run(ctx, []string{"-config", configFile}), "expected a command")
+		assert.EqualError(t, Run(ctx, []string{"-config", configFile, "create"}), "expected the name of the migration, got 0 arguments")
+		assert.ErrorContains(t, Run(ctx, []string{"-config", filepath.Join(dir, "missing.yaml"), "up"}), "failed to read config file")
+	})
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+// MigrationFunc migrates the database in Go, e.g: re-encoding a JSON column.
+type MigrationFunc func(ctx context.Context, tx DBTX) error
+
+// Migration is a migration coded in Go, which is ordered by its version together with the SQL migrations.
+//
+// The function runs in its own transaction, and the version is recorded after the transaction is committed,
+// so the function should be safe to run again if recording the version fails.
+// A migration without transaction receives a connection instead, which can begin transactions,
+// e.g: to create an index concurrently or to run a Backfill in batches.
+// The database/migrate CLI does not know Go migrations, so pass them to migratecli.Run to manage them from a CLI.
+//
+// Example usage:
+//
+//	db, err := database.NewDatabase(ctx, cfg.Database, embedMigrations, database.Migration{
+//	    Version: 3,
+//	    Up: func(ctx context.Context, tx database.DBTX) error {
+//	        return database.ExecQuery(ctx, tx, "UPDATE books SET title = initcap(title)")
+//	    },
+//	})
+type Migration struct {
+	Version       int64         // The version, e.g: 3 to run after 00002_create_authors.sql
+	Up            MigrationFunc // Applies the migration
+	Down          MigrationFunc // Rolls back the migration, nil if it cannot be rolled back
+	NoTransaction bool          // Whether the functions run outside a transaction
+}
+
+// GoMigrations returns the goose migrations of the Go migrations, for migrate.New.
+func GoMigrations(migrations ...Migration) []*goose.Migration {
+	gooseMigrations := make([]*goose.Migration, 0, len(migrations))
+
+	for _, m := range migrations {
+		down := m.goFunc(m.Down)
+		if down == nil {
+			down = &goose.GoFunc{RunDB: func(context.Context, *sql.DB) error {
+				return fmt.Errorf("migration %d cannot be rolled back", m.Version)
+			}}
+		}
+
+		gooseMigrations = append(gooseMigrations, goose.NewGoMigration(m.Version, m.goFunc(m.Up), down))
+	}
+
+	return gooseMigrations
+}
+
+// goFunc returns the goose function running fn on a pgx connection of the database, in a transaction unless disabled.
+func (m Migration) goFunc(fn MigrationFunc) *goose.GoFunc {
+	if fn == nil {
+		return nil
+	}
+
+	return &goose.GoFunc{RunDB: func(ctx context.Context, db *sql.DB) error {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get migration connection: %w", err)
+		}
+		defer conn.Close()
+
+		return conn.Raw(func(driverConn any) error {
+			stdlibConn, ok := driverConn.(*stdlib.Conn)
+			if !ok {
+				return errors.New("migration connection is not a pgx connection")
+			}
+
+			if m.NoTransaction {
+				return fn(ctx, stdlibConn.Conn())
+			}
+
+			return pgx.BeginFunc(ctx, stdlibConn.Conn(), func(tx pgx.Tx) error {
+				return fn(ctx, tx)
+			})
+		})
+	}}
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/SeaRoll/zumi/database/migrate"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoMigrations(t *testing.T) {
+	migrations := GoMigrations(
+		Migration{Version: 2, Up: func(context.Context, DBTX) error { return nil }},
+		Migration{Version: 3},
+	)
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, int64(2), migrations[0].Version)
+	assert.Equal(t, goose.TypeGo, migrations[0].Type)
+	assert.Equal(t, int64(3), migrations[1].Version)
+}
+
+func TestGoMigrationsOfDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	cfg, err := config.FromYAML[config.BaseConfig](cfgYaml)
+	assert.NoError(t, err)
+
+	poolCfg, err := PoolConfig(cfg.Database)
+	assert.NoError(t, err)
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	t.Cleanup(pool.Close)
+
+	table := "migrations_" + uuid.NewString()[:8]
+	items := table + "_items"
+
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DROP TABLE IF EXISTS "+items+", "+table)
+	})
+
+	sqlMigrations := fstest.MapFS{
+		"migrations/00001_create.sql": {Data: []byte("-- +goose Up\nCREATE TABLE " + items + " (id INT PRIMARY KEY, name TEXT);\n")},
+	}
+
+	migrator, err := migrate.New(stdlib.OpenDBFromPool(pool), sqlMigrations, config.DatabaseMigrationConfig{Table: table}, GoMigrations(
+		Migration{
+			Version: 2,
+			Up: func(ctx context.Context, tx DBTX) error {
+				return ExecQuery(ctx, tx, "INSERT INTO "+items+" (id) SELECT generate_series(1, 3)")
+			},
+			Down: func(ctx context.Context, tx DBTX) error {
+				return ExecQuery(ctx, tx, "DELETE FROM "+items)
+			},
+		},
+		Migration{
+			Version:       3,
+			NoTransaction: true,
+			Up: func(ctx context.Context, conn DBTX) error {
+				err := ExecQuery(ctx, conn, "CREATE INDEX CONCURRENTLY "+items+"_name_idx ON "+items+" (name)")
+				if err != nil {
+					return err
+				}
+
+				return RunBackfill(ctx, conn, Backfill[int]{
+					Name:      items,
+					Query:     "SELECT id FROM " + items,
+					BatchSize: 2,
+					Process: func(ctx context.Context, tx DBTX, ids []int) error {
+						return ExecQuery(ctx, tx, "UPDATE "+items+" SET name = 'item ' || id WHERE id = ANY($1)", ids)
+					},
+				})
+			},
+		},
+	)...)
+	assert.NoError(t, err)
+
+	results, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	var named int
+
+	err = pool.QueryRow(ctx, "SELECT COUNT(*) FROM "+items+" WHERE name IS NOT NULL").Scan(&named)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, named)
+
+	// the backfill migration has no down function
+	_, err = migrator.Down(ctx)
+	assert.Error(t, err)
+}
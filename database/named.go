@@ -0,0 +1,368 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrInvalidNamedQuery is matched by every error caused by a named query which cannot be bound to its arguments.
+var ErrInvalidNamedQuery = errors.New("invalid named query")
+
+// NamedQueryError describes why a named query could not be bound to its arguments.
+// It matches ErrInvalidNamedQuery.
+type NamedQueryError struct {
+	Name   string // The named parameter, empty if the error is not caused by a parameter
+	Reason string // Why the query could not be bound
+}
+
+func (e *NamedQueryError) Error() string {
+	if e.Name == "" {
+		return "invalid named query: " + e.Reason
+	}
+
+	return fmt.Sprintf("invalid named parameter %q: %s", e.Name, e.Reason)
+}
+
+func (e *NamedQueryError) Is(target error) bool {
+	return target == ErrInvalidNamedQuery
+}
+
+// SelectRowNamed executes a query with named parameters and returns a single row as a struct of type T, see SelectRow.
+// The parameters are written as `:name` and bound to the arguments, a map[string]any or a struct with `db` tags.
+// A slice bound to a parameter in an IN list is expanded into a placeholder per element, e.g: `id IN (:ids)`,
+// while it is bound as an array anywhere else, e.g: `id = ANY(:ids)`.
+// An empty slice matches no row in an IN list, and every row in a NOT IN list.
+//
+// Every parameter must have an argument, and every key of a map must be a parameter,
+// while the fields of a struct which are not parameters are ignored.
+//
+// Example usage:
+//
+//	book, err := database.SelectRowNamed[Book](ctx, tx,
+//	    "UPDATE books SET title = :title, description = :description WHERE id = :id RETURNING *", book)
+func SelectRowNamed[T any](ctx context.Context, dbtx DBTX, query string, args any) (T, error) {
+	positional, positionalArgs, err := BindNamed(query, args)
+	if err != nil {
+		var result T
+		return result, err
+	}
+
+	return SelectRow[T](ctx, dbtx, positional, positionalArgs...)
+}
+
+// SelectRowsNamed executes a query with named parameters and returns multiple rows as a slice of structs of type T,
+// see SelectRowNamed for the parameters and SelectRows.
+//
+// Example usage:
+//
+//	books, err := database.SelectRowsNamed[Book](ctx, tx,
+//	    "SELECT * FROM books WHERE id IN (:ids) AND title ILIKE :title", map[string]any{"ids": ids, "title": "%go%"})
+func SelectRowsNamed[T any](ctx context.Context, dbtx DBTX, query string, args any) ([]T, error) {
+	positional, positionalArgs, err := BindNamed(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return SelectRows[T](ctx, dbtx, positional, positionalArgs...)
+}
+
+// ExecQueryNamed executes a query with named parameters that does not return rows,
+// see SelectRowNamed for the parameters and ExecQuery.
+func ExecQueryNamed(ctx context.Context, dbtx DBTX, query string, args any) error {
+	positional, positionalArgs, err := BindNamed(query, args)
+	if err != nil {
+		return err
+	}
+
+	return ExecQuery(ctx, dbtx, positional, positionalArgs...)
+}
+
+// BindNamed binds a query with named parameters to its arguments, see SelectRowNamed,
+// and returns the query with positional placeholders and their arguments.
+// The query is compiled once and cached, so it should not be built from the input of clients.
+func BindNamed(query string, args any) (string, []any, error) {
+	compiled, err := compileNamed(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	values, err := namedValues(args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if values.strict {
+		for name := range values.values {
+			if _, ok := compiled.names[name]; !ok {
+				return "", nil, &NamedQueryError{Name: name, Reason: "argument is not a parameter of the query"}
+			}
+		}
+	}
+
+	var builder strings.Builder
+
+	positionalArgs := []any{}
+	bound := map[string]string{} // the placeholders of the parameters which were already bound
+
+	for i, param := range compiled.params {
+		value, ok := values.values[param.name]
+		if !ok {
+			return "", nil, &NamedQueryError{Name: param.name, Reason: "missing argument"}
+		}
+
+		if elements, ok := inListElements(value); ok && param.inList {
+			if len(elements) == 0 && param.notIn >= 0 {
+				// NOT IN (NULL) matches no row, while <> ALL of an empty array, typed like the column, matches every row
+				builder.WriteString(compiled.parts[i][:param.notIn] + "<> ALL ('{}'")
+				continue
+			}
+
+			builder.WriteString(compiled.parts[i])
+			builder.WriteString(expandInList(elements, &positionalArgs))
+
+			continue
+		}
+
+		builder.WriteString(compiled.parts[i])
+
+		placeholder, ok := bound[param.name]
+		if !ok {
+			positionalArgs = append(positionalArgs, value)
+			placeholder = "$" + strconv.Itoa(len(positionalArgs))
+			bound[param.name] = placeholder
+		}
+
+		builder.WriteString(placeholder)
+	}
+
+	builder.WriteString(compiled.parts[len(compiled.parts)-1])
+
+	return builder.String(), positionalArgs, nil
+}
+
+// namedQuery is a query split around its named parameters.
+type namedQuery struct {
+	parts  []string            // The text around the parameters, one more than the parameters
+	params []namedParam        // The parameters in order of occurrence
+	names  map[string]struct{} // The names of the parameters
+}
+
+// namedParam is an occurrence of a named parameter.
+type namedParam struct {
+	name   string
+	inList bool // Whether the parameter is the content of an IN list, e.g: `IN (:ids)`
+	// The index of the NOT of a NOT IN list in the text before the parameter, or -1, e.g: `id NOT IN (:ids)`
+	notIn int
+}
+
+var namedQueryCache sync.Map // map[string]*namedQuery
+
+// compileNamed splits a query around its named parameters, skipping string literals, quoted identifiers,
+// comments and `::` casts. Positional placeholders cannot be mixed with named parameters.
+func compileNamed(query string) (*namedQuery, error) {
+	if cached, ok := namedQueryCache.Load(query); ok {
+		return cached.(*namedQuery), nil //nolint:forcetypeassert
+	}
+
+	compiled := &namedQuery{names: map[string]struct{}{}}
+	start := 0
+
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == '\'' || c == '"':
+			i = skipQuoted(query, i, c)
+		case strings.HasPrefix(query[i:], "--"):
+			i = skipUntil(query, i, "\n")
+		case strings.HasPrefix(query[i:], "/*"):
+			i = skipUntil(query, i+2, "*/")
+		case strings.HasPrefix(query[i:], "::"):
+			i += 2
+		case c == '$':
+			if i+1 < len(query) && isDigit(query[i+1]) {
+				return nil, &NamedQueryError{Reason: "positional placeholders cannot be mixed with named parameters"}
+			}
+
+			i = skipDollarQuoted(query, i)
+		case c == ':' && i+1 < len(query) && isIdentifierStart(query[i+1]):
+			end := i + 1
+			for end < len(query) && isIdentifierPart(query[end]) {
+				end++
+			}
+
+			name := query[i+1 : end]
+			compiled.names[name] = struct{}{}
+			inList, notIn := isInList(query[start:i])
+			compiled.params = append(compiled.params, namedParam{name: name, inList: inList, notIn: notIn})
+			compiled.parts = append(compiled.parts, query[start:i])
+			start, i = end, end
+		default:
+			i++
+		}
+	}
+
+	compiled.parts = append(compiled.parts, query[start:])
+
+	cached, _ := namedQueryCache.LoadOrStore(query, compiled)
+
+	return cached.(*namedQuery), nil //nolint:forcetypeassert
+}
+
+// skipQuoted returns the index after the string literal or quoted identifier starting at i.
+// A doubled quote is an escaped quote, and so is a backslash escaped quote of an escape string, e.g: E'it\'s'.
+func skipQuoted(query string, i int, quote byte) int {
+	escapes := quote == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e')
+
+	for i++; i < len(query); i++ {
+		switch {
+		case escapes && query[i] == '\\':
+			i++
+		case query[i] == quote && i+1 < len(query) && query[i+1] == quote:
+			i++
+		case query[i] == quote:
+			return i + 1
+		}
+	}
+
+	return i
+}
+
+// skipUntil returns the index after the end marker, searching from i.
+func skipUntil(query string, i int, end string) int {
+	index := strings.Index(query[i:], end)
+	if index < 0 {
+		return len(query)
+	}
+
+	return i + index + len(end)
+}
+
+// skipDollarQuoted returns the index after the dollar-quoted string starting at i, e.g: $$it's$$ or $body$...$body$,
+// or the index after the dollar sign if it does not start one.
+func skipDollarQuoted(query string, i int) int {
+	end := i + 1
+	for end < len(query) && isIdentifierPart(query[end]) {
+		end++
+	}
+
+	if end >= len(query) || query[end] != '$' {
+		return i + 1
+	}
+
+	tag := query[i : end+1]
+
+	return skipUntil(query, end+1, tag)
+}
+
+// isInList returns whether the text before a parameter opens an IN list, e.g: "WHERE id IN (",
+// and the index of its NOT if it opens a NOT IN list, or -1.
+func isInList(before string) (bool, int) {
+	trimmed := strings.TrimRightFunc(before, unicode.IsSpace)
+	if !strings.HasSuffix(trimmed, "(") {
+		return false, -1
+	}
+
+	trimmed = strings.TrimRightFunc(strings.TrimSuffix(trimmed, "("), unicode.IsSpace)
+	if !hasKeywordSuffix(trimmed, "in") {
+		return false, -1
+	}
+
+	operand := trimmed[:len(trimmed)-len("in")]
+
+	trimmed = strings.TrimRightFunc(operand, unicode.IsSpace)
+	if len(trimmed) < len(operand) && hasKeywordSuffix(trimmed, "not") {
+		return true, len(trimmed) - len("not")
+	}
+
+	return true, -1
+}
+
+// hasKeywordSuffix returns whether the text ends with the case-insensitive keyword, which is not the end of a longer identifier.
+func hasKeywordSuffix(text string, keyword string) bool {
+	if len(text) < len(keyword) || !strings.EqualFold(text[len(text)-len(keyword):], keyword) {
+		return false
+	}
+
+	return len(text) == len(keyword) || !isIdentifierPart(text[len(text)-len(keyword)-1])
+}
+
+// expandInList appends the elements of an IN list to the arguments, and returns their placeholders.
+func expandInList(elements []any, args *[]any) string {
+	if len(elements) == 0 {
+		return "NULL" // an empty IN list matches no row, see BindNamed for NOT IN
+	}
+
+	placeholders := make([]string, 0, len(elements))
+	for _, element := range elements {
+		*args = append(*args, element)
+		placeholders = append(placeholders, "$"+strconv.Itoa(len(*args)))
+	}
+
+	return strings.Join(placeholders, ", ")
+}
+
+// inListElements returns the elements of a slice which is expanded in an IN list.
+// Byte slices are bound as a single value.
+func inListElements(value any) ([]any, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	elements := make([]any, 0, v.Len())
+	for i := range v.Len() {
+		elements = append(elements, v.Index(i).Interface())
+	}
+
+	return elements, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c)
+}
+
+// namedArgs are the arguments of a named query, by name.
+type namedArgs struct {
+	values map[string]any
+	strict bool // Whether every argument must be a parameter, true for maps
+}
+
+// namedValues returns the arguments of a map[string]any or of a struct with `db` tags.
+func namedValues(args any) (namedArgs, error) {
+	if values, ok := args.(map[string]any); ok {
+		return namedArgs{values: values, strict: true}, nil
+	}
+
+	v := reflect.ValueOf(args)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return namedArgs{}, &NamedQueryError{Reason: fmt.Sprintf("arguments must be a map[string]any or a struct, got %T", args)}
+	}
+
+	values := map[string]any{}
+	for _, field := range entityFor(v.Type()).fields {
+		values[field.column] = v.FieldByIndex(field.index).Interface()
+	}
+
+	return namedArgs{values: values}, nil
+}
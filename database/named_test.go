@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindNamed(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		args     any
+		expected string
+		values   []any
+	}{
+		{
+			name:     "map",
+			query:    "SELECT * FROM books WHERE title = :title AND description = :description",
+			args:     map[string]any{"title": "Dune", "description": "Spice"},
+			expected: "SELECT * FROM books WHERE title = $1 AND description = $2",
+			values:   []any{"Dune", "Spice"},
+		},
+		{
+			name:     "struct with unused fields",
+			query:    "UPDATE books SET title = :title WHERE id = :id",
+			args:     Book{ID: 3, Title: "Dune", Description: "Spice"},
+			expected: "UPDATE books SET title = $1 WHERE id = $2",
+			values:   []any{"Dune", 3},
+		},
+		{
+			name:     "pointer to struct",
+			query:    "SELECT * FROM books WHERE id = :id",
+			args:     &Book{ID: 3},
+			expected: "SELECT * FROM books WHERE id = $1",
+			values:   []any{3},
+		},
+		{
+			name:     "repeated parameter",
+			query:    "SELECT * FROM books WHERE title = :q OR description = :q",
+			args:     map[string]any{"q": "go"},
+			expected: "SELECT * FROM books WHERE title = $1 OR description = $1",
+			values:   []any{"go"},
+		},
+		{
+			name:     "in list",
+			query:    "SELECT * FROM books WHERE id IN (:ids) AND title <> :title",
+			args:     map[string]any{"ids": []int{1, 2, 3}, "title": "Dune"},
+			expected: "SELECT * FROM books WHERE id IN ($1, $2, $3) AND title <> $4",
+			values:   []any{1, 2, 3, "Dune"},
+		},
+		{
+			name:     "empty in list",
+			query:    "SELECT * FROM books WHERE id in ( :ids )",
+			args:     map[string]any{"ids": []int{}},
+			expected: "SELECT * FROM books WHERE id in ( NULL )",
+			values:   []any{},
+		},
+		{
+			name:     "not in list",
+			query:    "SELECT * FROM books WHERE id NOT\nIN (:ids) AND title <> :title",
+			args:     map[string]any{"ids": []int{1, 2}, "title": "Dune"},
+			expected: "SELECT * FROM books WHERE id NOT\nIN ($1, $2) AND title <> $3",
+			values:   []any{1, 2, "Dune"},
+		},
+		{
+			name:     "empty not in list",
+			query:    "SELECT * FROM books WHERE id not in ( :ids ) AND title <> :title",
+			args:     map[string]any{"ids": []int{}, "title": "Dune"},
+			expected: "SELECT * FROM books WHERE id <> ALL ('{}' ) AND title <> $1",
+			values:   []any{"Dune"},
+		},
+		{
+			name:     "identifier ending in not",
+			query:    "SELECT * FROM books WHERE knot IN (:ids)",
+			args:     map[string]any{"ids": []int{}},
+			expected: "SELECT * FROM books WHERE knot IN (NULL)",
+			values:   []any{},
+		},
+		{
+			name:     "array",
+			query:    "SELECT * FROM books WHERE id = ANY(:ids) OR title IN (SELECT :title)",
+			args:     map[string]any{"ids": []int{1, 2}, "title": "Dune"},
+			expected: "SELECT * FROM books WHERE id = ANY($1) OR title IN (SELECT $2)",
+			values:   []any{[]int{1, 2}, "Dune"},
+		},
+		{
+			name:     "function ending in in",
+			query:    "SELECT * FROM books WHERE id = join(:ids)",
+			args:     map[string]any{"ids": []int{1, 2}},
+			expected: "SELECT * FROM books WHERE id = join($1)",
+			values:   []any{[]int{1, 2}},
+		},
+		{
+			name: "literals, comments and casts",
+			query: `SELECT ':a', E'\':b', ":c", $$:d$$, $tag$:e$tag$, now()::date -- :f
+/* :g */ FROM books WHERE id = :id::int`,
+			args: map[string]any{"id": "3"},
+			expected: `SELECT ':a', E'\':b', ":c", $$:d$$, $tag$:e$tag$, now()::date -- :f
+/* :g */ FROM books WHERE id = $1::int`,
+			values: []any{"3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, values, err := BindNamed(tt.query, tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, query)
+			assert.Equal(t, tt.values, values)
+		})
+	}
+}
+
+func TestBindNamedErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		args  any
+		err   string
+	}{
+		{
+			name:  "missing argument",
+			query: "SELECT * FROM books WHERE id = :id",
+			args:  map[string]any{},
+			err:   `invalid named parameter "id": missing argument`,
+		},
+		{
+			name:  "missing field",
+			query: "SELECT * FROM books WHERE author = :author",
+			args:  Book{},
+			err:   `invalid named parameter "author": missing argument`,
+		},
+		{
+			name:  "unused argument",
+			query: "SELECT * FROM books WHERE id = :id",
+			args:  map[string]any{"id": 1, "title": "Dune"},
+			err:   `invalid named parameter "title": argument is not a parameter of the query`,
+		},
+		{
+			name:  "positional placeholder",
+			query: "SELECT * FROM books WHERE id = :id AND title = $1",
+			args:  map[string]any{"id": 1},
+			err:   "invalid named query: positional placeholders cannot be mixed with named parameters",
+		},
+		{
+			name:  "invalid arguments",
+			query: "SELECT * FROM books WHERE id = :id",
+			args:  1,
+			err:   "invalid named query: arguments must be a map[string]any or a struct, got int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := BindNamed(tt.query, tt.args)
+			require.ErrorIs(t, err, ErrInvalidNamedQuery)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestNamedQueries(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+	conn := db.Conn(ctx)
+
+	title := uuid.NewString()
+
+	book, err := SelectRowNamed[Book](ctx, conn,
+		"INSERT INTO books (title, description) VALUES (:title, :description) RETURNING *",
+		Book{Title: title, Description: "Named"})
+	require.NoError(t, err)
+
+	err = ExecQueryNamed(ctx, conn, "UPDATE books SET description = :description WHERE id = :id",
+		map[string]any{"id": book.ID, "description": "Updated"})
+	require.NoError(t, err)
+
+	books, err := SelectRowsNamed[Book](ctx, conn, "SELECT * FROM books WHERE id IN (:ids) AND title = :title",
+		map[string]any{"ids": []int{book.ID, -1}, "title": title})
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Updated", books[0].Description)
+
+	// an empty IN list matches no row, and an empty NOT IN list every row
+	for list, expected := range map[string]int{"IN": 0, "NOT IN": 1} {
+		books, err = SelectRowsNamed[Book](ctx, conn, "SELECT * FROM books WHERE id "+list+" (:ids) AND title = :title",
+			map[string]any{"ids": []int{}, "title": title})
+		require.NoError(t, err)
+		assert.Len(t, books, expected, list)
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"strings"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type PageRequest struct {
@@ -45,9 +45,44 @@ func MapContent[T any, R any](page Page[T], newContent []R) Page[R] {
 	}
 }
 
+// Limits of the page size when it is not given or too large.
+const (
+	DefaultPageSize = 20   // The page size used when a request has no size
+	MaxPageSize     = 1000 // The maximum page size, unless overridden by PageQuery.MaxSize
+)
+
+// CountMode defines how the total elements of a paginated query are counted.
+type CountMode int
+
+const (
+	// CountQuery counts the total elements with a separate COUNT(*) query. This is the default.
+	CountQuery CountMode = iota
+	// CountWindow counts the total elements with a COUNT(*) OVER() window in the same round trip.
+	// The query is wrapped in a subquery, so sort expressions can only reference its result columns.
+	CountWindow
+	// CountNone skips counting, TotalElements and TotalPages are -1.
+	// Whether the page is the last one is still known, as one extra row is fetched.
+	CountNone
+)
+
+// PageQuery describes a paginated query and how clients may sort it.
+type PageQuery struct {
+	Request  PageRequest // The page requested by the client
+	Query    string      // The query without ORDER BY, LIMIT and OFFSET
+	Args     []any       // The arguments of the query
+	Sortable Sortable    // The allowed sort fields, defaults to the db columns of the result type
+	Count    CountMode   // How the total elements are counted, defaults to CountQuery
+	MaxSize  int         // The maximum page size, defaults to MaxPageSize
+	// The filter requested by the client, its conditions are validated against Filterable.
+	// The query is wrapped in a subquery when filtered, so expressions can only reference its result columns.
+	Filter     Filter
+	Filterable Filterable // The allowed filter fields, no field can be filtered on if nil
+}
+
 // SelectRowsPageable executes a query and returns a paginated result set.
 // It uses the provided dbtx to execute the query and collects the results into a Page[T].
 // The PageRequest parameter specifies the pagination details such as page number and size.
+// Only the columns of T can be sorted on, see SelectPage to allow other sort fields.
 //
 // Note: make sure the query does not have a `;` at the end, as this function appends LIMIT and OFFSET for pagination.
 func SelectRowsPageable[T any](
@@ -57,43 +92,59 @@ func SelectRowsPageable[T any](
 	query string,
 	args ...any,
 ) (Page[T], error) {
+	return SelectPage[T](ctx, dbtx, PageQuery{
+		Request: pageRequest,
+		Query:   query,
+		Args:    args,
+	})
+}
+
+// SelectPage executes a paginated query and collects the results into a Page[T].
+// The sort commands of the request and the filter conditions are validated against the allow-lists of the query,
+// and an error matching ErrInvalidSort or ErrInvalidFilter is returned if any of them is not allowed.
+// A negative page is treated as the first page, and the size defaults to DefaultPageSize
+// and is capped at the maximum size.
+//
+// Example usage:
+//
+//	page, err := database.SelectPage[Book](ctx, tx, database.PageQuery{
+//	    Request:  pageRequest,
+//	    Query:    "SELECT * FROM books WHERE author_id = $1",
+//	    Args:     []any{authorID},
+//	    Sortable: database.Sortable{"title": "title", "published": "published_at"},
+//	    Count:    database.CountWindow,
+//	})
+func SelectPage[T any](ctx context.Context, dbtx DBTX, pageQuery PageQuery) (Page[T], error) {
 	var page Page[T]
 
+	pageRequest := pageQuery.Request.normalize(pageQuery.MaxSize)
 	page.Pageable = pageRequest
 
-	// Calculate offset and limit
+	sortable := pageQuery.Sortable
+	if sortable == nil {
+		sortable = SortableColumns[T]()
+	}
+
+	orderBy, err := sortable.orderBy(pageRequest.Sort)
+	if err != nil {
+		return page, err
+	}
+
+	filteredQuery, filteredArgs, err := filterQuery(pageQuery.Query, pageQuery.Args, pageQuery.Filter, pageQuery.Filterable)
+	if err != nil {
+		return page, err
+	}
+
+	// Calculate offset and limit, fetching one more row to know if there is a next page when not counting
 	offset := pageRequest.Page * pageRequest.Size
 	limit := pageRequest.Size
 
-	// Add Sorting if provided
-	if len(pageRequest.Sort) > 0 { //nolint:nestif
-		for i, sort := range pageRequest.Sort {
-			if sort == "" {
-				continue
-			}
-
-			// check if , is present to determine if it's ascending or descending
-			splitSort := strings.Split(sort, ",")
-			if len(splitSort) == 2 && (splitSort[1] == "asc" || splitSort[1] == "desc") {
-				if i == 0 {
-					query += fmt.Sprintf(" ORDER BY %s %s", splitSort[0], splitSort[1])
-				} else {
-					query += fmt.Sprintf(", %s %s", splitSort[0], splitSort[1])
-				}
-			} else {
-				if i == 0 {
-					query += " ORDER BY " + sort
-				} else {
-					query += ", " + sort
-				}
-			}
-		}
+	fetchLimit := limit
+	if pageQuery.Count == CountNone {
+		fetchLimit++
 	}
 
-	// Modify the query to include pagination
-	query += " LIMIT $1 OFFSET $2"
-
-	args = append(args, limit, offset)
+	query, args := pageSQL(filteredQuery, filteredArgs, orderBy, pageQuery.Count, fetchLimit, offset)
 
 	slog.Info("Executing paginated query",
 		"query", query,
@@ -108,31 +159,119 @@ func SelectRowsPageable[T any](
 	defer rows.Close()
 
 	// Collect results
-	results, err := pgx.CollectRows(rows, pgx.RowToStructByName[T])
+	var totalElements int64
+
+	rowTo := pgx.RowToStructByName[T]
+	if pageQuery.Count == CountWindow {
+		rowTo = func(row pgx.CollectableRow) (T, error) {
+			return pgx.RowToStructByName[T](extraColumnsRow{CollectableRow: row, dest: []any{&totalElements}})
+		}
+	}
+
+	results, err := pgx.CollectRows(rows, rowTo)
 	if err != nil {
 		return page, fmt.Errorf("failed to collect rows: %w", err)
 	}
 
+	hasNext := len(results) > limit
+	if hasNext {
+		results = results[:limit]
+	}
+
 	page.Content = results
 	page.Number = pageRequest.Page
 	page.Size = pageRequest.Size
 	page.NumberOfElements = len(results)
 	page.IsEmpty = len(results) == 0
+	page.IsFirst = page.Number == 0
 
-	// Get total elements and pages
-	countQuery := "SELECT COUNT(*) FROM (" + query + ") AS count_query"
+	switch pageQuery.Count {
+	case CountNone:
+		page.TotalElements = -1
+		page.TotalPages = -1
+		page.IsLast = !hasNext
 
-	var totalElements int64
+		return page, nil
+	case CountWindow:
+		// a page past the end has no rows to carry the count
+		if len(results) > 0 || offset == 0 {
+			break
+		}
 
-	err = dbtx.QueryRow(ctx, countQuery, args...).Scan(&totalElements)
-	if err != nil {
-		return page, fmt.Errorf("failed to get total elements: %w", err)
+		fallthrough
+	default:
+		totalElements, err = countRows(ctx, dbtx, filteredQuery, filteredArgs)
+		if err != nil {
+			return page, err
+		}
 	}
 
 	page.TotalElements = totalElements
 	page.TotalPages = int((totalElements + int64(pageRequest.Size) - 1) / int64(pageRequest.Size))
 	page.IsLast = page.Number >= page.TotalPages-1
-	page.IsFirst = page.Number == 0
 
 	return page, nil
 }
+
+// normalize applies the defaults and maximum of the page size, and makes sure the page is not negative.
+func (p PageRequest) normalize(maxSize int) PageRequest {
+	p.Page = max(p.Page, 0)
+	p.Size = pageSize(p.Size, maxSize)
+
+	return p
+}
+
+// pageSize applies the default and maximum to a requested page size.
+func pageSize(size int, maxSize int) int {
+	if maxSize <= 0 {
+		maxSize = MaxPageSize
+	}
+
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+
+	return min(size, maxSize)
+}
+
+// pageSQL builds the query of a page, numbering the LIMIT and OFFSET placeholders after the query arguments.
+func pageSQL(query string, args []any, orderBy string, count CountMode, limit, offset int) (string, []any) {
+	if count == CountWindow {
+		query = "SELECT page_query.*, COUNT(*) OVER() AS total_elements FROM (" + query + ") AS page_query"
+	}
+
+	query += orderBy + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+
+	return query, append(append([]any{}, args...), limit, offset)
+}
+
+// countRows counts the rows of the unpaginated query.
+func countRows(ctx context.Context, dbtx DBTX, query string, args []any) (int64, error) {
+	countQuery := "SELECT COUNT(*) FROM (" + query + ") AS count_query"
+
+	var totalElements int64
+
+	err := dbtx.QueryRow(ctx, countQuery, args...).Scan(&totalElements)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get total elements: %w", err)
+	}
+
+	return totalElements, nil
+}
+
+// extraColumnsRow hides trailing columns which are not part of the result type from the struct scanner,
+// and scans them into dest instead.
+type extraColumnsRow struct {
+	pgx.CollectableRow
+
+	dest []any
+}
+
+func (r extraColumnsRow) FieldDescriptions() []pgconn.FieldDescription {
+	fields := r.CollectableRow.FieldDescriptions()
+	return fields[:len(fields)-len(r.dest)]
+}
+
+func (r extraColumnsRow) Scan(dest ...any) error {
+	return r.CollectableRow.Scan(append(dest, r.dest...)...) //nolint:wrapcheck
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPageSorting(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	description := uuid.NewString()
+
+	err := db.WithTX(ctx, func(tx DBTX) error {
+		for _, title := range []string{"b", "c", "a"} {
+			err := ExecQuery(ctx, tx, "INSERT INTO books (title, description) VALUES ($1, $2)", title, description)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	t.Run("sort by allowed column", func(t *testing.T) {
+		err := db.WithReadTX(ctx, func(tx DBTX) error {
+			page, err := SelectRowsPageable[Book](ctx, tx, PageRequest{Size: 10, Sort: []string{"title,desc"}},
+				"SELECT * FROM books WHERE description = $1", description)
+			if err != nil {
+				return err
+			}
+
+			titles := []string{}
+			for _, book := range page.Content {
+				titles = append(titles, book.Title)
+			}
+
+			assert.Equal(t, []string{"c", "b", "a"}, titles)
+
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("sort by mapped expression", func(t *testing.T) {
+		err := db.WithReadTX(ctx, func(tx DBTX) error {
+			page, err := SelectPage[Book](ctx, tx, PageQuery{
+				Request:  PageRequest{Size: 1, Sort: []string{"name,asc,nullslast"}},
+				Query:    "SELECT * FROM books WHERE description = $1",
+				Args:     []any{description},
+				Sortable: Sortable{"name": "upper(title)"},
+			})
+			if err != nil {
+				return err
+			}
+
+			assert.Len(t, page.Content, 1)
+			assert.Equal(t, "a", page.Content[0].Title)
+
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("reject sort injection", func(t *testing.T) {
+		err := db.WithReadTX(ctx, func(tx DBTX) error {
+			_, err := SelectRowsPageable[Book](ctx, tx, PageRequest{Size: 10, Sort: []string{"title; DROP TABLE books"}},
+				"SELECT * FROM books")
+
+			return err
+		})
+		assert.ErrorIs(t, err, ErrInvalidSort)
+	})
+}
+
+func TestSelectPageCounting(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	description := uuid.NewString()
+
+	err := db.WithTX(ctx, func(tx DBTX) error {
+		for i := range 5 {
+			err := ExecQuery(ctx, tx, "INSERT INTO books (title, description) VALUES ($1, $2)", fmt.Sprint(i), description)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	selectPage := func(t *testing.T, request PageRequest, count CountMode) Page[Book] {
+		t.Helper()
+
+		var page Page[Book]
+
+		err := db.WithReadTX(ctx, func(tx DBTX) error {
+			var err error
+
+			page, err = SelectPage[Book](ctx, tx, PageQuery{
+				Request: request,
+				Query:   "SELECT * FROM books WHERE description = $1",
+				Args:    []any{description},
+				Count:   count,
+			})
+
+			return err
+		})
+		require.NoError(t, err)
+
+		return page
+	}
+
+	for name, count := range map[string]CountMode{"count query": CountQuery, "window count": CountWindow} {
+		t.Run(name, func(t *testing.T) {
+			page := selectPage(t, PageRequest{Page: 1, Size: 2, Sort: []string{"title"}}, count)
+			assert.Equal(t, int64(5), page.TotalElements)
+			assert.Equal(t, 3, page.TotalPages)
+			assert.Len(t, page.Content, 2)
+			assert.Equal(t, "2", page.Content[0].Title)
+			assert.False(t, page.IsFirst)
+			assert.False(t, page.IsLast)
+
+			page = selectPage(t, PageRequest{Page: 2, Size: 2}, count)
+			assert.Len(t, page.Content, 1)
+			assert.True(t, page.IsLast)
+
+			page = selectPage(t, PageRequest{Page: 10, Size: 2}, count)
+			assert.Equal(t, int64(5), page.TotalElements, "page past the end")
+			assert.True(t, page.IsEmpty)
+		})
+	}
+
+	t.Run("no count", func(t *testing.T) {
+		page := selectPage(t, PageRequest{Size: 4}, CountNone)
+		assert.Equal(t, int64(-1), page.TotalElements)
+		assert.Equal(t, -1, page.TotalPages)
+		assert.Len(t, page.Content, 4)
+		assert.False(t, page.IsLast)
+
+		page = selectPage(t, PageRequest{Page: 1, Size: 4}, CountNone)
+		assert.Len(t, page.Content, 1)
+		assert.True(t, page.IsLast)
+	})
+
+	t.Run("default size", func(t *testing.T) {
+		page := selectPage(t, PageRequest{Page: -1}, CountQuery)
+		assert.Equal(t, DefaultPageSize, page.Size)
+		assert.Equal(t, 0, page.Number)
+		assert.Equal(t, 1, page.TotalPages)
+		assert.Len(t, page.Content, 5)
+	})
+}
+
+func TestPageRequestNormalize(t *testing.T) {
+	assert.Equal(t, PageRequest{Page: 0, Size: DefaultPageSize}, PageRequest{Page: -1}.normalize(0))
+	assert.Equal(t, PageRequest{Page: 2, Size: MaxPageSize}, PageRequest{Page: 2, Size: MaxPageSize + 1}.normalize(0))
+	assert.Equal(t, PageRequest{Page: 1, Size: 10}, PageRequest{Page: 1, Size: 50}.normalize(10))
+	assert.Equal(t, PageRequest{Size: 5}, PageRequest{}.normalize(5))
+	assert.Equal(t, PageRequest{Size: 15, Sort: []string{"title"}}, PageRequest{Size: 15, Sort: []string{"title"}}.normalize(0))
+}
+
+func TestPageSQL(t *testing.T) {
+	args := []any{"description", 3}
+
+	query, queryArgs := pageSQL("SELECT * FROM books WHERE description = $1 AND id > $2", args, ` ORDER BY "title" ASC`, CountQuery, 10, 20)
+	assert.Equal(t, `SELECT * FROM books WHERE description = $1 AND id > $2 ORDER BY "title" ASC LIMIT $3 OFFSET $4`, query)
+	assert.Equal(t, []any{"description", 3, 10, 20}, queryArgs)
+	assert.Len(t, args, 2, "query args are not modified")
+
+	query, queryArgs = pageSQL("SELECT * FROM books", nil, "", CountWindow, 10, 0)
+	assert.Equal(t, "SELECT page_query.*, COUNT(*) OVER() AS total_elements FROM (SELECT * FROM books) AS page_query LIMIT $1 OFFSET $2", query)
+	assert.Equal(t, []any{10, 0}, queryArgs)
+}
+
+// fakeRow is a pgx.CollectableRow with fixed columns and values.
+type fakeRow struct {
+	columns []string
+	values  []any
+}
+
+func (r fakeRow) FieldDescriptions() []pgconn.FieldDescription {
+	fields := []pgconn.FieldDescription{}
+	for _, column := range r.columns {
+		fields = append(fields, pgconn.FieldDescription{Name: column})
+	}
+
+	return fields
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(r.values) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r.values), len(dest))
+	}
+
+	for i, value := range r.values {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+
+	return nil
+}
+
+func (r fakeRow) Values() ([]any, error) { return r.values, nil }
+func (r fakeRow) RawValues() [][]byte    { return nil }
+
+func TestExtraColumnsRow(t *testing.T) {
+	var total int64
+
+	row := fakeRow{
+		columns: []string{"id", "title", "description", "total_elements"},
+		values:  []any{1, "title", "description", int64(42)},
+	}
+
+	book, err := pgx.RowToStructByName[Book](extraColumnsRow{CollectableRow: row, dest: []any{&total}})
+	require.NoError(t, err)
+	assert.Equal(t, Book{ID: 1, Title: "title", Description: "description"}, book)
+	assert.Equal(t, int64(42), total)
+}
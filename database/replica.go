@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replica is the pool of a read replica, which read-only transactions are load-balanced across while it is healthy.
+type replica struct {
+	name    string // The host and port of the replica, for logging
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+type primaryContextKey struct{}
+
+// ReadFromPrimary returns a context whose read-only transactions begin on the primary instead of a replica,
+// so that they read the writes made before, which may not have reached the replicas yet.
+//
+// Example usage:
+//
+//	err = db.WithTX(ctx, saveBook)
+//	ctx = database.ReadFromPrimary(ctx)
+//	err = db.WithReadTX(ctx, findBook) // finds the saved book
+func ReadFromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// readsFromPrimary returns whether the context was created by ReadFromPrimary.
+func readsFromPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
+
+// connectReplicas creates the pools of the replicas. A replica which cannot be reached is marked unhealthy
+// instead of failing, and is used once a health check succeeds.
+func (d *dbo) connectReplicas(ctx context.Context, poolConfigs []*pgxpool.Config) error {
+	for _, poolConfig := range poolConfigs {
+		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create replica connection pool: %w", err)
+		}
+
+		r := &replica{
+			name: net.JoinHostPort(poolConfig.ConnConfig.Host, strconv.Itoa(int(poolConfig.ConnConfig.Port))),
+			pool: pool,
+		}
+
+		err = pool.Ping(ctx)
+		if err != nil {
+			slog.Error("replica is not healthy", "replica", r.name, "error", err)
+		}
+
+		r.healthy.Store(err == nil)
+		d.replicas = append(d.replicas, r)
+	}
+
+	return nil
+}
+
+// healthCheckReplicas pings every replica concurrently, each with its own timeout,
+// marking it unhealthy on failure and healthy again on success. The pools of the replicas reconnect on their own.
+func (d *dbo) healthCheckReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, r := range d.replicas {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			d.healthCheckReplica(ctx, r)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// healthCheckReplica pings the replica, marking it unhealthy on failure and healthy again on success.
+func (d *dbo) healthCheckReplica(ctx context.Context, r *replica) {
+	ctx, cancel := context.WithTimeout(ctx, d.reconnectPolicy.timeout)
+	defer cancel()
+
+	err := r.pool.Ping(ctx)
+	if err != nil {
+		if r.healthy.Swap(false) {
+			slog.Error("replica is not healthy", "replica", r.name, "error", err)
+			d.emit(ReconnectEvent{Type: ReconnectReplicaDown, Replica: r.name, Err: err})
+		}
+
+		return
+	}
+
+	if !r.healthy.Swap(true) {
+		slog.Info("replica is healthy again", "replica", r.name)
+		d.emit(ReconnectEvent{Type: ReconnectReplicaUp, Replica: r.name})
+	}
+}
+
+// readReplica returns the next healthy replica in round-robin order a read-only transaction begins on,
+// or nil if it begins on the primary: when there is no healthy replica, the context reads from the primary,
+// or the transaction is serializable, which a replica cannot run.
+func (d *dbo) readReplica(ctx context.Context, opts TxOptions) *replica {
+	if len(d.replicas) == 0 || !opts.ReadOnly || opts.Isolation == IsolationSerializable || readsFromPrimary(ctx) {
+		return nil
+	}
+
+	healthy := make([]*replica, 0, len(d.replicas))
+	for _, r := range d.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	return healthy[d.nextReplica.Add(1)%uint64(len(healthy))]
+}
+
+// begin begins a new transaction, on a healthy replica if it is read-only, see readReplica.
+// If the transaction cannot begin on the replica, the replica is marked unhealthy and it fails over to the primary.
+func (d *dbo) begin(ctx context.Context, opts TxOptions) (pgx.Tx, error) {
+	if r := d.readReplica(ctx, opts); r != nil {
+		tx, err := r.pool.BeginTx(ctx, opts.pgxOptions())
+		if err == nil {
+			return tx, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to begin transaction on replica: %w", err)
+		}
+
+		r.healthy.Store(false)
+		slog.Error("failed to begin transaction on replica, failing over to primary", "replica", r.name, "error", err)
+	}
+
+	tx, err := d.pool.Load().BeginTx(ctx, opts.pgxOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	return tx, nil
+}
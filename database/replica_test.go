@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadReplica(t *testing.T) {
+	ctx := context.Background()
+	readOnly := TxOptions{ReadOnly: true}
+
+	newReplica := func(name string, healthy bool) *replica {
+		r := &replica{name: name}
+		r.healthy.Store(healthy)
+
+		return r
+	}
+
+	t.Run("round robin across healthy replicas", func(t *testing.T) {
+		d := &dbo{replicas: []*replica{newReplica("a", true), newReplica("b", false), newReplica("c", true)}}
+
+		names := []string{}
+		for range 4 {
+			names = append(names, d.readReplica(ctx, readOnly).name)
+		}
+
+		assert.ElementsMatch(t, []string{"a", "c", "a", "c"}, names)
+		assert.NotEqual(t, names[0], names[1])
+	})
+
+	t.Run("primary", func(t *testing.T) {
+		d := &dbo{replicas: []*replica{newReplica("a", true)}}
+
+		assert.Nil(t, d.readReplica(ctx, TxOptions{}))
+		assert.Nil(t, d.readReplica(ctx, TxOptions{ReadOnly: true, Isolation: IsolationSerializable}))
+		assert.Nil(t, d.readReplica(ReadFromPrimary(ctx), readOnly))
+		assert.Nil(t, (&dbo{replicas: []*replica{newReplica("a", false)}}).readReplica(ctx, readOnly))
+		assert.Nil(t, (&dbo{}).readReplica(ctx, readOnly))
+	})
+}
+
+func TestReplicaPoolConfigs(t *testing.T) {
+	cfg := config.DatabaseConfig{
+		Host:            "primary",
+		Port:            5432,
+		User:            "postgres",
+		Name:            "zumi",
+		ApplicationName: "books",
+		Replicas: []config.DatabaseReplicaConfig{
+			{Host: "replica-1"},
+			{Host: "replica-2", Port: 5433},
+		},
+	}
+
+	poolCfgs, err := replicaPoolConfigs(cfg)
+	assert.NoError(t, err)
+	assert.Len(t, poolCfgs, 2)
+	assert.Equal(t, "replica-1", poolCfgs[0].ConnConfig.Host)
+	assert.Equal(t, uint16(5432), poolCfgs[0].ConnConfig.Port)
+	assert.Equal(t, "replica-2", poolCfgs[1].ConnConfig.Host)
+	assert.Equal(t, uint16(5433), poolCfgs[1].ConnConfig.Port)
+	assert.Equal(t, "books", poolCfgs[1].ConnConfig.RuntimeParams["application_name"])
+
+	cfg.DSN = "postgres://postgres@primary:5432/zumi"
+
+	_, err = replicaPoolConfigs(cfg)
+	assert.Error(t, err)
+}
+
+func TestReplicas(t *testing.T) {
+	ctx := context.Background()
+
+	cfg, err := config.FromYAML[config.BaseConfig](cfgYaml)
+	assert.NoError(t, err)
+
+	// the primary serves as a replica, next to a replica which cannot be reached
+	cfg.Database.Replicas = []config.DatabaseReplicaConfig{
+		{Host: cfg.Database.Host},
+		{Host: cfg.Database.Host, Port: 1},
+	}
+
+	db, err := NewDatabase(ctx, cfg.Database, testMigrations)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Disconnect()
+	})
+
+	d := db.(*dbo)
+	assert.True(t, d.replicas[0].healthy.Load())
+	assert.False(t, d.replicas[1].healthy.Load())
+
+	for range 3 {
+		err = db.WithReadTX(ctx, func(tx DBTX) error {
+			var inRecovery bool
+			return tx.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery)
+		})
+		assert.NoError(t, err)
+	}
+
+	// a replica which fails to begin a transaction is marked unhealthy and fails over to the primary
+	d.replicas[1].healthy.Store(true)
+	d.replicas[0].healthy.Store(false)
+
+	err = db.WithReadTX(ctx, func(tx DBTX) error { return nil })
+	assert.NoError(t, err)
+	assert.False(t, d.replicas[1].healthy.Load())
+
+	d.healthCheckReplicas(ctx)
+	assert.True(t, d.replicas[0].healthy.Load())
+	assert.False(t, d.replicas[1].healthy.Load())
+}
@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Defaults of a repository.
+const (
+	DefaultIDColumn      = "id" // The primary key column of a repository which has none
+	DefaultSaveBatchSize = 500  // The number of rows inserted by a statement of SaveAll
+)
+
+// maxQueryArgs is the maximum number of arguments of a Postgres statement.
+const maxQueryArgs = 65535
+
+// Repository provides the CRUD operations of the entities of type T in a table, identified by a primary key of type ID.
+// The columns are the `db` tags of T, which must include the primary key column.
+// Any of the queries can be overridden, e.g: to select from a view or to soft delete.
+//
+// Example usage:
+//
+//	var books = database.Repository[Book, int]{
+//	    Table:      "books",
+//	    Filterable: database.Filterable{"title": {Expression: "title", Operators: []database.FilterOperator{database.FilterEq}}},
+//	}
+//
+//	book, err := books.Save(ctx, tx, Book{Title: "Dune"})
+//	page, err := books.FindAll(ctx, tx, pageRequest, filter)
+type Repository[T any, ID any] struct {
+	Table      string            // The table of the entities
+	IDColumn   string            // The primary key column, defaults to DefaultIDColumn
+	Sortable   Sortable          // The allowed sort fields of FindAll, defaults to the columns of T
+	Filterable Filterable        // The allowed filter fields of FindAll, no field can be filtered on if nil
+	BatchSize  int               // The number of rows inserted by a statement of SaveAll, defaults to DefaultSaveBatchSize
+	Queries    RepositoryQueries // Custom queries replacing the generated queries
+	// The integer column of the version of the entities for optimistic locking, see Save, disabled if empty.
+	// Entities which were not saved yet have version 0, and a custom save query returns no row for a stale version.
+	VersionColumn string
+	Audit         AuditColumns // The auditing columns populated by Save, see DefaultAuditColumns
+}
+
+// RepositoryQueries are custom queries of a Repository. An empty query is generated from the table and columns.
+type RepositoryQueries struct {
+	FindByID   string // Selects the entity with the id $1, e.g: "SELECT * FROM books WHERE id = $1 AND deleted_at IS NULL"
+	FindAll    string // Selects every entity, without ORDER BY, LIMIT and OFFSET, e.g: "SELECT * FROM active_books"
+	Save       string // Upserts an entity with the values of the columns of T in order as arguments, returning the row
+	DeleteByID string // Deletes the entity with the id $1, e.g: "UPDATE books SET deleted_at = now() WHERE id = $1"
+	ExistsByID string // Selects whether the entity with the id $1 exists
+	Count      string // Counts the entities
+}
+
+// FindByID returns the entity with the id, or an error matching ErrNoRows if there is none.
+func (r Repository[T, ID]) FindByID(ctx context.Context, dbtx DBTX, id ID) (T, error) {
+	query := r.Queries.FindByID
+	if query == "" {
+		query = r.selectSQL() + " WHERE " + r.idColumnSQL() + " = $1"
+	}
+
+	entity, err := SelectRow[T](ctx, dbtx, query, id)
+	if err != nil {
+		return entity, fmt.Errorf("failed to find %s by id: %w", r.Table, err)
+	}
+
+	return entity, nil
+}
+
+// FindAll returns a page of the entities, sorted and filtered as requested, see SelectPage.
+func (r Repository[T, ID]) FindAll(ctx context.Context, dbtx DBTX, pageRequest PageRequest, filter Filter) (Page[T], error) {
+	query := r.Queries.FindAll
+	if query == "" {
+		query = r.selectSQL()
+	}
+
+	page, err := SelectPage[T](ctx, dbtx, PageQuery{
+		Request:    pageRequest,
+		Query:      query,
+		Sortable:   r.Sortable,
+		Filter:     filter,
+		Filterable: r.Filterable,
+	})
+	if err != nil {
+		return page, fmt.Errorf("failed to find %s: %w", r.Table, err)
+	}
+
+	return page, nil
+}
+
+// Save inserts the entity, or updates it if an entity with its id exists, and returns the saved row.
+// An entity with a zero id is inserted with the default id of the table, e.g: a serial or generated id.
+// Constraint violations are returned as a ConstraintError.
+//
+// With a version column, the row is only updated if it has the version of the entity, and its version is incremented,
+// so that concurrent updates do not overwrite each other. Otherwise a StaleVersionError is returned,
+// which is also returned when an entity with version 0 has the id of an existing row.
+// The auditing columns are populated, and the creation columns of an updated row are kept.
+func (r Repository[T, ID]) Save(ctx context.Context, dbtx DBTX, entity T) (T, error) {
+	query, args := r.Queries.Save, r.values(entity)
+	if query == "" {
+		query, args = r.saveSQL(ctx, []T{entity})
+	}
+
+	saved, err := SelectRow[T](ctx, dbtx, query, args...)
+	if errors.Is(err, ErrNoRows) && r.VersionColumn != "" {
+		return saved, r.staleVersion(entity)
+	}
+
+	if err != nil {
+		return saved, fmt.Errorf("failed to save %s: %w", r.Table, ClassifyError(err))
+	}
+
+	return saved, nil
+}
+
+// SaveAll saves the entities like Save, inserting them in batches of a single statement each,
+// and returns the saved rows in the order of the entities.
+// The entities of a batch must have unique ids, as a row cannot be updated twice by a statement.
+// Versioned entities are saved one at a time instead, so that the entity with a stale version is reported.
+func (r Repository[T, ID]) SaveAll(ctx context.Context, dbtx DBTX, entities []T) ([]T, error) {
+	saved := make([]T, 0, len(entities))
+
+	// a custom save query only saves one entity
+	if r.Queries.Save != "" || r.VersionColumn != "" {
+		for _, entity := range entities {
+			row, err := r.Save(ctx, dbtx, entity)
+			if err != nil {
+				return saved, err
+			}
+
+			saved = append(saved, row)
+		}
+
+		return saved, nil
+	}
+
+	batchSize := r.batchSize()
+
+	for start := 0; start < len(entities); start += batchSize {
+		query, args := r.saveSQL(ctx, entities[start:min(start+batchSize, len(entities))])
+
+		rows, err := SelectRows[T](ctx, dbtx, query, args...)
+		if err != nil {
+			return saved, fmt.Errorf("failed to save %s: %w", r.Table, ClassifyError(err))
+		}
+
+		saved = append(saved, rows...)
+	}
+
+	return saved, nil
+}
+
+// DeleteByID deletes the entity with the id, and returns whether it existed.
+func (r Repository[T, ID]) DeleteByID(ctx context.Context, dbtx DBTX, id ID) (bool, error) {
+	query := r.Queries.DeleteByID
+	if query == "" {
+		query = "DELETE FROM " + r.tableSQL() + " WHERE " + r.idColumnSQL() + " = $1"
+	}
+
+	tag, err := dbtx.Exec(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete %s by id: %w", r.Table, ClassifyError(err))
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ExistsByID returns whether an entity with the id exists.
+func (r Repository[T, ID]) ExistsByID(ctx context.Context, dbtx DBTX, id ID) (bool, error) {
+	query := r.Queries.ExistsByID
+	if query == "" {
+		query = "SELECT EXISTS (SELECT 1 FROM " + r.tableSQL() + " WHERE " + r.idColumnSQL() + " = $1)"
+	}
+
+	var exists bool
+
+	err := dbtx.QueryRow(ctx, query, id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if %s exists: %w", r.Table, err)
+	}
+
+	return exists, nil
+}
+
+// Count returns the number of entities.
+func (r Repository[T, ID]) Count(ctx context.Context, dbtx DBTX) (int64, error) {
+	query := r.Queries.Count
+	if query == "" {
+		query = "SELECT COUNT(*) FROM " + r.tableSQL()
+	}
+
+	var count int64
+
+	err := dbtx.QueryRow(ctx, query).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", r.Table, err)
+	}
+
+	return count, nil
+}
+
+// selectSQL selects the columns of T from the table.
+func (r Repository[T, ID]) selectSQL() string {
+	return "SELECT " + entityOf[T]().columnsSQL + " FROM " + r.tableSQL()
+}
+
+// saveSQL builds the upsert of the entities, numbering the placeholders of every row after those of the previous rows.
+// A zero id is inserted as DEFAULT, so that the table generates it. The version is inserted incremented,
+// and a row is only updated if it has the version before. The auditing columns are populated from the context.
+func (r Repository[T, ID]) saveSQL(ctx context.Context, entities []T) (string, []any) {
+	entity := entityOf[T]()
+	idColumn := r.idColumn()
+	principal, hasPrincipal := PrincipalFrom(ctx)
+
+	rows := make([]string, 0, len(entities))
+	args := make([]any, 0, len(entities)*len(entity.fields))
+
+	for _, e := range entities {
+		value := reflect.ValueOf(e)
+		placeholders := make([]string, 0, len(entity.fields))
+
+		for _, field := range entity.fields {
+			fieldValue := value.FieldByIndex(field.index)
+
+			switch {
+			case field.column == idColumn && fieldValue.IsZero():
+				placeholders = append(placeholders, "DEFAULT")
+				continue
+			case field.column == r.Audit.CreatedAt || field.column == r.Audit.UpdatedAt:
+				placeholders = append(placeholders, "now()")
+				continue
+			case field.column == r.Audit.CreatedBy && hasPrincipal:
+				args = append(args, principal)
+			case field.column == r.VersionColumn:
+				args = append(args, versionOf(fieldValue)+1)
+			default:
+				args = append(args, fieldValue.Interface())
+			}
+
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+
+		rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	updates := []string{}
+
+	for _, field := range entity.fields {
+		if field.column != idColumn && field.column != r.Audit.CreatedAt && field.column != r.Audit.CreatedBy {
+			column := pgx.Identifier{field.column}.Sanitize()
+			updates = append(updates, column+" = EXCLUDED."+column)
+		}
+	}
+
+	// the id is set to itself when there is no other column, so that the existing row is returned
+	if len(updates) == 0 {
+		updates = append(updates, r.idColumnSQL()+" = EXCLUDED."+r.idColumnSQL())
+	}
+
+	query := "INSERT INTO " + r.tableSQL() + " (" + entity.columnsSQL + ") VALUES " + strings.Join(rows, ", ") +
+		" ON CONFLICT (" + r.idColumnSQL() + ") DO UPDATE SET " + strings.Join(updates, ", ")
+
+	if r.VersionColumn != "" {
+		version := pgx.Identifier{r.VersionColumn}.Sanitize()
+		query += " WHERE " + r.tableSQL() + "." + version + " = EXCLUDED." + version + " - 1"
+	}
+
+	query += " RETURNING " + entity.columnsSQL
+
+	return query, args
+}
+
+// staleVersion returns the error of saving the entity with a stale version.
+func (r Repository[T, ID]) staleVersion(e T) error {
+	staleErr := &StaleVersionError{Table: r.Table}
+	value := reflect.ValueOf(e)
+
+	for _, field := range entityOf[T]().fields {
+		switch field.column {
+		case r.idColumn():
+			staleErr.ID = value.FieldByIndex(field.index).Interface()
+		case r.VersionColumn:
+			staleErr.Version = versionOf(value.FieldByIndex(field.index))
+		}
+	}
+
+	return staleErr
+}
+
+// versionOf returns the value of the integer field of a version.
+func versionOf(value reflect.Value) int64 {
+	if value.CanUint() {
+		return int64(value.Uint()) //nolint:gosec
+	}
+
+	return value.Int()
+}
+
+// values returns the values of the columns of the entity in order, the arguments of a custom save query.
+func (r Repository[T, ID]) values(e T) []any {
+	entity := entityOf[T]()
+	value := reflect.ValueOf(e)
+
+	values := make([]any, 0, len(entity.fields))
+	for _, field := range entity.fields {
+		values = append(values, value.FieldByIndex(field.index).Interface())
+	}
+
+	return values
+}
+
+// batchSize returns the number of rows inserted by a statement, within the maximum number of arguments.
+func (r Repository[T, ID]) batchSize() int {
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultSaveBatchSize
+	}
+
+	return max(min(batchSize, maxQueryArgs/max(len(entityOf[T]().fields), 1)), 1)
+}
+
+func (r Repository[T, ID]) idColumn() string {
+	if r.IDColumn == "" {
+		return DefaultIDColumn
+	}
+
+	return r.IDColumn
+}
+
+func (r Repository[T, ID]) idColumnSQL() string {
+	return pgx.Identifier{r.idColumn()}.Sanitize()
+}
+
+// tableSQL quotes the table, which may be qualified by its schema, e.g: "library.books".
+func (r Repository[T, ID]) tableSQL() string {
+	return pgx.Identifier(strings.Split(r.Table, ".")).Sanitize()
+}
+
+// entity describes the columns of an entity type, computed once per type.
+type entity struct {
+	fields     []dbField
+	columnsSQL string // The quoted columns separated by commas
+}
+
+var entityCache sync.Map // map[reflect.Type]*entity
+
+// entityOf returns the columns of the entity type T.
+func entityOf[T any]() *entity {
+	return entityFor(reflect.TypeFor[T]())
+}
+
+// entityFor returns the columns of the struct type.
+func entityFor(typ reflect.Type) *entity {
+	if cached, ok := entityCache.Load(typ); ok {
+		return cached.(*entity) //nolint:forcetypeassert
+	}
+
+	fields := dbFields(typ, nil)
+
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, pgx.Identifier{field.column}.Sanitize())
+	}
+
+	cached, _ := entityCache.LoadOrStore(typ, &entity{fields: fields, columnsSQL: strings.Join(columns, ", ")})
+
+	return cached.(*entity) //nolint:forcetypeassert
+}
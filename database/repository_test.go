@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositorySQL(t *testing.T) {
+	ctx := context.Background()
+
+	type Audited struct {
+		CreatedBy string `db:"created_by"`
+	}
+
+	type Author struct {
+		Audited
+
+		UUID    uuid.UUID `db:"uuid"`
+		Name    string    `db:"name"`
+		Ignored string    `db:"-"`
+	}
+
+	books := Repository[Book, int]{Table: "books"}
+	authors := Repository[Author, uuid.UUID]{Table: "library.authors", IDColumn: "uuid"}
+
+	t.Run("select", func(t *testing.T) {
+		assert.Equal(t, `SELECT "id", "title", "description" FROM "books"`, books.selectSQL())
+		assert.Equal(t, `SELECT "created_by", "uuid", "name" FROM "library"."authors"`, authors.selectSQL())
+	})
+
+	t.Run("save with default id", func(t *testing.T) {
+		query, args := books.saveSQL(ctx, []Book{{Title: "Dune", Description: "Spice"}, {ID: 7, Title: "Emma", Description: "Novel"}})
+
+		assert.Equal(t, `INSERT INTO "books" ("id", "title", "description") VALUES (DEFAULT, $1, $2), ($3, $4, $5)`+
+			` ON CONFLICT ("id") DO UPDATE SET "title" = EXCLUDED."title", "description" = EXCLUDED."description"`+
+			` RETURNING "id", "title", "description"`, query)
+		assert.Equal(t, []any{"Dune", "Spice", 7, "Emma", "Novel"}, args)
+	})
+
+	t.Run("save with embedded columns", func(t *testing.T) {
+		id := uuid.New()
+
+		query, args := authors.saveSQL(ctx, []Author{{Audited: Audited{CreatedBy: "admin"}, UUID: id, Name: "Frank"}})
+
+		assert.Equal(t, `INSERT INTO "library"."authors" ("created_by", "uuid", "name") VALUES ($1, $2, $3)`+
+			` ON CONFLICT ("uuid") DO UPDATE SET "created_by" = EXCLUDED."created_by", "name" = EXCLUDED."name"`+
+			` RETURNING "created_by", "uuid", "name"`, query)
+		assert.Equal(t, []any{"admin", id, "Frank"}, args)
+		assert.Equal(t, []any{"admin", id, "Frank"}, authors.values(Author{Audited: Audited{CreatedBy: "admin"}, UUID: id, Name: "Frank"}))
+	})
+
+	t.Run("save of id only", func(t *testing.T) {
+		type Tag struct {
+			ID string `db:"id"`
+		}
+
+		query, _ := Repository[Tag, string]{Table: "tags"}.saveSQL(ctx, []Tag{{ID: "go"}})
+
+		assert.Equal(t, `INSERT INTO "tags" ("id") VALUES ($1) ON CONFLICT ("id") DO UPDATE SET "id" = EXCLUDED."id" RETURNING "id"`, query)
+	})
+
+	t.Run("save with version and audit columns", func(t *testing.T) {
+		type Article struct {
+			ID        int       `db:"id"`
+			Title     string    `db:"title"`
+			Version   int       `db:"version"`
+			CreatedAt time.Time `db:"created_at"`
+			UpdatedAt time.Time `db:"updated_at"`
+			CreatedBy string    `db:"created_by"`
+		}
+
+		articles := Repository[Article, int]{Table: "articles", VersionColumn: "version", Audit: DefaultAuditColumns}
+
+		query, args := articles.saveSQL(ContextWithPrincipal(ctx, "alice"), []Article{{ID: 3, Title: "Go", Version: 2, CreatedBy: "bob"}})
+
+		assert.Equal(t, `INSERT INTO "articles" ("id", "title", "version", "created_at", "updated_at", "created_by")`+
+			` VALUES ($1, $2, $3, now(), now(), $4)`+
+			` ON CONFLICT ("id") DO UPDATE SET "title" = EXCLUDED."title", "version" = EXCLUDED."version",`+
+			` "updated_at" = EXCLUDED."updated_at"`+
+			` WHERE "articles"."version" = EXCLUDED."version" - 1`+
+			` RETURNING "id", "title", "version", "created_at", "updated_at", "created_by"`, query)
+		assert.Equal(t, []any{3, "Go", int64(3), "alice"}, args)
+
+		// without a principal, the creator of the entity is inserted
+		_, args = articles.saveSQL(ctx, []Article{{Title: "Go", CreatedBy: "bob"}})
+		assert.Equal(t, []any{"Go", int64(1), "bob"}, args)
+
+		err := articles.staleVersion(Article{ID: 3, Version: 2})
+		assert.ErrorIs(t, err, ErrStaleVersion)
+		assert.EqualError(t, err, "articles 3 was modified concurrently, version 2 is stale")
+	})
+
+	t.Run("batch size", func(t *testing.T) {
+		assert.Equal(t, DefaultSaveBatchSize, books.batchSize())
+		assert.Equal(t, 10, Repository[Book, int]{BatchSize: 10}.batchSize())
+		assert.Equal(t, maxQueryArgs/3, Repository[Book, int]{BatchSize: 100_000}.batchSize())
+	})
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+	conn := db.Conn(ctx)
+
+	books := Repository[Book, int]{Table: "books"}
+
+	t.Run("save, find, exist and delete", func(t *testing.T) {
+		book, err := books.Save(ctx, conn, Book{Title: uuid.NewString(), Description: "Created"})
+		require.NoError(t, err)
+		assert.NotZero(t, book.ID)
+
+		book.Description = "Updated"
+
+		updated, err := books.Save(ctx, conn, book)
+		require.NoError(t, err)
+		assert.Equal(t, book, updated)
+
+		found, err := books.FindByID(ctx, conn, book.ID)
+		require.NoError(t, err)
+		assert.Equal(t, book, found)
+
+		exists, err := books.ExistsByID(ctx, conn, book.ID)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		deleted, err := books.DeleteByID(ctx, conn, book.ID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		deleted, err = books.DeleteByID(ctx, conn, book.ID)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+
+		_, err = books.FindByID(ctx, conn, book.ID)
+		assert.ErrorIs(t, err, ErrNoRows)
+	})
+
+	t.Run("save all and find all", func(t *testing.T) {
+		description := uuid.NewString()
+
+		saved, err := Repository[Book, int]{Table: "books", BatchSize: 2}.SaveAll(ctx, conn, []Book{
+			{Title: "a", Description: description},
+			{Title: "b", Description: description},
+			{Title: "c", Description: description},
+		})
+		require.NoError(t, err)
+		require.Len(t, saved, 3)
+
+		count, err := books.Count(ctx, conn)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, count, int64(3))
+
+		filtered := Repository[Book, int]{
+			Table:      "books",
+			Filterable: Filterable{"description": {Expression: "description", Operators: []FilterOperator{FilterEq}}},
+		}
+
+		page, err := filtered.FindAll(ctx, conn, PageRequest{Size: 2, Sort: []string{"title,desc"}}, Filter{
+			{Field: "description", Operator: FilterEq, Values: []string{description}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), page.TotalElements)
+		assert.Equal(t, []string{"c", "b"}, []string{page.Content[0].Title, page.Content[1].Title})
+	})
+
+	t.Run("optimistic locking and auditing", func(t *testing.T) {
+		type Article struct {
+			ID        int       `db:"id"`
+			Title     string    `db:"title"`
+			Version   int64     `db:"version"`
+			CreatedAt time.Time `db:"created_at"`
+			UpdatedAt time.Time `db:"updated_at"`
+			CreatedBy string    `db:"created_by"`
+		}
+
+		articles := Repository[Article, int]{Table: "articles", VersionColumn: "version", Audit: DefaultAuditColumns}
+
+		err := db.Transactional(ContextWithPrincipal(ctx, "alice"), TxOptions{}, func(ctx context.Context) error {
+			err := ExecQuery(ctx, db.Conn(ctx), `CREATE TEMPORARY TABLE articles (
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	version BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	created_by TEXT NOT NULL
+) ON COMMIT DROP`)
+			require.NoError(t, err)
+
+			created, err := articles.Save(ctx, db.Conn(ctx), Article{Title: "Draft"})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), created.Version)
+			assert.Equal(t, "alice", created.CreatedBy)
+			assert.False(t, created.CreatedAt.IsZero())
+
+			edit := created
+			edit.Title = "Edited"
+
+			updated, err := articles.Save(ContextWithPrincipal(ctx, "bob"), db.Conn(ctx), edit)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), updated.Version)
+			assert.Equal(t, "Edited", updated.Title)
+			assert.Equal(t, "alice", updated.CreatedBy)
+			assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+			// the concurrent edit of the same version is stale
+			_, err = articles.SaveAll(ctx, db.Conn(ctx), []Article{edit})
+
+			var staleErr *StaleVersionError
+			require.ErrorAs(t, err, &staleErr)
+			assert.Equal(t, &StaleVersionError{Table: "articles", ID: created.ID, Version: 1}, staleErr)
+
+			// a new entity does not overwrite an existing row
+			_, err = articles.Save(ctx, db.Conn(ctx), Article{ID: created.ID, Title: "New"})
+			require.ErrorIs(t, err, ErrStaleVersion)
+
+			found, err := articles.FindByID(ctx, db.Conn(ctx), created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Edited", found.Title)
+
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("custom queries", func(t *testing.T) {
+		title := uuid.NewString()
+
+		custom := Repository[Book, int]{Table: "books", Queries: RepositoryQueries{
+			Count: "SELECT COUNT(*) FROM books WHERE title = '" + title + "'",
+		}}
+
+		_, err := custom.Save(ctx, conn, Book{Title: title, Description: "Custom"})
+		require.NoError(t, err)
+
+		count, err := custom.Count(ctx, conn)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+}
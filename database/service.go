@@ -2,20 +2,19 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/SeaRoll/zumi/config"
+	"github.com/SeaRoll/zumi/database/migrate"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
-	"github.com/pressly/goose/v3"
 )
 
 var ErrNoRows = pgx.ErrNoRows
@@ -23,125 +22,92 @@ var ErrNoRows = pgx.ErrNoRows
 //go:generate go run github.com/SeaRoll/interfacer/cmd -struct=dbo -name=Database -file=service_interface.go
 
 type dbo struct {
-	connectionUrl string
-	migrations    fs.FS
-	pool          *pgxpool.Pool
-	isTeardown    atomic.Bool
+	poolConfig      *pgxpool.Config
+	migrations      fs.FS
+	goMigrations    []Migration
+	migrationConfig config.DatabaseMigrationConfig
+	pool            atomic.Pointer[pgxpool.Pool] // swapped by the reconnect loop while requests read it
+	replicas        []*replica
+	nextReplica     atomic.Uint64
+	reconnectPolicy reconnectPolicy
+	state           healthState
+	teardown        context.Context    // done when the database is torn down, nil until the reconnect loop is started
+	stopReconnect   context.CancelFunc // stops the reconnect loop, nil until it is started
+	reconnectDone   chan struct{}      // closed when the reconnect loop exits
+	draining        sync.WaitGroup     // the old pools which are closed once their connections are released
+	sessions        sync.WaitGroup     // the dedicated connections of Listen and RunLeaderElection
 }
 
-// NewDatabase creates a new database connection pool and runs migrations.
-// It takes a context for the connection, a connection URL, and a filesystem containing migration files.
+// NewDatabase creates a new database connection pool and runs migrations, unless auto-migrate is disabled.
+// It takes a context for the connection, the database configuration, a filesystem containing migration files,
+// which may be nil if the database has no SQL migrations, and the migrations coded in Go.
 // It returns a Database interface or an error if the connection or migration fails.
 func NewDatabase(
 	ctx context.Context,
 	cfg config.DatabaseConfig,
 	migrations fs.FS,
+	goMigrations ...Migration,
 ) (Database, error) {
 	if !cfg.Enabled {
 		return nil, errors.New("database is not enabled in the configuration")
 	}
 
-	connectionUrl := fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.Name,
-	)
-
-	d := &dbo{
-		connectionUrl: connectionUrl,
-		migrations:    migrations,
-		isTeardown:    atomic.Bool{},
-	}
-
-	err := d.connectAndMigratePool(ctx)
+	poolCfg, err := PoolConfig(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect and migrate pool: %w", err)
+		return nil, err
 	}
 
-	d.runReconnect()
-
-	return d, nil
-}
-
-// runReconnect starts a goroutine that periodically checks the health of the database connection pool.
-func (d *dbo) runReconnect() {
-	// create go coroutine to check every dbs health
-	// if any db is not healthy, try to reconnect
-	go func() {
-		for {
-			// check if tearing down is requested
-			if d.isTeardown.Load() {
-				slog.Info("db is being torn down, skipping health check")
-				return
-			}
-
-			d.healthCheckPool()
-			time.Sleep(5 * time.Second)
-		}
-	}()
-}
-
-// healthCheckPool checks the health of the database connection pool.
-func (d *dbo) healthCheckPool() {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	err := d.pool.Ping(ctx)
+	replicaPoolCfgs, err := replicaPoolConfigs(cfg)
 	if err != nil {
-		slog.Error("db is not healthy", "error", err)
-
-		err := d.connectAndMigratePool(ctx)
-		if err != nil {
-			slog.Error("failed to reconnect to db", "error", err)
-		} else {
-			slog.Info("reconnected to db")
-		}
+		return nil, err
 	}
-}
 
-// connectAndMigratePool connects to the database and runs migrations.
-// It constructs the database URL from the configuration, parses it, and creates a connection pool.
-func (d *dbo) connectAndMigratePool(ctx context.Context) error {
-	// give 15 seconds for the db to be ready
-	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
-	defer cancel()
+	d := &dbo{
+		poolConfig:      poolCfg,
+		migrations:      migrations,
+		goMigrations:    goMigrations,
+		migrationConfig: cfg.Migrations,
+		reconnectPolicy: defaultReconnectPolicy,
+	}
 
-	config, err := pgxpool.ParseConfig(d.connectionUrl)
+	pool, err := d.newPool(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to parse database config: %w", err)
+		return nil, fmt.Errorf("failed to connect pool: %w", err)
 	}
 
-	pool, err := pgxpool.NewWithConfig(ctx, config)
+	d.pool.Store(pool)
+	d.markHealthy()
+
+	err = d.runMigrations(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create database connection pool: %w", err)
+		d.Disconnect()
+		return nil, fmt.Errorf("failed to run database migrations: %w", err)
 	}
 
-	dbo := stdlib.OpenDBFromPool(pool)
-
-	err = migrate(dbo, d.migrations)
+	err = d.connectReplicas(ctx, replicaPoolCfgs)
 	if err != nil {
-		return fmt.Errorf("failed to run database migrations: %w", err)
+		d.Disconnect()
+		return nil, err
 	}
 
-	d.pool = pool
+	d.runReconnect()
 
-	return nil
+	return d, nil
 }
 
-// migrate runs the database migrations using goose.
-func migrate(db *sql.DB, migrations fs.FS) error {
-	// setup database connection
-	goose.SetBaseFS(migrations)
+// runMigrations applies the pending migrations, unless there are none or auto-migrate is disabled.
+// Only one instance of a service at a time migrates the database, see the migrate package.
+func (d *dbo) runMigrations(ctx context.Context) error {
+	if (d.migrations == nil && len(d.goMigrations) == 0) || d.migrationConfig.DisableAutoMigrate {
+		return nil
+	}
 
-	err := goose.SetDialect("postgres")
+	migrator, err := migrate.New(stdlib.OpenDBFromPool(d.pool.Load()), d.migrations, d.migrationConfig, GoMigrations(d.goMigrations...)...)
 	if err != nil {
-		return fmt.Errorf("failed to set goose dialect: %w", err)
+		return fmt.Errorf("failed to create migrator: %w", err)
 	}
 
-	err = goose.Up(db, "migrations")
+	_, err = migrator.Up(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
@@ -149,61 +115,88 @@ func migrate(db *sql.DB, migrations fs.FS) error {
 	return nil
 }
 
-// Disconnect closes the database connection pool and sets the teardown flag to true.
+// Disconnect closes the database connection pool.
 // This method should be called when the application is shutting down to ensure all resources are released properly.
-// It sets the isTeardown flag to true to indicate that the database connection is being torn down.
-// This prevents any further operations on the database connection pool after it has been closed.
+// It stops the health checks, reconnects, listeners and leader elections, and waits for the old pools replaced by reconnects to be closed.
 //
-// If `noTeardown` is true, it will not set the teardown flag,
-// allowing the client to be reused later.
-// // If `noTeardown` is false or not provided, it will set the teardown flag
-// and close the client connection, preventing any further operations.
+// If `noTeardown` is true, only the connection pool is closed and the health checks keep running,
+// so that the pool is reconnected and the database can be reused later.
+// If `noTeardown` is false or not provided, the replica pools are closed as well,
+// preventing any further operations.
 func (d *dbo) Disconnect(noTeardown ...bool) {
-	if len(noTeardown) == 0 || !noTeardown[0] {
-		d.isTeardown.Store(true) // Set teardown flag to true
+	if len(noTeardown) > 0 && noTeardown[0] {
+		d.pool.Load().Close()
+		slog.Info("Database connection pool closed")
+
+		return
 	}
 
-	d.pool.Close()
+	if d.stopReconnect != nil {
+		d.stopReconnect()
+		<-d.reconnectDone
+	}
+
+	d.sessions.Wait()
+
+	d.pool.Load().Close()
+
+	for _, r := range d.replicas {
+		r.pool.Close()
+	}
+
+	d.draining.Wait()
+
 	slog.Info("Database connection pool closed")
 }
 
 // WithReadTX executes a function within a read-only database transaction context.
-// If an existing transaction is provided via existingQ, it uses that instead of creating a new transaction.
+// A new transaction begins on a healthy replica if replicas are configured, failing over to the primary,
+// unless the context is created by ReadFromPrimary.
+// If an existing transaction is provided via existingQ, or the context carries a transaction (see Transactional),
+// it nests a transaction in it using a savepoint instead of creating a new transaction.
 // Otherwise, it begins a new read-only transaction, executes the provided function with the transaction-aware dbtx,
 // and commits the transaction on success or rolls back on error.
 // The function automatically handles transaction cleanup through deferred rollback.
 // This method is optimized for read operations and may provide better performance for queries that don't modify data.
+// The transaction is only passed to the function, not stored in a context, so Conn and Transactional do not see it.
+// Use Transactional with TxOptions.ReadOnly to carry the transaction in the context passed to the function instead.
 //
 // Parameters:
 //   - ctx: Context for the transaction operation
 //   - fn: Function to execute within the transaction, receives a transaction interface
-//   - existingQ: Optional existing transaction to reuse instead of creating a new transaction
+//   - existingQ: Optional existing transaction to nest the transaction in
 //
 // Returns:
 //   - error: Any error from transaction operations or the executed function
 func (d *dbo) WithReadTX(ctx context.Context, fn func(tx DBTX) error, existingQ ...DBTX) error {
-	return d.runTransactionWithOpts(ctx, fn, pgx.TxOptions{AccessMode: pgx.ReadOnly}, existingQ...)
+	return d.runTransactionWithOpts(ctx, fn, TxOptions{ReadOnly: true}, existingQ...)
 }
 
 // WithTX executes a function within a database transaction context.
-// If an existing transaction is provided via existingQ, it uses that instead of creating a new transaction.
+// If an existing transaction is provided via existingQ, or the context carries a transaction (see Transactional),
+// it nests a transaction in it using a savepoint instead of creating a new transaction,
+// so that an error only rolls back the changes of the function.
 // Otherwise, it begins a new read-write transaction, executes the provided function with the transaction-aware dbtx,
 // and commits the transaction on success or rolls back on error.
 // The function automatically handles transaction cleanup through deferred rollback.
+// Nesting in a transaction started by WithReadTX returns ErrReadOnlyTransaction.
+// The transaction is only passed to the function, not stored in a context, so Conn and Transactional do not see it.
+// Use Transactional to carry the transaction in the context passed to the function instead.
 //
 // Parameters:
 //   - ctx: Context for the transaction operation
 //   - fn: Function to execute within the transaction, receives a transaction interface
-//   - existingQ: Optional existing transaction to reuse instead of creating a new transaction
+//   - existingQ: Optional existing transaction to nest the transaction in
 //
 // Returns:
 //   - error: Any error from transaction operations or the executed function
 func (d *dbo) WithTX(ctx context.Context, fn func(tx DBTX) error, existingQ ...DBTX) error {
-	return d.runTransactionWithOpts(ctx, fn, pgx.TxOptions{AccessMode: pgx.ReadWrite}, existingQ...)
+	return d.runTransactionWithOpts(ctx, fn, TxOptions{}, existingQ...)
 }
 
 // runTransactionWithOpts executes a function within a transaction context with specified options.
-// If an existing tx is provided via existingQ, it uses that instead of creating a new transaction.
+// If an existing tx is provided via existingQ, or the context carries a transaction of the database,
+// it begins a nested transaction on it with a savepoint, so that an error of the function only rolls back to the savepoint.
 // Otherwise, it begins a new transaction with the provided options, executes the function with the transaction-aware dbtx,
 // and commits the transaction on success or rolls back on error.
 // The function automatically handles transaction cleanup through deferred rollback.
@@ -212,35 +205,28 @@ func (d *dbo) WithTX(ctx context.Context, fn func(tx DBTX) error, existingQ ...D
 //   - ctx: Context for the transaction operation
 //   - fn: Function to execute within the transaction, receives a DBTX interface
 //   - opts: Transaction options to configure the transaction behavior
-//   - existingQ: Optional existing tx to reuse instead of creating a new transaction
+//   - existingQ: Optional existing tx to nest the transaction in instead of creating a new transaction
 //
 // Returns:
 //   - error: Any error from transaction operations or the executed function
-func (d *dbo) runTransactionWithOpts(ctx context.Context, fn func(tx DBTX) error, opts pgx.TxOptions, existingQ ...DBTX) error {
-	if len(existingQ) > 0 {
-		return fn(existingQ[0])
-	}
-
-	tx, err := d.pool.BeginTx(ctx, opts)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-
-	defer func() {
-		_ = tx.Rollback(ctx)
-	}()
+func (d *dbo) runTransactionWithOpts(ctx context.Context, fn func(tx DBTX) error, opts TxOptions, existingQ ...DBTX) error {
+	var outer pgx.Tx
 
-	err = fn(tx)
-	if err != nil {
-		return fmt.Errorf("transaction function failed: %w", err)
-	}
+	if len(existingQ) > 0 {
+		tx, ok := existingQ[0].(pgx.Tx)
+		if !ok {
+			// not a transaction, e.g: a fake DBTX or the pool itself
+			return fn(existingQ[0])
+		}
 
-	err = tx.Commit(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		outer = tx
+	} else if ambient := d.ambientTx(ctx); ambient != nil {
+		outer = ambient
 	}
 
-	return nil
+	return d.runTransaction(ctx, outer, opts, func(tx *transaction) error {
+		return fn(tx)
+	})
 }
 
 // SelectRow executes a query and returns a single row as a struct of type T.
@@ -292,9 +278,11 @@ func ExecQuery(ctx context.Context, dbtx DBTX, query string, args ...any) error
 }
 
 // DBTX is an interface that defines the methods for executing queries and transactions.
-// only supports pgx package related methods.
+// only supports pgx package related methods, which pools, connections and transactions implement.
 type DBTX interface {
 	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
 	Query(context.Context, string, ...any) (pgx.Rows, error)
 	QueryRow(context.Context, string, ...any) pgx.Row
+	CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error)
+	SendBatch(context.Context, *pgx.Batch) pgx.BatchResults
 }
@@ -5,41 +5,130 @@ import "context"
 
 // Database defines the public interface for dbo.
 type Database interface {
-	// Disconnect closes the database connection pool and sets the teardown flag to true.
+	// Conn returns the transaction of the database carried by the context, or the pool of the database.
+	//
+	// Example usage:
+	//
+	// err := db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+	// return database.ExecQuery(ctx, db.Conn(ctx), "DELETE FROM books WHERE id = $1", id)
+	// })
+	Conn(ctx context.Context) DBTX
+	// Disconnect closes the database connection pool.
 	// This method should be called when the application is shutting down to ensure all resources are released properly.
-	// It sets the isTeardown flag to true to indicate that the database connection is being torn down.
-	// This prevents any further operations on the database connection pool after it has been closed.
+	// It stops the health checks, reconnects, listeners and leader elections, and waits for the old pools replaced by reconnects to be closed.
 	//
-	// If `noTeardown` is true, it will not set the teardown flag,
-	// allowing the client to be reused later.
-	// // If `noTeardown` is false or not provided, it will set the teardown flag
-	// and close the client connection, preventing any further operations.
+	// If `noTeardown` is true, only the connection pool is closed and the health checks keep running,
+	// so that the pool is reconnected and the database can be reused later.
+	// If `noTeardown` is false or not provided, the replica pools are closed as well,
+	// preventing any further operations.
 	Disconnect(noTeardown ...bool)
+	// Health returns the health of the connection pool, its reconnects and the replicas.
+	Health() Health
+	// Listen listens to a channel on a dedicated connection and calls the handler for each notification received.
+	// It blocks until the context is done or the database is torn down, so run it in a goroutine.
+	// The connection is reconnected with backoff when it is lost and the channel is listened to again,
+	// notifications sent while reconnecting are lost, so the handler should not rely on receiving every notification,
+	// e.g: invalidating a whole cache instead of an entry.
+	//
+	// Example usage:
+	//
+	// go db.Listen(ctx, "books_changed", func(ctx context.Context, n database.Notification) error {
+	// return cache.Invalidate(ctx, n.Payload)
+	// })
+	Listen(ctx context.Context, channel string, handler func(ctx context.Context, n Notification) error) error
+	// OnReconnect registers a listener of the health check and reconnect events, e.g: to export metrics.
+	// The listeners are called by the reconnect loop, so they should return quickly.
+	OnReconnect(listener func(event ReconnectEvent))
+	// RunLeaderElection elects one leader among the instances of a service, which holds the session advisory lock
+	// of the key on a dedicated connection. The other instances try to acquire the lock every interval,
+	// and one of them is elected once the leader disconnects. Leadership is lost when the connection of the leader fails,
+	// and the lock is acquired again after reconnecting with backoff, unless another instance acquired it meanwhile.
+	// It blocks until the context is done or the database is torn down, so run it in a goroutine.
+	//
+	// The connection of the leader is checked every interval, so a leader may not notice that its session was terminated
+	// until the next check, while another instance is elected already. Use a transaction lock of WithAdvisoryLock
+	// for work which must never overlap.
+	//
+	// Example usage:
+	//
+	// go db.RunLeaderElection(ctx, database.LeaderElection{
+	// Key: "scheduler",
+	// OnElected: func(ctx context.Context) {
+	// scheduler.Run(ctx)
+	// },
+	// })
+	RunLeaderElection(ctx context.Context, election LeaderElection) error
+	// Transactional executes a function within a transaction carried by the context passed to it,
+	// so that every Conn, WithTX and WithReadTX call with that context uses the transaction.
+	// The propagation of the options defines how it relates to the transaction already carried by the context,
+	// and the transaction is committed when the function succeeds or rolled back on error.
+	//
+	// Example usage:
+	//
+	// err := db.Transactional(ctx, database.TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+	// books, err = repository.FindBooks(ctx, db.Conn(ctx))
+	// return err
+	// })
+	//
+	// Serializable transactions are retried on serialization failures with the retry options:
+	//
+	// opts := database.TxOptions{Isolation: database.IsolationSerializable, Retry: database.RetryOptions{MaxRetries: 3}}
+	Transactional(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
+	// WithAdvisoryLock executes the function while holding the Postgres advisory lock of the key,
+	// so that it is executed by one instance of a service at a time, e.g: a periodic cleanup.
+	// It waits until the lock is released by other sessions, or the context is done,
+	// unless Try is set, which fails with ErrLockNotAcquired instead.
+	//
+	// A session lock is held on a connection of the pool reserved for the lock,
+	// and released when the function returns, independent of the transactions of the function.
+	// A transaction lock is held by the transaction of the database carried by the context, or by a new transaction
+	// on the primary carried by the context passed to the function, and released when that transaction ends.
+	// It fails with ErrReadOnlyLock if the transaction of the context is read-only.
+	//
+	// Example usage:
+	//
+	// err := db.WithAdvisoryLock(ctx, "cleanup", func(ctx context.Context) error {
+	// return database.ExecQuery(ctx, db.Conn(ctx), "DELETE FROM sessions WHERE expires_at < now()")
+	// }, database.AdvisoryLockOptions{Try: true})
+	// if errors.Is(err, database.ErrLockNotAcquired) {
+	// return nil // another instance is cleaning up
+	// }
+	WithAdvisoryLock(ctx context.Context, key string, fn func(ctx context.Context) error, opts ...AdvisoryLockOptions) error
 	// WithReadTX executes a function within a read-only database transaction context.
-	// If an existing transaction is provided via existingQ, it uses that instead of creating a new transaction.
+	// A new transaction begins on a healthy replica if replicas are configured, failing over to the primary,
+	// unless the context is created by ReadFromPrimary.
+	// If an existing transaction is provided via existingQ, or the context carries a transaction (see Transactional),
+	// it nests a transaction in it using a savepoint instead of creating a new transaction.
 	// Otherwise, it begins a new read-only transaction, executes the provided function with the transaction-aware dbtx,
 	// and commits the transaction on success or rolls back on error.
 	// The function automatically handles transaction cleanup through deferred rollback.
 	// This method is optimized for read operations and may provide better performance for queries that don't modify data.
+	// The transaction is only passed to the function, not stored in a context, so Conn and Transactional do not see it.
+	// Use Transactional with TxOptions.ReadOnly to carry the transaction in the context passed to the function instead.
 	//
 	// Parameters:
 	// - ctx: Context for the transaction operation
 	// - fn: Function to execute within the transaction, receives a transaction interface
-	// - existingQ: Optional existing transaction to reuse instead of creating a new transaction
+	// - existingQ: Optional existing transaction to nest the transaction in
 	//
 	// Returns:
 	// - error: Any error from transaction operations or the executed function
 	WithReadTX(ctx context.Context, fn func(tx DBTX) error, existingQ ...DBTX) error
 	// WithTX executes a function within a database transaction context.
-	// If an existing transaction is provided via existingQ, it uses that instead of creating a new transaction.
+	// If an existing transaction is provided via existingQ, or the context carries a transaction (see Transactional),
+	// it nests a transaction in it using a savepoint instead of creating a new transaction,
+	// so that an error only rolls back the changes of the function.
 	// Otherwise, it begins a new read-write transaction, executes the provided function with the transaction-aware dbtx,
 	// and commits the transaction on success or rolls back on error.
 	// The function automatically handles transaction cleanup through deferred rollback.
+	// Nesting in a transaction started by WithReadTX returns ErrReadOnlyTransaction.
+	// The transaction is only passed to the function, not stored in a context, so Conn and Transactional do not see it.
+	// Use Transactional to carry the transaction in the context passed to the function instead.
 	//
 	// Parameters:
 	// - ctx: Context for the transaction operation
 	// - fn: Function to execute within the transaction, receives a transaction interface
-	// - existingQ: Optional existing transaction to reuse instead of creating a new transaction
+	// - existingQ: Optional existing transaction to nest the transaction in
 	//
 	// Returns:
 	// - error: Any error from transaction operations or the executed function
@@ -3,7 +3,9 @@ package database
 import (
 	"context"
 	"embed"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/SeaRoll/zumi/config"
 	"github.com/google/uuid"
@@ -100,3 +102,334 @@ func TestDatabaseExecSelectOneAndMultiple(t *testing.T) {
 	})
 
 }
+
+func TestNestedTransactions(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+	fnErr := errors.New("failed")
+
+	countBooks := func(tx DBTX, title string) int {
+		books, err := SelectRows[Book](ctx, tx, "SELECT * FROM books WHERE title = $1", title)
+		assert.NoError(t, err)
+
+		return len(books)
+	}
+
+	t.Run("inner error rolls back to the savepoint", func(t *testing.T) {
+		outerTitle := uuid.NewString()
+		innerTitle := uuid.NewString()
+
+		err := db.WithTX(ctx, func(tx DBTX) error {
+			err := ExecQuery(ctx, tx, "INSERT INTO books (title, description) VALUES ($1, 'outer')", outerTitle)
+			if err != nil {
+				return err
+			}
+
+			err = db.WithTX(ctx, func(tx DBTX) error {
+				err := ExecQuery(ctx, tx, "INSERT INTO books (title, description) VALUES ($1, 'inner')", innerTitle)
+				if err != nil {
+					return err
+				}
+
+				return fnErr
+			}, tx)
+			assert.ErrorIs(t, err, fnErr)
+
+			// the outer transaction is still usable
+			assert.Equal(t, 0, countBooks(tx, innerTitle))
+
+			return nil
+		})
+		assert.NoError(t, err)
+
+		err = db.WithReadTX(ctx, func(tx DBTX) error {
+			assert.Equal(t, 1, countBooks(tx, outerTitle))
+			assert.Equal(t, 0, countBooks(tx, innerTitle))
+
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("inner success is committed with the outer transaction", func(t *testing.T) {
+		innerTitle := uuid.NewString()
+
+		err := db.WithTX(ctx, func(tx DBTX) error {
+			return db.WithTX(ctx, func(tx DBTX) error {
+				return ExecQuery(ctx, tx, "INSERT INTO books (title, description) VALUES ($1, 'inner')", innerTitle)
+			}, tx)
+		})
+		assert.NoError(t, err)
+
+		err = db.WithReadTX(ctx, func(tx DBTX) error {
+			assert.Equal(t, 1, countBooks(tx, innerTitle))
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("read-write in read-only", func(t *testing.T) {
+		err := db.WithReadTX(ctx, func(tx DBTX) error {
+			return db.WithTX(ctx, func(tx DBTX) error {
+				return nil
+			}, tx)
+		})
+		assert.ErrorIs(t, err, ErrReadOnlyTransaction)
+
+		err = db.WithTX(ctx, func(tx DBTX) error {
+			return db.WithReadTX(ctx, func(tx DBTX) error {
+				return db.WithTX(ctx, func(tx DBTX) error {
+					return nil
+				}, tx)
+			}, tx)
+		})
+		assert.ErrorIs(t, err, ErrReadOnlyTransaction)
+	})
+}
+
+func TestTransactional(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+	fnErr := errors.New("failed")
+
+	insertBook := func(ctx context.Context, title string) error {
+		return ExecQuery(ctx, db.Conn(ctx), "INSERT INTO books (title, description) VALUES ($1, 'transactional')", title)
+	}
+
+	countBooks := func(title string) int {
+		books, err := SelectRows[Book](ctx, db.Conn(ctx), "SELECT * FROM books WHERE title = $1", title)
+		assert.NoError(t, err)
+
+		return len(books)
+	}
+
+	t.Run("required joins the transaction of the context", func(t *testing.T) {
+		title := uuid.NewString()
+
+		err := db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+			err := insertBook(ctx, title)
+			if err != nil {
+				return err
+			}
+
+			// the variadic API uses the transaction of the context
+			return db.WithReadTX(ctx, func(tx DBTX) error {
+				books, err := SelectRows[Book](ctx, tx, "SELECT * FROM books WHERE title = $1", title)
+				assert.Len(t, books, 1)
+
+				return err
+			})
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, countBooks(title))
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		title := uuid.NewString()
+
+		err := db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+			err := insertBook(ctx, title)
+			if err != nil {
+				return err
+			}
+
+			return fnErr
+		})
+		assert.ErrorIs(t, err, fnErr)
+		assert.Equal(t, 0, countBooks(title))
+	})
+
+	t.Run("required inner error rolls back the whole transaction", func(t *testing.T) {
+		title := uuid.NewString()
+
+		err := db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+			err := insertBook(ctx, title)
+			if err != nil {
+				return err
+			}
+
+			err = db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+				return fnErr
+			})
+			assert.ErrorIs(t, err, fnErr)
+
+			// the error is handled, but the transaction cannot be committed anymore
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrRollbackOnly)
+		assert.Equal(t, 0, countBooks(title))
+	})
+
+	t.Run("nested inner error rolls back to the savepoint", func(t *testing.T) {
+		outerTitle := uuid.NewString()
+		innerTitle := uuid.NewString()
+
+		err := db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+			err := insertBook(ctx, outerTitle)
+			if err != nil {
+				return err
+			}
+
+			err = db.Transactional(ctx, TxOptions{Propagation: PropagationNested}, func(ctx context.Context) error {
+				err := insertBook(ctx, innerTitle)
+				if err != nil {
+					return err
+				}
+
+				return fnErr
+			})
+			assert.ErrorIs(t, err, fnErr)
+
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, countBooks(outerTitle))
+		assert.Equal(t, 0, countBooks(innerTitle))
+	})
+
+	t.Run("requires new commits independently", func(t *testing.T) {
+		title := uuid.NewString()
+
+		err := db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+			err := db.Transactional(ctx, TxOptions{Propagation: PropagationRequiresNew}, func(ctx context.Context) error {
+				return insertBook(ctx, title)
+			})
+			if err != nil {
+				return err
+			}
+
+			return fnErr
+		})
+		assert.ErrorIs(t, err, fnErr)
+		assert.Equal(t, 1, countBooks(title))
+	})
+
+	t.Run("supports and never", func(t *testing.T) {
+		err := db.Transactional(ctx, TxOptions{Propagation: PropagationSupports}, func(ctx context.Context) error {
+			assert.Equal(t, db.Conn(context.Background()), db.Conn(ctx), "no transaction")
+			return nil
+		})
+		assert.NoError(t, err)
+
+		err = db.Transactional(ctx, TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+			return db.Transactional(ctx, TxOptions{Propagation: PropagationSupports}, func(innerCtx context.Context) error {
+				assert.Equal(t, db.Conn(ctx), db.Conn(innerCtx), "joins the transaction")
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+
+		err = db.Transactional(ctx, TxOptions{}, func(ctx context.Context) error {
+			return db.Transactional(ctx, TxOptions{Propagation: PropagationNever}, func(ctx context.Context) error {
+				return nil
+			})
+		})
+		assert.ErrorIs(t, err, ErrTransactionExists)
+	})
+
+	t.Run("read-write in read-only", func(t *testing.T) {
+		err := db.Transactional(ctx, TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+			return db.WithTX(ctx, func(tx DBTX) error { return nil })
+		})
+		assert.ErrorIs(t, err, ErrReadOnlyTransaction)
+	})
+}
+
+func TestTransactionOptions(t *testing.T) {
+	ctx := context.Background()
+	db := setupDatabase(ctx, t)
+
+	t.Run("isolation and timeouts", func(t *testing.T) {
+		opts := TxOptions{
+			Isolation:        IsolationSerializable,
+			StatementTimeout: 1500 * time.Millisecond,
+			LockTimeout:      200 * time.Millisecond,
+		}
+
+		err := db.Transactional(ctx, opts, func(ctx context.Context) error {
+			var isolation, statementTimeout, lockTimeout string
+
+			err := db.Conn(ctx).QueryRow(ctx, `SELECT
+				current_setting('transaction_isolation'),
+				current_setting('statement_timeout'),
+				current_setting('lock_timeout')`,
+			).Scan(&isolation, &statementTimeout, &lockTimeout)
+			if err != nil {
+				return err
+			}
+
+			assert.Equal(t, "serializable", isolation)
+			assert.Equal(t, "1500ms", statementTimeout)
+			assert.Equal(t, "200ms", lockTimeout)
+
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("retries serialization failures", func(t *testing.T) {
+		book, err := SelectRow[Book](ctx, db.Conn(ctx),
+			"INSERT INTO books (title, description) VALUES ($1, 'retry') RETURNING *", uuid.NewString())
+		assert.NoError(t, err)
+
+		updateBook := func(ctx context.Context, description string) error {
+			return ExecQuery(ctx, db.Conn(ctx), "UPDATE books SET description = $1 WHERE id = $2", description, book.ID)
+		}
+
+		attempts := 0
+		opts := TxOptions{
+			Isolation: IsolationRepeatableRead,
+			Retry:     RetryOptions{MaxRetries: 2, Delay: time.Millisecond},
+		}
+
+		err = db.Transactional(ctx, opts, func(ctx context.Context) error {
+			attempts++
+
+			_, err := SelectRow[Book](ctx, db.Conn(ctx), "SELECT * FROM books WHERE id = $1", book.ID)
+			if err != nil {
+				return err
+			}
+
+			// a concurrent update after the snapshot was taken fails the update of the first attempt
+			if attempts == 1 {
+				err = db.Transactional(ctx, TxOptions{Propagation: PropagationRequiresNew}, func(ctx context.Context) error {
+					return updateBook(ctx, "concurrent")
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return updateBook(ctx, "retried")
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+
+		book, err = SelectRow[Book](ctx, db.Conn(ctx), "SELECT * FROM books WHERE id = $1", book.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "retried", book.Description)
+	})
+
+	t.Run("serialization failures are not retried by default", func(t *testing.T) {
+		book, err := SelectRow[Book](ctx, db.Conn(ctx),
+			"INSERT INTO books (title, description) VALUES ($1, 'retry') RETURNING *", uuid.NewString())
+		assert.NoError(t, err)
+
+		err = db.Transactional(ctx, TxOptions{Isolation: IsolationRepeatableRead}, func(ctx context.Context) error {
+			_, err := SelectRow[Book](ctx, db.Conn(ctx), "SELECT * FROM books WHERE id = $1", book.ID)
+			if err != nil {
+				return err
+			}
+
+			err = db.Transactional(ctx, TxOptions{Propagation: PropagationRequiresNew}, func(ctx context.Context) error {
+				return ExecQuery(ctx, db.Conn(ctx), "UPDATE books SET description = 'concurrent' WHERE id = $1", book.ID)
+			})
+			if err != nil {
+				return err
+			}
+
+			return ExecQuery(ctx, db.Conn(ctx), "UPDATE books SET description = 'failed' WHERE id = $1", book.ID)
+		})
+		assert.True(t, IsRetryable(err))
+	})
+}
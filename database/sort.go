@@ -0,0 +1,236 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidSort is matched by every error caused by a sort command which is malformed or not allowed.
+var ErrInvalidSort = errors.New("invalid sort")
+
+// SortError describes why a sort command was rejected.
+// It matches ErrInvalidSort and is returned to clients with HTTP status 400.
+type SortError struct {
+	Sort   string // The rejected sort command, e.g: "name,up"
+	Reason string // Why the sort command was rejected
+}
+
+func (e *SortError) Error() string {
+	return fmt.Sprintf("invalid sort %q: %s", e.Sort, e.Reason)
+}
+
+func (e *SortError) Is(target error) bool {
+	return target == ErrInvalidSort
+}
+
+// HTTPStatus returns the HTTP status code the error should be returned to clients with.
+func (e *SortError) HTTPStatus() int {
+	return http.StatusBadRequest
+}
+
+// Sortable maps the sort fields accepted from clients to SQL columns or expressions.
+// Only fields in the map can be sorted on, and the SQL is used as is,
+// so it must never be built from client input.
+//
+// Example usage:
+//
+//	database.Sortable{
+//	    "title":     "title",
+//	    "createdAt": "created_at",
+//	    "author":    "lower(author_name)",
+//	}
+type Sortable map[string]string
+
+var sortableColumnsCache sync.Map // map[reflect.Type]Sortable
+
+// SortableColumns returns an allow-list of every column of T with a `db` tag,
+// where the sort field is the column name. The allow-list is a copy, which can be modified.
+func SortableColumns[T any]() Sortable {
+	typ := reflect.TypeFor[T]()
+
+	if cached, ok := sortableColumnsCache.Load(typ); ok {
+		return maps.Clone(cached.(Sortable)) //nolint:forcetypeassert
+	}
+
+	sortable := Sortable{}
+	for _, column := range dbColumns(typ) {
+		sortable[column] = pgx.Identifier{column}.Sanitize()
+	}
+
+	sortableColumnsCache.Store(typ, sortable)
+
+	return maps.Clone(sortable)
+}
+
+// dbColumns returns the `db` tags of a struct type, including those of embedded structs.
+func dbColumns(typ reflect.Type) []string {
+	columns := []string{}
+	for _, field := range dbFields(typ, nil) {
+		columns = append(columns, field.column)
+	}
+
+	return columns
+}
+
+// dbField is a struct field with a `db` tag.
+type dbField struct {
+	column string // The column of the `db` tag
+	index  []int  // The index of the field, see reflect.Value.FieldByIndex
+}
+
+// dbFields returns the fields of a struct type with a `db` tag, including those of embedded structs.
+func dbFields(typ reflect.Type, index []int) []dbField {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := []dbField{}
+
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		tag, ok := field.Tag.Lookup("db")
+		if !ok && field.Anonymous {
+			fields = append(fields, dbFields(field.Type, fieldIndex)...)
+			continue
+		}
+
+		column := strings.Split(tag, ",")[0]
+		if !field.IsExported() || column == "" || column == "-" {
+			continue
+		}
+
+		fields = append(fields, dbField{column: column, index: fieldIndex})
+	}
+
+	return fields
+}
+
+// Sort is a parsed sort command.
+type Sort struct {
+	Field      string // The sort field as given by the client
+	Descending bool   // Whether to sort in descending order
+	Nulls      string // Where to place nulls: "", "FIRST" or "LAST"
+}
+
+// ParseSort parses a sort command of the format `field[,asc|desc[,nullsfirst|nullslast]]`.
+// Direction and null handling are case-insensitive.
+func ParseSort(sort string) (Sort, error) {
+	parts := strings.Split(sort, ",")
+
+	parsed := Sort{Field: strings.TrimSpace(parts[0])}
+	if parsed.Field == "" {
+		return parsed, &SortError{Sort: sort, Reason: "field cannot be empty"}
+	}
+
+	if len(parts) > 3 {
+		return parsed, &SortError{Sort: sort, Reason: "expected field[,asc|desc[,nullsfirst|nullslast]]"}
+	}
+
+	if len(parts) > 1 {
+		switch strings.ToLower(strings.TrimSpace(parts[1])) {
+		case "asc":
+		case "desc":
+			parsed.Descending = true
+		default:
+			return parsed, &SortError{Sort: sort, Reason: "direction must be asc or desc"}
+		}
+	}
+
+	if len(parts) > 2 {
+		switch strings.ToLower(strings.TrimSpace(parts[2])) {
+		case "nullsfirst":
+			parsed.Nulls = "FIRST"
+		case "nullslast":
+			parsed.Nulls = "LAST"
+		default:
+			return parsed, &SortError{Sort: sort, Reason: "null handling must be nullsfirst or nullslast"}
+		}
+	}
+
+	return parsed, nil
+}
+
+// sortTerm is a sort command resolved to its SQL expression.
+type sortTerm struct {
+	Sort
+
+	Expression string
+}
+
+// sql returns the term as used in an ORDER BY clause, optionally in reverse order.
+func (t sortTerm) sql(reverse bool) string {
+	term := t.Expression + " ASC"
+	if t.Descending != reverse {
+		term = t.Expression + " DESC"
+	}
+
+	if t.Nulls != "" {
+		term += " NULLS " + t.Nulls
+	}
+
+	return term
+}
+
+// resolve parses the sort commands and resolves them to their SQL expressions,
+// validating every field against the allow-list. Empty sort commands are skipped.
+func (s Sortable) resolve(sorts []string) ([]sortTerm, error) {
+	terms := []sortTerm{}
+
+	for _, sort := range sorts {
+		if sort == "" {
+			continue
+		}
+
+		parsed, err := ParseSort(sort)
+		if err != nil {
+			return nil, err
+		}
+
+		expression, ok := s[parsed.Field]
+		if !ok {
+			return nil, &SortError{Sort: sort, Reason: fmt.Sprintf("unknown sort field %q", parsed.Field)}
+		}
+
+		terms = append(terms, sortTerm{Sort: parsed, Expression: expression})
+	}
+
+	return terms, nil
+}
+
+// orderBy builds an ORDER BY clause from sort commands, validating every field against the allow-list.
+// It returns an empty string if there are no sort commands.
+func (s Sortable) orderBy(sorts []string) (string, error) {
+	terms, err := s.resolve(sorts)
+	if err != nil {
+		return "", err
+	}
+
+	return orderByClause(terms, false), nil
+}
+
+// orderByClause builds an ORDER BY clause from resolved sort terms, optionally in reverse order.
+func orderByClause(terms []sortTerm, reverse bool) string {
+	if len(terms) == 0 {
+		return ""
+	}
+
+	clauses := make([]string, len(terms))
+	for i, term := range terms {
+		clauses[i] = term.sql(reverse)
+	}
+
+	return " ORDER BY " + strings.Join(clauses, ", ")
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		sort     string
+		expected Sort
+	}{
+		{sort: "title", expected: Sort{Field: "title"}},
+		{sort: "title,asc", expected: Sort{Field: "title"}},
+		{sort: "title,DESC", expected: Sort{Field: "title", Descending: true}},
+		{sort: "title,desc,nullslast", expected: Sort{Field: "title", Descending: true, Nulls: "LAST"}},
+		{sort: "title,asc,NullsFirst", expected: Sort{Field: "title", Nulls: "FIRST"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			parsed, err := ParseSort(tt.sort)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, parsed)
+		})
+	}
+
+	for _, sort := range []string{",asc", "title,up", "title,desc;--", "title,asc,nulls", "title,asc,nullsfirst,extra"} {
+		t.Run(sort, func(t *testing.T) {
+			_, err := ParseSort(sort)
+			assert.ErrorIs(t, err, ErrInvalidSort)
+		})
+	}
+}
+
+func TestSortableOrderBy(t *testing.T) {
+	sortable := Sortable{
+		"title":     `"title"`,
+		"createdAt": "created_at",
+		"author":    "lower(author_name)",
+	}
+
+	t.Run("no sort", func(t *testing.T) {
+		orderBy, err := sortable.orderBy([]string{"", ""})
+		require.NoError(t, err)
+		assert.Empty(t, orderBy)
+	})
+
+	t.Run("multiple sorts", func(t *testing.T) {
+		orderBy, err := sortable.orderBy([]string{"author", "createdAt,desc,nullslast", "title,asc"})
+		require.NoError(t, err)
+		assert.Equal(t, ` ORDER BY lower(author_name) ASC, created_at DESC NULLS LAST, "title" ASC`, orderBy)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		for _, sort := range []string{"created_at", "title;DROP TABLE books", "(SELECT 1)", "title,desc;--"} {
+			_, err := sortable.orderBy([]string{sort})
+			require.ErrorIs(t, err, ErrInvalidSort, sort)
+
+			var sortErr *SortError
+			require.ErrorAs(t, err, &sortErr)
+			assert.Equal(t, sort, sortErr.Sort)
+			assert.Equal(t, http.StatusBadRequest, sortErr.HTTPStatus())
+		}
+	})
+}
+
+func TestSortableColumns(t *testing.T) {
+	type Audited struct {
+		CreatedAt string `db:"created_at"`
+	}
+
+	type Row struct {
+		Audited
+		ID       int    `db:"id"`
+		Title    string `db:"title,omitempty"`
+		Ignored  string `db:"-"`
+		Untagged string
+		hidden   string `db:"hidden"` //nolint:unused
+	}
+
+	assert.Equal(t, Sortable{
+		"created_at": `"created_at"`,
+		"id":         `"id"`,
+		"title":      `"title"`,
+	}, SortableColumns[Row]())
+	assert.Equal(t, Sortable{
+		"id":          `"id"`,
+		"title":       `"title"`,
+		"description": `"description"`,
+	}, SortableColumns[Book]())
+
+	// the cached allow-list cannot be modified through a returned copy
+	sortable := SortableColumns[Book]()
+	delete(sortable, "id")
+	sortable["secret"] = "secret"
+
+	assert.Equal(t, Sortable{
+		"id":          `"id"`,
+		"title":       `"title"`,
+		"description": `"description"`,
+	}, SortableColumns[Book]())
+}
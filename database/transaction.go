@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/failsafe-go/failsafe-go"
+	"github.com/failsafe-go/failsafe-go/retrypolicy"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrReadOnlyTransaction is returned when a read-write transaction is nested in a read-only transaction.
+	ErrReadOnlyTransaction = errors.New("cannot nest a read-write transaction in a read-only transaction")
+	// ErrTransactionExists is returned by Transactional with PropagationNever when the context carries a transaction.
+	ErrTransactionExists = errors.New("transaction exists in context")
+	// ErrRollbackOnly is returned when a transaction is committed after a function which joined it with
+	// PropagationRequired failed, as the transaction was rolled back instead.
+	ErrRollbackOnly = errors.New("transaction was rolled back as a function joining it failed")
+)
+
+// Propagation defines how Transactional relates to the transaction carried by the context,
+// like the propagation of Spring's @Transactional.
+type Propagation int
+
+const (
+	// PropagationRequired joins the transaction of the context, or begins a new transaction if there is none.
+	// This is the default. When the function fails, the whole transaction is rolled back,
+	// even if the error is handled by the function of the outer transaction, see ErrRollbackOnly.
+	PropagationRequired Propagation = iota
+	// PropagationRequiresNew always begins a new transaction, independent of the transaction of the context.
+	PropagationRequiresNew
+	// PropagationSupports runs in the transaction of the context, or without a transaction if there is none.
+	PropagationSupports
+	// PropagationNever runs without a transaction, and fails with ErrTransactionExists if the context carries one.
+	PropagationNever
+	// PropagationNested nests a transaction in the transaction of the context using a savepoint,
+	// so that an error only rolls back the changes of the function, or begins a new transaction if there is none.
+	PropagationNested
+)
+
+// IsolationLevel is the isolation level of a transaction.
+type IsolationLevel = pgx.TxIsoLevel
+
+const (
+	IsolationReadCommitted  IsolationLevel = pgx.ReadCommitted  // Every statement sees the data committed before it began
+	IsolationRepeatableRead IsolationLevel = pgx.RepeatableRead // Every statement sees the data committed before the transaction began
+	IsolationSerializable   IsolationLevel = pgx.Serializable   // Like RepeatableRead, and concurrent transactions behave as if run one after another
+)
+
+// Defaults of the retry options.
+const (
+	DefaultRetryDelay    = 50 * time.Millisecond // The delay before the first retry
+	DefaultRetryMaxDelay = time.Second           // The maximum delay between retries
+)
+
+// Postgres error codes of transactions which can be retried.
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// TxOptions configures the transactions of Transactional.
+// Isolation, Deferrable, the timeouts and Retry only apply when a new transaction is begun,
+// a joined transaction or a transaction nested with a savepoint runs with the options of the outer transaction.
+type TxOptions struct {
+	Propagation Propagation    // How the transaction relates to the transaction of the context
+	ReadOnly    bool           // Whether the transaction is read-only, a new read-only transaction begins on a replica if configured
+	Isolation   IsolationLevel // The isolation level, defaults to the default of the database, usually IsolationReadCommitted
+	// Whether a read-only serializable transaction is deferrable, so that it waits until it can run without
+	// serialization failures instead of failing. It has no effect on other transactions.
+	Deferrable       bool
+	StatementTimeout time.Duration // The timeout of each statement of the transaction, defaults to the timeout of the database
+	LockTimeout      time.Duration // The timeout of waiting for a lock, defaults to the timeout of the database
+	Retry            RetryOptions  // Retries the transaction on serialization failures and deadlocks, disabled by default
+}
+
+// RetryOptions configures retrying a transaction which failed with a serialization failure or a deadlock,
+// see IsRetryable. The whole transaction function is executed again in a new transaction,
+// so it must not have side effects outside of the transaction.
+type RetryOptions struct {
+	MaxRetries int           // How often the transaction is retried, 0 disables retrying
+	Delay      time.Duration // The delay before the first retry, doubled for each retry, defaults to DefaultRetryDelay
+	MaxDelay   time.Duration // The maximum delay between retries, defaults to DefaultRetryMaxDelay
+}
+
+// policy returns the retry policy of the options, backing off exponentially with jitter,
+// so that the retries of conflicting transactions do not collide again.
+func (o RetryOptions) policy() retrypolicy.RetryPolicy[any] {
+	delay := o.Delay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+
+	maxDelay := o.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+
+	maxDelay = max(maxDelay, delay)
+
+	return retrypolicy.Builder[any]().
+		HandleIf(func(_ any, err error) bool {
+			return IsRetryable(err)
+		}).
+		WithBackoff(delay, maxDelay).
+		WithJitterFactor(0.25).
+		WithMaxRetries(o.MaxRetries).
+		ReturnLastFailure().
+		Build()
+}
+
+// IsRetryable returns whether the error is caused by a serialization failure (SQLSTATE 40001)
+// or a deadlock (SQLSTATE 40P01), so that the transaction can succeed when it is executed again.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// pgxOptions returns the pgx options of a new transaction.
+func (o TxOptions) pgxOptions() pgx.TxOptions {
+	opts := pgx.TxOptions{
+		IsoLevel:   o.Isolation,
+		AccessMode: pgx.ReadWrite,
+	}
+
+	if o.ReadOnly {
+		opts.AccessMode = pgx.ReadOnly
+	}
+
+	if o.Deferrable {
+		opts.DeferrableMode = pgx.Deferrable
+	}
+
+	return opts
+}
+
+// settings returns the run-time parameters of a new transaction, set with SET LOCAL semantics.
+func (o TxOptions) settings() map[string]string {
+	settings := map[string]string{}
+
+	if o.StatementTimeout > 0 {
+		settings["statement_timeout"] = strconv.FormatInt(o.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if o.LockTimeout > 0 {
+		settings["lock_timeout"] = strconv.FormatInt(o.LockTimeout.Milliseconds(), 10)
+	}
+
+	return settings
+}
+
+// transaction is a pgx.Tx which knows its database and whether it is read-only,
+// so that a read-write transaction cannot be nested in it.
+type transaction struct {
+	pgx.Tx
+
+	db           *dbo
+	readOnly     bool
+	rollbackOnly bool // Whether a function which joined the transaction failed, so that it must not be committed
+}
+
+type txContextKey struct{}
+
+// contextWithTX returns a context carrying the transaction, which is returned by Database.Conn.
+func contextWithTX(ctx context.Context, tx *transaction) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// Conn returns the transaction of the database carried by the context, or the pool of the database.
+//
+// Example usage:
+//
+//	err := db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+//	    return database.ExecQuery(ctx, db.Conn(ctx), "DELETE FROM books WHERE id = $1", id)
+//	})
+func (d *dbo) Conn(ctx context.Context) DBTX {
+	if tx := d.ambientTx(ctx); tx != nil {
+		return tx
+	}
+
+	return d.pool.Load()
+}
+
+// Transactional executes a function within a transaction carried by the context passed to it,
+// so that every Conn, WithTX and WithReadTX call with that context uses the transaction.
+// The propagation of the options defines how it relates to the transaction already carried by the context,
+// and the transaction is committed when the function succeeds or rolled back on error.
+//
+// Example usage:
+//
+//	err := db.Transactional(ctx, database.TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+//	    books, err = repository.FindBooks(ctx, db.Conn(ctx))
+//	    return err
+//	})
+//
+// Serializable transactions are retried on serialization failures with the retry options:
+//
+//	opts := database.TxOptions{Isolation: database.IsolationSerializable, Retry: database.RetryOptions{MaxRetries: 3}}
+func (d *dbo) Transactional(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	ambient := d.ambientTx(ctx)
+
+	switch opts.Propagation {
+	case PropagationSupports:
+		return runWithoutTransaction(ctx, fn)
+	case PropagationNever:
+		if ambient != nil {
+			return ErrTransactionExists
+		}
+
+		return runWithoutTransaction(ctx, fn)
+	case PropagationRequiresNew:
+		ambient = nil
+	case PropagationRequired:
+		if ambient != nil {
+			return ambient.join(ctx, opts, fn)
+		}
+	case PropagationNested:
+	}
+
+	var outer pgx.Tx
+	if ambient != nil {
+		outer = ambient
+	}
+
+	return d.runTransaction(ctx, outer, opts, func(tx *transaction) error {
+		return fn(contextWithTX(ctx, tx))
+	})
+}
+
+// join runs the function in the transaction carried by the context. When the function fails,
+// the transaction is marked as rollback-only, so that it is not committed even if the error is handled.
+func (tx *transaction) join(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if tx.readOnly && !opts.ReadOnly {
+		return ErrReadOnlyTransaction
+	}
+
+	err := fn(ctx)
+	if err != nil {
+		tx.rollbackOnly = true
+		return fmt.Errorf("transaction function failed: %w", err)
+	}
+
+	return nil
+}
+
+// runWithoutTransaction runs the function with the context as is, wrapping its error like a transaction function.
+func runWithoutTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction function failed: %w", err)
+	}
+
+	return nil
+}
+
+// ambientTx returns the transaction of the database carried by the context, or nil if there is none.
+func (d *dbo) ambientTx(ctx context.Context) *transaction {
+	if tx, ok := ctx.Value(txContextKey{}).(*transaction); ok && tx.db == d {
+		return tx
+	}
+
+	return nil
+}
+
+// runTransaction begins a transaction, nested in the outer transaction with a savepoint if one is given,
+// and executes the function with it. The transaction is committed when the function succeeds
+// and rolled back on error. A new transaction is retried as configured by the retry options of opts.
+func (d *dbo) runTransaction(ctx context.Context, outer pgx.Tx, opts TxOptions, fn func(tx *transaction) error) error {
+	// a nested transaction cannot be retried on its own, the outer transaction is retried instead
+	if outer != nil || opts.Retry.MaxRetries <= 0 {
+		return d.runTransactionOnce(ctx, outer, opts, fn)
+	}
+
+	return failsafe.NewExecutor[any](opts.Retry.policy()).WithContext(ctx).Run(func() error {
+		return d.runTransactionOnce(ctx, nil, opts, fn)
+	})
+}
+
+// runTransactionOnce begins a transaction like runTransaction, without retrying it.
+func (d *dbo) runTransactionOnce(ctx context.Context, outer pgx.Tx, opts TxOptions, fn func(tx *transaction) error) error {
+	readOnly := opts.ReadOnly
+
+	var (
+		tx  pgx.Tx
+		err error
+	)
+
+	if outer != nil {
+		if wrapped, ok := outer.(*transaction); ok {
+			if wrapped.readOnly && !readOnly {
+				return ErrReadOnlyTransaction
+			}
+
+			readOnly = readOnly || wrapped.readOnly
+		}
+
+		tx, err = outer.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin nested transaction: %w", err)
+		}
+	} else {
+		tx, err = d.begin(ctx, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if outer == nil {
+		for name, value := range opts.settings() {
+			_, err = tx.Exec(ctx, "SELECT set_config($1, $2, true)", name, value)
+			if err != nil {
+				return fmt.Errorf("failed to set %s of transaction: %w", name, err)
+			}
+		}
+	}
+
+	wrapped := &transaction{Tx: tx, db: d, readOnly: readOnly}
+
+	err = fn(wrapped)
+	if err != nil {
+		return fmt.Errorf("transaction function failed: %w", err)
+	}
+
+	if wrapped.rollbackOnly {
+		return ErrRollbackOnly
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/failsafe-go/failsafe-go"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn(t *testing.T) {
+	ctx := context.Background()
+	d := unreachableDatabase(t)
+	tx := &transaction{db: d}
+
+	assert.Same(t, d.pool.Load(), d.Conn(ctx))
+	assert.Same(t, tx, d.Conn(contextWithTX(ctx, tx)))
+
+	// a transaction of another database is not used
+	assert.Same(t, d.pool.Load(), d.Conn(contextWithTX(ctx, &transaction{db: unreachableDatabase(t)})))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40001"})))
+	assert.True(t, IsRetryable(&pgconn.PgError{Code: "40P01"}))
+	assert.False(t, IsRetryable(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, IsRetryable(errors.New("failed")))
+	assert.False(t, IsRetryable(nil))
+}
+
+func TestTxOptions(t *testing.T) {
+	t.Run("pgx options", func(t *testing.T) {
+		assert.Equal(t, pgx.TxOptions{AccessMode: pgx.ReadWrite}, TxOptions{}.pgxOptions())
+		assert.Equal(t, pgx.TxOptions{
+			IsoLevel:       pgx.Serializable,
+			AccessMode:     pgx.ReadOnly,
+			DeferrableMode: pgx.Deferrable,
+		}, TxOptions{Isolation: IsolationSerializable, ReadOnly: true, Deferrable: true}.pgxOptions())
+	})
+
+	t.Run("settings", func(t *testing.T) {
+		assert.Empty(t, TxOptions{}.settings())
+		assert.Equal(t, map[string]string{
+			"statement_timeout": "1500",
+			"lock_timeout":      "200",
+		}, TxOptions{StatementTimeout: 1500 * time.Millisecond, LockTimeout: 200 * time.Millisecond}.settings())
+	})
+}
+
+func TestRetryOptions(t *testing.T) {
+	opts := RetryOptions{MaxRetries: 2, Delay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	t.Run("retries retryable errors", func(t *testing.T) {
+		attempts := 0
+
+		err := failsafe.Run(func() error {
+			attempts++
+			if attempts < 3 {
+				return fmt.Errorf("transaction function failed: %w", &pgconn.PgError{Code: "40001"})
+			}
+
+			return nil
+		}, opts.policy())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("returns the last error when retries are exceeded", func(t *testing.T) {
+		attempts := 0
+
+		err := failsafe.Run(func() error {
+			attempts++
+			return &pgconn.PgError{Code: "40P01"}
+		}, opts.policy())
+		assert.True(t, IsRetryable(err))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts := 0
+		fnErr := errors.New("failed")
+
+		err := failsafe.Run(func() error {
+			attempts++
+			return fnErr
+		}, opts.policy())
+		assert.ErrorIs(t, err, fnErr)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+// errNoConnection is returned by every query of noConn.
+var errNoConnection = errors.New("no connection")
+
+// noConn is a DBTX which fails every query with errNoConnection.
+type noConn struct{}
+
+func (noConn) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errNoConnection
+}
+
+func (noConn) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errNoConnection
+}
+
+func (noConn) QueryRow(context.Context, string, ...any) pgx.Row {
+	return noConnRow{}
+}
+
+func (noConn) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, errNoConnection
+}
+
+func (noConn) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return noConnBatchResults{}
+}
+
+// noConnBatchResults fails every statement of a batch with errNoConnection.
+type noConnBatchResults struct{}
+
+func (noConnBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errNoConnection
+}
+
+func (noConnBatchResults) Query() (pgx.Rows, error) {
+	return nil, errNoConnection
+}
+
+func (noConnBatchResults) QueryRow() pgx.Row {
+	return noConnRow{}
+}
+
+func (noConnBatchResults) Close() error {
+	return errNoConnection
+}
+
+type noConnRow struct{}
+
+func (noConnRow) Scan(...any) error {
+	return errNoConnection
+}
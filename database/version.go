@@ -0,0 +1,59 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrStaleVersion is matched by every StaleVersionError.
+var ErrStaleVersion = errors.New("stale version")
+
+// StaleVersionError is returned by Repository.Save when the version of the entity is not the version of its row,
+// because the row was updated since the entity was read, or an entity without version collides with an existing row.
+// It matches ErrStaleVersion, and is returned to clients with HTTP status 409, or 412 if it is a failed precondition.
+type StaleVersionError struct {
+	Table   string // The table of the entity
+	ID      any    // The id of the entity
+	Version int64  // The version of the entity, 0 if it had none
+	// Whether the version is a precondition of the request, e.g: an If-Match header, see PreconditionFailed.
+	Precondition bool
+}
+
+func (e *StaleVersionError) Error() string {
+	return fmt.Sprintf("%s %v was modified concurrently, version %d is stale", e.Table, e.ID, e.Version)
+}
+
+func (e *StaleVersionError) Is(target error) bool {
+	return target == ErrStaleVersion
+}
+
+// HTTPStatus returns the HTTP status code the error should be returned to clients with.
+func (e *StaleVersionError) HTTPStatus() int {
+	if e.Precondition {
+		return http.StatusPreconditionFailed
+	}
+
+	return http.StatusConflict
+}
+
+// PreconditionFailed marks the StaleVersionError of err as a failed precondition of the request,
+// so that server.WriteErrorFrom returns it to clients with status 412 instead of 409, and returns err.
+// Other errors are returned unchanged.
+//
+// Example usage:
+//
+//	ifMatch, err := server.ParseIfMatch(r.Header.Get("If-Match"))
+//	...
+//	book, err := service.UpdateBook(ctx, id, ifMatch.Version, dto)
+//	if err != nil {
+//	    server.WriteErrorFrom(w, database.PreconditionFailed(err), http.StatusInternalServerError)
+//	}
+func PreconditionFailed(err error) error {
+	var staleErr *StaleVersionError
+	if errors.As(err, &staleErr) {
+		staleErr.Precondition = true
+	}
+
+	return err
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleVersionError(t *testing.T) {
+	err := fmt.Errorf("failed to save books: %w", &StaleVersionError{Table: "books", ID: 7, Version: 3})
+
+	assert.ErrorIs(t, err, ErrStaleVersion)
+	assert.EqualError(t, err, "failed to save books: books 7 was modified concurrently, version 3 is stale")
+
+	var staleErr *StaleVersionError
+	assert.ErrorAs(t, err, &staleErr)
+	assert.Equal(t, http.StatusConflict, staleErr.HTTPStatus())
+
+	assert.Equal(t, err, PreconditionFailed(err))
+	assert.Equal(t, http.StatusPreconditionFailed, staleErr.HTTPStatus())
+
+	other := errors.New("failed")
+	assert.Equal(t, other, PreconditionFailed(other))
+}
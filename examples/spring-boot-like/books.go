@@ -1,11 +1,19 @@
 package springbootlike
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Book struct {
 	ID          uuid.UUID `db:"id"`
 	Title       string    `db:"title"`
 	Description string    `db:"description"`
+	Version     int64     `db:"version"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+	CreatedBy   string    `db:"created_by"`
 }
 
 type NewBookDTO struct {
@@ -13,8 +21,19 @@ type NewBookDTO struct {
 	Description string `json:"description"`
 }
 
+type UpdateBookDTO struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// The version which was read, unless it is sent in the If-Match header, nil to update the current version
+	Version *int64 `json:"version,omitempty"`
+}
+
 type BookDTO struct {
 	ID          uuid.UUID `json:"id"`
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	CreatedBy   string    `json:"createdBy"`
 }
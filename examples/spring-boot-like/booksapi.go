@@ -2,6 +2,7 @@ package springbootlike
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -30,8 +31,9 @@ func (a *api) InitAPI() {
 	// gen:tag=Books
 	server.AddHandler("GET /api/v1/books", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			Ctx context.Context `ctx:"context"`
-			database.PageRequest
+			Ctx                  context.Context `ctx:"context"`
+			database.PageRequest `sortable:"bookSortable"`
+			Filter               database.Filter `query:"*" filterable:"bookFilterable"`
 		}
 
 		err := server.ParseRequest(r, &req)
@@ -40,9 +42,36 @@ func (a *api) InitAPI() {
 			return
 		}
 
-		books, err := a.service.GetBooks(req.Ctx, req.PageRequest)
+		books, err := a.service.GetBooks(req.Ctx, req.PageRequest, req.Filter)
 		if err != nil {
-			server.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("failed to retrieve books: %v", err))
+			server.WriteErrorFrom(w, fmt.Errorf("failed to retrieve books: %w", err), http.StatusInternalServerError)
+			return
+		}
+
+		server.WriteJSON(w, http.StatusOK, books)
+	})
+
+	// Get books by cursor
+	//
+	// This handler scrolls through the books with the cursors of the previous response,
+	// which stays stable when books are added.
+	//
+	// gen:tag=Books
+	server.AddHandler("GET /api/v1/books/cursor", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ctx                    context.Context `ctx:"context"`
+			database.CursorRequest `sortable:"bookSortable"`
+		}
+
+		err := server.ParseRequest(r, &req)
+		if err != nil {
+			server.WriteError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+			return
+		}
+
+		books, err := a.service.GetBooksByCursor(req.Ctx, req.CursorRequest)
+		if err != nil {
+			server.WriteErrorFrom(w, fmt.Errorf("failed to retrieve books: %w", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -51,7 +80,8 @@ func (a *api) InitAPI() {
 
 	// Get a book by ID
 	//
-	// This handler retrieves a book by its ID from the path parameter.
+	// This handler retrieves a book by its ID from the path parameter,
+	// with its version as ETag for the If-Match header of updates.
 	//
 	// gen:tag=Books
 	server.AddHandler("GET /api/v1/books/{id}", func(w http.ResponseWriter, r *http.Request) {
@@ -72,6 +102,69 @@ func (a *api) InitAPI() {
 			return
 		}
 
+		server.SetETag(w, book.Version)
+		server.WriteJSON(w, http.StatusOK, book)
+	})
+
+	// Update a book
+	//
+	// This handler updates a book if it has the version of the If-Match header, or of the body without it.
+	// If-Match: * updates the current version of the book.
+	// A stale version is rejected with 412 Precondition Failed for If-Match, and with 409 Conflict otherwise.
+	//
+	// gen:tag=Books
+	server.AddHandler("PUT /api/v1/books/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ctx     context.Context `ctx:"context"`
+			ID      uuid.UUID       `path:"id"`
+			IfMatch *string         `header:"If-Match"`
+			Book    UpdateBookDTO   `body:"json"`
+		}
+
+		err := server.ParseRequest(r, &req)
+		if err != nil {
+			server.WriteError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse request: %v", err))
+			return
+		}
+
+		var ifMatch string
+		if req.IfMatch != nil {
+			ifMatch = *req.IfMatch
+		}
+
+		precondition, err := server.ParseIfMatch(ifMatch)
+		if err != nil {
+			server.WriteErrorFrom(w, err, http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case precondition.Any:
+			req.Book.Version = nil // matches the current version of the book
+		case precondition.Present:
+			req.Book.Version = &precondition.Version
+		case req.Book.Version == nil:
+			server.WriteError(w, http.StatusBadRequest, "the version of the book is required in the If-Match header or the body")
+			return
+		}
+
+		book, err := a.service.UpdateBook(req.Ctx, req.ID, req.Book)
+		if errors.Is(err, ErrBookNotFound) {
+			server.WriteError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		if err != nil {
+			if precondition.Present && !precondition.Any {
+				err = database.PreconditionFailed(err)
+			}
+
+			server.WriteErrorFrom(w, fmt.Errorf("failed to update book: %w", err), http.StatusInternalServerError)
+
+			return
+		}
+
+		server.SetETag(w, book.Version)
 		server.WriteJSON(w, http.StatusOK, book)
 	})
 
@@ -92,7 +185,7 @@ func (a *api) InitAPI() {
 
 		book, err := a.service.CreateBook(req.Ctx, req.Book)
 		if err != nil {
-			server.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("failed to add book: %v", err))
+			server.WriteErrorFrom(w, fmt.Errorf("failed to add book: %w", err), http.StatusInternalServerError)
 			return
 		}
 
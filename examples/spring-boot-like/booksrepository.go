@@ -11,30 +11,67 @@ import (
 
 type Repository interface {
 	SaveBook(ctx context.Context, tx database.DBTX, book Book) (Book, error)
-	FindBooks(ctx context.Context, tx database.DBTX, pageRequest database.PageRequest) (database.Page[Book], error)
+	FindBooks(ctx context.Context, tx database.DBTX, pageRequest database.PageRequest, filter database.Filter) (database.Page[Book], error)
+	FindBooksByCursor(ctx context.Context, tx database.DBTX, cursorRequest database.CursorRequest) (database.CursorPage[Book], error)
 	FindOptionalBookByID(ctx context.Context, tx database.DBTX, id uuid.UUID) (*Book, error)
 	DeleteBookByID(ctx context.Context, tx database.DBTX, id uuid.UUID) error
 }
 
-type repository struct{}
+type repository struct {
+	books     database.Repository[Book, uuid.UUID]
+	cursorKey []byte
+}
+
+// bookSortable maps the sort fields of the books API to their columns.
+var bookSortable = database.Sortable{
+	"id":          "id",
+	"title":       "title",
+	"description": "description",
+}
 
-func NewRepository() Repository {
-	return &repository{}
+// bookFilterable maps the filter fields of the books API to their columns and operators.
+var bookFilterable = database.Filterable{
+	"id": {
+		Expression: "id",
+		Operators:  []database.FilterOperator{database.FilterEq, database.FilterIn},
+		Parse:      database.ParseFilterValue(uuid.Parse),
+	},
+	"title":       {Expression: "title", Operators: []database.FilterOperator{database.FilterEq, database.FilterILike}},
+	"description": {Expression: "description", Operators: []database.FilterOperator{database.FilterILike}},
+}
+
+// NewRepository creates the books repository, which signs the cursors of the books with the key.
+func NewRepository(cursorKey string) Repository {
+	return &repository{
+		books: database.Repository[Book, uuid.UUID]{
+			Table:         "books",
+			Sortable:      bookSortable,
+			Filterable:    bookFilterable,
+			VersionColumn: "version",
+			Audit:         database.DefaultAuditColumns,
+		},
+		cursorKey: []byte(cursorKey),
+	}
 }
 
 // DeleteBookByID implements Repository.
 func (r *repository) DeleteBookByID(ctx context.Context, tx database.DBTX, id uuid.UUID) error {
-	_, err := tx.Exec(ctx, "DELETE FROM books WHERE id = $1", id)
+	_, err := r.books.DeleteByID(ctx, tx, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete book with id %d: %w", id, err)
+		return fmt.Errorf("failed to delete book with id %s: %w", id, err)
 	}
 
 	return nil
 }
 
 // FindBooks implements Repository.
-func (r *repository) FindBooks(ctx context.Context, tx database.DBTX, pageRequest database.PageRequest) (database.Page[Book], error) {
-	books, err := database.SelectRowsPageable[Book](ctx, tx, pageRequest, "SELECT * FROM books")
+func (r *repository) FindBooks(
+	ctx context.Context,
+	tx database.DBTX,
+	pageRequest database.PageRequest,
+	filter database.Filter,
+) (database.Page[Book], error) {
+	books, err := r.books.FindAll(ctx, tx, pageRequest, filter)
 	if err != nil {
 		return books, fmt.Errorf("failed to retrieve all books: %w", err)
 	}
@@ -42,9 +79,28 @@ func (r *repository) FindBooks(ctx context.Context, tx database.DBTX, pageReques
 	return books, nil
 }
 
+// FindBooksByCursor implements Repository.
+func (r *repository) FindBooksByCursor(
+	ctx context.Context,
+	tx database.DBTX,
+	cursorRequest database.CursorRequest,
+) (database.CursorPage[Book], error) {
+	books, err := database.SelectRowsCursor[Book](ctx, tx, database.CursorQuery{
+		Request:  cursorRequest,
+		Query:    "SELECT * FROM books",
+		Sortable: bookSortable,
+		Key:      r.cursorKey,
+	})
+	if err != nil {
+		return books, fmt.Errorf("failed to retrieve books by cursor: %w", err)
+	}
+
+	return books, nil
+}
+
 // FindOptionalBookByID implements Repository.
 func (r *repository) FindOptionalBookByID(ctx context.Context, tx database.DBTX, id uuid.UUID) (*Book, error) {
-	book, err := database.SelectRow[Book](ctx, tx, "SELECT * FROM books WHERE id = $1", id)
+	book, err := r.books.FindByID(ctx, tx, id)
 	if err != nil {
 		if errors.Is(err, database.ErrNoRows) {
 			return nil, nil // No book found with the given ID
@@ -58,14 +114,7 @@ func (r *repository) FindOptionalBookByID(ctx context.Context, tx database.DBTX,
 
 // SaveBook implements Repository.
 func (r *repository) SaveBook(ctx context.Context, tx database.DBTX, book Book) (Book, error) {
-	book, err := database.SelectRow[Book](ctx, tx, `
-INSERT INTO books (id, title, description) 
-VALUES ($1, $2, $3)
-ON CONFLICT (id) DO UPDATE SET
-	title = EXCLUDED.title,
-	description = EXCLUDED.description
-RETURNING *
-`, book.ID, book.Title, book.Description)
+	book, err := r.books.Save(ctx, tx, book)
 	if err != nil {
 		return Book{}, fmt.Errorf("failed to insert book: %w", err)
 	}
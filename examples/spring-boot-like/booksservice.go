@@ -3,6 +3,7 @@ package springbootlike
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -11,11 +12,16 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrBookNotFound is returned when the book of an id does not exist.
+var ErrBookNotFound = errors.New("book not found")
+
 type Service interface {
-	CreateBook(ctx context.Context, newBook NewBookDTO, tx ...database.DBTX) (BookDTO, error)
-	GetBooks(ctx context.Context, pageRequest database.PageRequest, tx ...database.DBTX) (database.Page[BookDTO], error)
-	GetBookByID(ctx context.Context, id uuid.UUID, tx ...database.DBTX) (BookDTO, error)
-	DeleteBookByID(ctx context.Context, id uuid.UUID, tx ...database.DBTX) error
+	CreateBook(ctx context.Context, newBook NewBookDTO) (BookDTO, error)
+	GetBooks(ctx context.Context, pageRequest database.PageRequest, filter database.Filter) (database.Page[BookDTO], error)
+	GetBooksByCursor(ctx context.Context, cursorRequest database.CursorRequest) (database.CursorPage[BookDTO], error)
+	GetBookByID(ctx context.Context, id uuid.UUID) (BookDTO, error)
+	UpdateBook(ctx context.Context, id uuid.UUID, update UpdateBookDTO) (BookDTO, error)
+	DeleteBookByID(ctx context.Context, id uuid.UUID) error
 }
 
 type service struct {
@@ -56,13 +62,13 @@ func NewService(mq queue.Queue, db database.Database, repository Repository) Ser
 }
 
 // CreateBook implements Service.
-func (s *service) CreateBook(ctx context.Context, newBook NewBookDTO, tx ...database.DBTX) (BookDTO, error) {
+func (s *service) CreateBook(ctx context.Context, newBook NewBookDTO) (BookDTO, error) {
 	var book Book
 
-	err := s.db.WithTX(ctx, func(tx database.DBTX) error {
+	err := s.db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
 		var err error
 
-		book, err = s.repository.SaveBook(ctx, tx, Book{
+		book, err = s.repository.SaveBook(ctx, s.db.Conn(ctx), Book{
 			ID:          uuid.New(),
 			Title:       newBook.Title,
 			Description: newBook.Description,
@@ -72,7 +78,7 @@ func (s *service) CreateBook(ctx context.Context, newBook NewBookDTO, tx ...data
 		}
 
 		return nil
-	}, tx...)
+	})
 	if err != nil {
 		return BookDTO{}, err
 	}
@@ -91,19 +97,23 @@ func (s *service) CreateBook(ctx context.Context, newBook NewBookDTO, tx ...data
 }
 
 // GetBooks implements Service.
-func (s *service) GetBooks(ctx context.Context, pageRequest database.PageRequest, tx ...database.DBTX) (database.Page[BookDTO], error) {
+func (s *service) GetBooks(
+	ctx context.Context,
+	pageRequest database.PageRequest,
+	filter database.Filter,
+) (database.Page[BookDTO], error) {
 	var books database.Page[Book]
 
-	err := s.db.WithReadTX(ctx, func(tx database.DBTX) error {
+	err := s.db.Transactional(ctx, database.TxOptions{ReadOnly: true}, func(ctx context.Context) error {
 		var err error
 
-		books, err = s.repository.FindBooks(ctx, tx, pageRequest)
+		books, err = s.repository.FindBooks(ctx, s.db.Conn(ctx), pageRequest, filter)
 		if err != nil {
 			return fmt.Errorf("failed to find books: %w", err)
 		}
 
 		return nil
-	}, tx...)
+	})
 	if err != nil {
 		return database.Page[BookDTO]{}, err
 	}
@@ -116,20 +126,49 @@ func (s *service) GetBooks(ctx context.Context, pageRequest database.PageRequest
 	return database.MapContent(books, bookDTOs), nil
 }
 
+// GetBooksByCursor implements Service.
+func (s *service) GetBooksByCursor(
+	ctx context.Context,
+	cursorRequest database.CursorRequest,
+) (database.CursorPage[BookDTO], error) {
+	var books database.CursorPage[Book]
+
+	err := s.db.Transactional(ctx, database.TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+		var err error
+
+		books, err = s.repository.FindBooksByCursor(ctx, s.db.Conn(ctx), cursorRequest)
+		if err != nil {
+			return fmt.Errorf("failed to find books: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return database.CursorPage[BookDTO]{}, err
+	}
+
+	bookDTOs := make([]BookDTO, len(books.Content))
+	for i, book := range books.Content {
+		bookDTOs[i] = BookDTO(book)
+	}
+
+	return database.MapCursorContent(books, bookDTOs), nil
+}
+
 // GetBookByID implements Service.
-func (s *service) GetBookByID(ctx context.Context, id uuid.UUID, tx ...database.DBTX) (BookDTO, error) {
+func (s *service) GetBookByID(ctx context.Context, id uuid.UUID) (BookDTO, error) {
 	var book *Book
 
-	err := s.db.WithReadTX(ctx, func(tx database.DBTX) error {
+	err := s.db.Transactional(ctx, database.TxOptions{ReadOnly: true}, func(ctx context.Context) error {
 		var err error
 
-		book, err = s.repository.FindOptionalBookByID(ctx, tx, id)
+		book, err = s.repository.FindOptionalBookByID(ctx, s.db.Conn(ctx), id)
 		if err != nil {
 			return fmt.Errorf("failed to find book by id %s: %w", id, err)
 		}
 
 		return nil
-	}, tx...)
+	})
 	if err != nil {
 		return BookDTO{}, err
 	}
@@ -138,16 +177,54 @@ func (s *service) GetBookByID(ctx context.Context, id uuid.UUID, tx ...database.
 		return BookDTO{}, fmt.Errorf("book with id %s not found", id)
 	}
 
-	return BookDTO{
-		ID:          book.ID,
-		Title:       book.Title,
-		Description: book.Description,
-	}, nil
+	return BookDTO(*book), nil
+}
+
+// UpdateBook implements Service.
+func (s *service) UpdateBook(ctx context.Context, id uuid.UUID, update UpdateBookDTO) (BookDTO, error) {
+	var book *Book
+
+	err := s.db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+		var err error
+
+		book, err = s.repository.FindOptionalBookByID(ctx, s.db.Conn(ctx), id)
+		if err != nil {
+			return fmt.Errorf("failed to find book by id %s: %w", id, err)
+		}
+
+		if book == nil {
+			return nil
+		}
+
+		// the version which was read, so that the update fails if the book was updated since
+		book.Title = update.Title
+		book.Description = update.Description
+
+		if update.Version != nil {
+			book.Version = *update.Version
+		}
+
+		*book, err = s.repository.SaveBook(ctx, s.db.Conn(ctx), *book)
+		if err != nil {
+			return fmt.Errorf("failed to save book: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return BookDTO{}, err
+	}
+
+	if book == nil {
+		return BookDTO{}, fmt.Errorf("failed to update book with id %s: %w", id, ErrBookNotFound)
+	}
+
+	return BookDTO(*book), nil
 }
 
 // DeleteBookByID implements Service.
-func (s *service) DeleteBookByID(ctx context.Context, id uuid.UUID, tx ...database.DBTX) error {
-	return s.db.WithTX(ctx, func(tx database.DBTX) error {
-		return s.repository.DeleteBookByID(ctx, tx, id)
-	}, tx...)
+func (s *service) DeleteBookByID(ctx context.Context, id uuid.UUID) error {
+	return s.db.Transactional(ctx, database.TxOptions{}, func(ctx context.Context) error {
+		return s.repository.DeleteBookByID(ctx, s.db.Conn(ctx), id)
+	})
 }
@@ -38,12 +38,14 @@ func main() {
 	}
 
 	// Repository and service initialization
-	repository := springbootlike.NewRepository()
+	repository := springbootlike.NewRepository(cfg.CursorKey)
 	service := springbootlike.NewService(mq, db, repository)
 
 	// API initialization
+	server.AddMiddleware(springbootlike.PrincipalMiddleware)
 	api := springbootlike.NewAPI(service)
 	api.InitAPI()
+	springbootlike.AddHealthRoutes(db)
 	docs.AddDocRoutes()
 
 	// Start the server
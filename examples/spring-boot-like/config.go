@@ -2,6 +2,7 @@ package springbootlike
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
 
 	"github.com/SeaRoll/zumi/config"
@@ -9,6 +10,8 @@ import (
 
 type AppConfig struct {
 	config.BaseConfig `yaml:",inline"`
+
+	CursorKey string `yaml:"cursorKey"` // The key the cursors of the books API are signed with, required
 }
 
 func (c AppConfig) GetBaseConfig() config.BaseConfig {
@@ -25,6 +28,11 @@ func LoadConfig() (AppConfig, error) {
 		return cfg, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// The cursor key has no default, so that cursors cannot be forged with a well-known key
+	if cfg.CursorKey == "" {
+		return cfg, errors.New("cursorKey is required, set the CURSOR_KEY environment variable")
+	}
+
 	// Return the parsed configuration
 	return cfg, nil
 }
@@ -4,16 +4,20 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/SeaRoll/zumi/database"
 	"github.com/SeaRoll/zumi/server"
 )
 
-func AddHealthRoutes() {
+func AddHealthRoutes(db database.Database) {
 	// Health check endpoint
 	//
+	// The service is unavailable while the database is unhealthy and being reconnected.
+	//
 	// gen:tag=Health
 	server.AddHandler("GET /api/v1/health", func(w http.ResponseWriter, r *http.Request) {
 		type HealthResponseDTO struct {
-			Status string `json:"status"`
+			Status   string          `json:"status"`
+			Database database.Health `json:"database"`
 		}
 
 		var req struct {
@@ -26,8 +30,19 @@ func AddHealthRoutes() {
 			return
 		}
 
+		health := db.Health()
+		if !health.Healthy {
+			server.WriteJSON(w, http.StatusServiceUnavailable, HealthResponseDTO{
+				Status:   "UNAVAILABLE",
+				Database: health,
+			})
+
+			return
+		}
+
 		server.WriteJSON(w, http.StatusOK, HealthResponseDTO{
-			Status: "OK",
+			Status:   "OK",
+			Database: health,
 		})
 	})
 }
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE books
+  ADD COLUMN version BIGINT NOT NULL DEFAULT 1,
+  ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE books
+  DROP COLUMN version,
+  DROP COLUMN created_at,
+  DROP COLUMN updated_at,
+  DROP COLUMN created_by;
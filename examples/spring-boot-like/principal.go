@@ -0,0 +1,20 @@
+package springbootlike
+
+import (
+	"net/http"
+
+	"github.com/SeaRoll/zumi/database"
+)
+
+// PrincipalMiddleware makes the user of the X-User header the principal of the request,
+// which the repository records as the creator of the books it inserts.
+// It stands in for the authentication of a real service, which must not trust a header sent by clients.
+func PrincipalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := r.Header.Get("X-User"); user != "" {
+			r = r.WithContext(database.ContextWithPrincipal(r.Context(), user))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
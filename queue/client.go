@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/SeaRoll/zumi/config"
@@ -17,9 +18,12 @@ import (
 //go:generate go run github.com/SeaRoll/interfacer/cmd -struct=queue -name=Queue -file=client_interface.go
 
 type queue struct {
+	nc          *nats.Conn
 	js          jetstream.JetStream
-	stream      jetstream.Stream
+	streams     []jetstream.Stream
 	retryPolicy retrypolicy.RetryPolicy[any]
+	scheduler   *scheduler
+	isTeardown  atomic.Bool
 }
 
 // Initializes a new Queue.
@@ -28,10 +32,16 @@ func NewQueue(params config.QueueConfig) (Queue, error) {
 		return nil, errors.New("queue is not enabled in the configuration")
 	}
 
-	// parse maxAge duration
-	maxAge, err := time.ParseDuration(params.MaxAge)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse maxAge duration: %w", err)
+	// parse stream configurations before connecting
+	desiredStreams := []jetstream.StreamConfig{}
+
+	for _, streamCfg := range streamConfigs(params) {
+		desired, err := toJetStreamConfig(streamCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse stream configuration: %w", err)
+		}
+
+		desiredStreams = append(desiredStreams, desired)
 	}
 
 	nc, err := nats.Connect(
@@ -56,41 +66,76 @@ func NewQueue(params config.QueueConfig) (Queue, error) {
 		return nil, fmt.Errorf("failed to create JetStream client: %w", err)
 	}
 
-	stream, err := js.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
-		Name:      params.Name,
-		Subjects:  []string{params.TopicPrefix + ".>"},
-		Retention: jetstream.LimitsPolicy,
-		MaxAge:    maxAge,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create or update stream: %w", err)
+	streams := []jetstream.Stream{}
+
+	for _, desired := range desiredStreams {
+		stream, err := reconcileStream(context.Background(), js, desired)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reconcile stream: %w", err)
+		}
+
+		streams = append(streams, stream)
 	}
 
 	retryPolicy := retrypolicy.Builder[any]().
 		WithBackoff(time.Second, 30*time.Second).
 		WithMaxRetries(5).
+		AbortOnErrors(nats.ErrConnectionClosed).
 		Build()
 
-	return &queue{
+	q := &queue{
+		nc:          nc,
 		js:          js,
-		stream:      stream,
+		streams:     streams,
 		retryPolicy: retryPolicy,
-	}, nil
+	}
+
+	if params.Scheduler.Enabled {
+		q.scheduler, err = newScheduler(js, params.Scheduler, q.publishWithID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create scheduler: %w", err)
+		}
+	}
+
+	return q, nil
+}
+
+// Disconnect stops all consumers and the scheduled message dispatcher, and closes the connection to NATS.
+// The queue cannot be used after it has been disconnected.
+func (p *queue) Disconnect() {
+	p.isTeardown.Store(true)
+
+	if p.scheduler != nil {
+		p.scheduler.stop()
+	}
+
+	p.nc.Close()
+	slog.Info("Disconnected from NATS server")
 }
 
 // Publishes a message to the specified topic.
 // The function accepts a variadic parameter for timeout duration, defaulting to 5 seconds if not provided.
 func (p *queue) Publish(topic string, message []byte, timeout ...time.Duration) error {
+	defaultTimeout := 5 * time.Second
+	if len(timeout) > 0 {
+		defaultTimeout = timeout[0]
+	}
+
+	return p.publish(topic, message, defaultTimeout)
+}
+
+// publishWithID publishes a message with a message ID, so that JetStream drops
+// duplicates of the same ID published within the stream's duplicate window.
+func (p *queue) publishWithID(topic string, message []byte, msgID string) error {
+	return p.publish(topic, message, 5*time.Second, jetstream.WithMsgID(msgID))
+}
+
+func (p *queue) publish(topic string, message []byte, timeout time.Duration, opts ...jetstream.PublishOpt) error {
 	err := failsafe.Run(func() error {
-		defaultTimeout := 5 * time.Second
-		if len(timeout) > 0 {
-			defaultTimeout = timeout[0]
-		}
-		// timeout with 5 seconds
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 
-		_, err := p.js.Publish(ctx, topic, message)
+		_, err := p.js.Publish(ctx, topic, message, opts...)
 		if err != nil {
 			return fmt.Errorf("failed to publish message to topic %s: %w", topic, err)
 		}
@@ -122,11 +167,16 @@ type CallbackFunc func(ctx context.Context, events []Event) []int
 // Configuration for a consumer.
 type ConsumerConfig struct {
 	ConsumerName    string         // The name for the consumer
+	Stream          string         // Optional stream to consume from, defaults to the first stream matching the topic
 	Topic           string         // The topic to listen on, e.g: events.books
 	FetchLimit      int            // The maximum number of messages to fetch per second
 	Callback        CallbackFunc   // The callback function to process messages
 	CallbackTimeout *time.Duration // Optional timeout for the callback function, defaults to 1 minute
 	Wait            *time.Duration // Optional wait time for the consumer before fetching messages, defaults to 1 second
+	DeliverPolicy   DeliverPolicy  // Optional start position of a new consumer, defaults to DeliverAll
+	StartSequence   uint64         // The stream sequence to start from when DeliverPolicy is DeliverByStartSequence
+	StartTime       *time.Time     // The time to start from when DeliverPolicy is DeliverByStartTime
+	Ephemeral       bool           // Optional non-durable consumer for one-off replays, ConsumerName is ignored
 }
 
 func (p *queue) getFetchWaitAndCallbackTimeout(config ConsumerConfig) (time.Duration, time.Duration) {
@@ -146,15 +196,20 @@ func (p *queue) getFetchWaitAndCallbackTimeout(config ConsumerConfig) (time.Dura
 // Runs a consumer by given configuration and callback function
 // OBS: This function is blocking, so make sure to run it in a goroutine if
 // you want to run other code in parallel.
+// The start position of a durable consumer is fixed once it is created, use ResetConsumer to move it.
 // Returns an error if the consumer could not be created or updated.
 func (p *queue) Consume(config ConsumerConfig) error {
-	cons, err := p.stream.CreateOrUpdateConsumer(
-		context.Background(),
-		jetstream.ConsumerConfig{
-			Name:          config.ConsumerName,
-			Durable:       config.ConsumerName,
-			FilterSubject: config.Topic,
-		})
+	stream, err := p.findStream(config.Stream, config.Topic)
+	if err != nil {
+		return fmt.Errorf("failed to find stream for consumer: %w", err)
+	}
+
+	consumerConfig, err := toJetStreamConsumerConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid consumer configuration: %w", err)
+	}
+
+	cons, err := stream.CreateOrUpdateConsumer(context.Background(), consumerConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create or update consumer: %w", err)
 	}
@@ -164,6 +219,12 @@ func (p *queue) Consume(config ConsumerConfig) error {
 	slog.Info("Listening on topic", "topic", config.Topic)
 
 	for {
+		// check if tearing down is requested
+		if p.isTeardown.Load() {
+			slog.Info("Queue is being torn down, stopping consumer", "consumer", config.ConsumerName)
+			return nil
+		}
+
 		msgs, err := p.fetchMessages(cons, config, fetchWait)
 		if err != nil {
 			slog.Error("Failed to fetch messages", "error", err, "consumer", config.ConsumerName, "subject", config.Topic)
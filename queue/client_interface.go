@@ -5,12 +5,35 @@ import "time"
 
 // Queue defines the public interface for queue.
 type Queue interface {
+	// CancelSchedule cancels a scheduled message by its schedule ID.
+	// Returns ErrScheduleNotFound if the message was already published or cancelled,
+	// and ErrScheduleDispatching if it is being published.
+	CancelSchedule(id string) error
 	// Runs a consumer by given configuration and callback function
 	// OBS: This function is blocking, so make sure to run it in a goroutine if
 	// you want to run other code in parallel.
+	// The start position of a durable consumer is fixed once it is created, use ResetConsumer to move it.
 	// Returns an error if the consumer could not be created or updated.
 	Consume(config ConsumerConfig) error
+	// Disconnect stops all consumers and the scheduled message dispatcher, and closes the connection to NATS.
+	// The queue cannot be used after it has been disconnected.
+	Disconnect()
 	// Publishes a message to the specified topic.
 	// The function accepts a variadic parameter for timeout duration, defaulting to 5 seconds if not provided.
 	Publish(topic string, message []byte, timeout ...time.Duration) error
+	// PublishAfter schedules a message to be published to the topic after the given delay.
+	// Returns the schedule ID which can be used to cancel the message.
+	PublishAfter(topic string, message []byte, delay time.Duration) (string, error)
+	// PublishAt schedules a message to be published to the topic at the given time.
+	// The schedule is stored durably in JetStream and survives restarts. It is published at least once:
+	// one replica of the dispatcher claims it at a time, but a replica which fails before removing a published
+	// schedule leaves it to be published again once its claim expires after 30 seconds. The schedule ID is the
+	// message ID, so the stream drops the duplicate if its duplicate window is longer than that.
+	// Returns the schedule ID which can be used to cancel the message.
+	PublishAt(topic string, message []byte, at time.Time) (string, error)
+	// ResetConsumer moves a durable consumer to the start position of the given configuration.
+	// JetStream does not allow changing the start position of an existing consumer,
+	// so the consumer is deleted and recreated. Any running Consume loop for the consumer
+	// should be stopped before calling this function, and restarted afterwards.
+	ResetConsumer(config ConsumerConfig) error
 }
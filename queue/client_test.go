@@ -1,4 +1,4 @@
-package queue
+package queue_test
 
 import (
 	"context"
@@ -6,70 +6,151 @@ import (
 	"time"
 
 	"github.com/SeaRoll/zumi/config"
+	"github.com/SeaRoll/zumi/queue"
+	"github.com/SeaRoll/zumi/queue/queuetest"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-const configYaml = `
-queue:
-  enabled: true
-  url: nats://localhost:4222
-  name: default
-  prefix: events
-  maxAge: 24h
-`
+func TestConformance(t *testing.T) {
+	queuetest.RunConformance(t, func(t *testing.T) queue.Queue {
+		srv := queuetest.NewServer(t)
+		cfg := srv.Config()
+		cfg.Scheduler = config.SchedulerConfig{Enabled: true, Interval: "50ms"}
 
-func setupQueue(ctx context.Context, t *testing.T) Queue {
-	t.Helper()
-
-	cfg, err := config.FromYAML[config.BaseConfig](configYaml)
-	if err != nil {
-		t.Fatalf("Failed to load config: %v", err)
-	}
-
-	t.Logf("Config: %+v", cfg)
-
-	queue, err := NewQueue(cfg.GetBaseConfig().Queue)
-	if err != nil {
-		t.Fatalf("Failed to create queue client: %v", err)
-	}
-
-	return queue
+		return srv.Queue(cfg)
+	})
 }
 
 // publish and subscribe a message
 func TestPublishSubscribe(t *testing.T) {
-	ctx := context.Background()
-	queue := setupQueue(ctx, t)
+	mq, _ := queuetest.New(t)
+	r := &queuetest.Receiver{}
 
-	var receivedMessage []byte
-
-	go queue.Consume(ConsumerConfig{
+	go mq.Consume(queue.ConsumerConfig{
 		ConsumerName: "api",
 		Topic:        "events.test",
 		FetchLimit:   1,
-		Callback: func(ctx context.Context, events []Event) []int {
-			if len(events) == 0 {
-				return []int{}
-			}
-			receivedMessage = events[0].Payload
-			return []int{events[0].Index}
-		},
+		Callback:     r.Callback,
 	})
 
-	err := queue.Publish("events.test", []byte("test message"))
+	err := mq.Publish("events.test", []byte("test message"))
 	if err != nil {
 		t.Fatalf("Failed to publish message: %v", err)
 	}
 
-	assert.Eventually(
-		t,
-		func() bool {
-			return receivedMessage != nil
+	r.AwaitReceived(t, "test message")
+}
+
+func TestMultipleStreams(t *testing.T) {
+	srv := queuetest.NewServer(t)
+	mq := srv.Queue(config.QueueConfig{
+		Streams: []config.StreamConfig{
+			{Name: "orders", Subjects: []string{"orders.>"}},
+			{Name: "jobs", Subjects: []string{"jobs.*"}, Retention: "workqueue"},
 		},
-		time.Duration(5*time.Second),
-		time.Duration(100*time.Millisecond),
-		"Message was not received in time",
-	)
+	})
+
+	orders := &queuetest.Receiver{}
+	jobs := &queuetest.Receiver{}
+
+	go mq.Consume(queue.ConsumerConfig{ConsumerName: "orders", Topic: "orders.created", FetchLimit: 10, Callback: orders.Callback})
+	go mq.Consume(queue.ConsumerConfig{ConsumerName: "jobs", Stream: "jobs", Topic: "jobs.email", FetchLimit: 10, Callback: jobs.Callback})
+
+	assert.NoError(t, mq.Publish("orders.created", []byte("order")))
+	assert.NoError(t, mq.Publish("jobs.email", []byte("job")))
+
+	orders.AwaitReceived(t, "order")
+	jobs.AwaitReceived(t, "job")
+
+	err := mq.Consume(queue.ConsumerConfig{ConsumerName: "unknown", Topic: "unknown.topic", FetchLimit: 1, Callback: orders.Callback})
+	assert.Error(t, err)
+}
+
+func TestReconcileStreamIsIdempotent(t *testing.T) {
+	srv := queuetest.NewServer(t)
+	cfg := srv.Config()
+
+	nc, err := nats.Connect(srv.URL())
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+
+	streamInfo := func() *jetstream.StreamInfo {
+		t.Helper()
+
+		stream, err := js.Stream(context.Background(), cfg.Name)
+		require.NoError(t, err)
+
+		info, err := stream.Info(context.Background())
+		require.NoError(t, err)
+
+		return info
+	}
+
+	srv.Queue(cfg)
+	created := streamInfo()
+	assert.Equal(t, time.Hour, created.Config.MaxAge)
+
+	// reconciling the same configuration leaves the stream untouched
+	srv.Queue(cfg)
+	assert.Equal(t, created.Config, streamInfo().Config)
+
+	// drift is detected and the stream is updated
+	cfg.MaxAge = "2h"
+	srv.Queue(cfg)
+
+	updated := streamInfo()
+	assert.Equal(t, 2*time.Hour, updated.Config.MaxAge)
+	assert.Equal(t, created.Created, updated.Created)
+}
+
+func TestSchedulerDisabled(t *testing.T) {
+	mq, _ := queuetest.New(t)
+
+	_, err := mq.PublishAt("events.reminders", []byte("reminder"), time.Now())
+	assert.ErrorIs(t, err, queue.ErrSchedulerDisabled)
+}
+
+func TestReconnect(t *testing.T) {
+	mq, srv := queuetest.New(t)
+	r := &queuetest.Receiver{}
+
+	go mq.Consume(queue.ConsumerConfig{ConsumerName: "api", Topic: "events.test", FetchLimit: 10, Callback: r.Callback})
+
+	assert.NoError(t, mq.Publish("events.test", []byte("before")))
+	r.AwaitReceived(t, "before")
+
+	srv.DisconnectClients()
+	assert.NoError(t, mq.Publish("events.test", []byte("after disconnect")))
+	r.AwaitReceived(t, "before", "after disconnect")
+
+	srv.Restart()
+	assert.NoError(t, mq.Publish("events.test", []byte("after restart")))
+	r.AwaitReceived(t, "before", "after disconnect", "after restart")
+}
+
+func TestSlowConsumer(t *testing.T) {
+	mq, _ := queuetest.New(t)
+	r := &queuetest.Receiver{}
+	callbackTimeout := 100 * time.Millisecond
+
+	// the callback times out before it processes anything, so nothing is acknowledged
+	go mq.Consume(queue.ConsumerConfig{
+		ConsumerName:    "slow",
+		Topic:           "events.slow",
+		FetchLimit:      1,
+		CallbackTimeout: &callbackTimeout,
+		Callback:        queuetest.SlowCallback(r.Callback, time.Second),
+	})
+
+	assert.NoError(t, mq.Publish("events.slow", []byte("slow")))
 
-	assert.Equal(t, []byte("test message"), receivedMessage)
+	assert.Never(t, func() bool {
+		return len(r.Received()) > 0
+	}, 500*time.Millisecond, 50*time.Millisecond)
 }
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DeliverPolicy determines where a newly created consumer starts reading the stream.
+type DeliverPolicy int
+
+const (
+	DeliverAll             DeliverPolicy = iota // Deliver every message retained in the stream (default)
+	DeliverNew                                  // Deliver only messages published after the consumer is created
+	DeliverByStartSequence                      // Deliver messages starting from ConsumerConfig.StartSequence
+	DeliverByStartTime                          // Deliver messages starting from ConsumerConfig.StartTime
+)
+
+// Ephemeral consumers are removed by the server once they have been inactive for this long.
+const ephemeralInactiveThreshold = 5 * time.Minute
+
+// toJetStreamConsumerConfig converts a consumer configuration into a JetStream consumer configuration.
+// Durable consumers are named by ConsumerName, while ephemeral consumers are named by the server.
+func toJetStreamConsumerConfig(config ConsumerConfig) (jetstream.ConsumerConfig, error) {
+	cfg := jetstream.ConsumerConfig{
+		FilterSubject: config.Topic,
+	}
+
+	if config.Ephemeral {
+		cfg.InactiveThreshold = ephemeralInactiveThreshold
+	} else {
+		if config.ConsumerName == "" {
+			return cfg, errors.New("consumer name cannot be empty for a durable consumer")
+		}
+
+		cfg.Name = config.ConsumerName
+		cfg.Durable = config.ConsumerName
+	}
+
+	switch config.DeliverPolicy {
+	case DeliverAll:
+		cfg.DeliverPolicy = jetstream.DeliverAllPolicy
+	case DeliverNew:
+		cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+	case DeliverByStartSequence:
+		if config.StartSequence == 0 {
+			return cfg, errors.New("start sequence is required when delivering by start sequence")
+		}
+
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = config.StartSequence
+	case DeliverByStartTime:
+		if config.StartTime == nil {
+			return cfg, errors.New("start time is required when delivering by start time")
+		}
+
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = config.StartTime
+	default:
+		return cfg, fmt.Errorf("unknown deliver policy %d", config.DeliverPolicy)
+	}
+
+	return cfg, nil
+}
+
+// ResetConsumer moves a durable consumer to the start position of the given configuration.
+// JetStream does not allow changing the start position of an existing consumer,
+// so the consumer is deleted and recreated. Any running Consume loop for the consumer
+// should be stopped before calling this function, and restarted afterwards.
+func (p *queue) ResetConsumer(config ConsumerConfig) error {
+	if config.Ephemeral {
+		return errors.New("cannot reset an ephemeral consumer")
+	}
+
+	cfg, err := toJetStreamConsumerConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid consumer configuration: %w", err)
+	}
+
+	stream, err := p.findStream(config.Stream, config.Topic)
+	if err != nil {
+		return fmt.Errorf("failed to find stream for consumer: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err = stream.DeleteConsumer(ctx, config.ConsumerName)
+	if err != nil && !errors.Is(err, jetstream.ErrConsumerNotFound) {
+		return fmt.Errorf("failed to delete consumer %s: %w", config.ConsumerName, err)
+	}
+
+	_, err = stream.CreateConsumer(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to recreate consumer %s: %w", config.ConsumerName, err)
+	}
+
+	slog.Info("Consumer reset", "consumer", config.ConsumerName, "deliverPolicy", cfg.DeliverPolicy.String())
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerStartPosition(t *testing.T) {
+	startTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("durable deliver all by default", func(t *testing.T) {
+		cfg, err := toJetStreamConsumerConfig(ConsumerConfig{ConsumerName: "api", Topic: "events.test"})
+		assert.NoError(t, err)
+		assert.Equal(t, "api", cfg.Durable)
+		assert.Equal(t, jetstream.DeliverAllPolicy, cfg.DeliverPolicy)
+	})
+
+	t.Run("by start sequence", func(t *testing.T) {
+		cfg, err := toJetStreamConsumerConfig(ConsumerConfig{
+			ConsumerName:  "api",
+			DeliverPolicy: DeliverByStartSequence,
+			StartSequence: 42,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, jetstream.DeliverByStartSequencePolicy, cfg.DeliverPolicy)
+		assert.Equal(t, uint64(42), cfg.OptStartSeq)
+
+		_, err = toJetStreamConsumerConfig(ConsumerConfig{ConsumerName: "api", DeliverPolicy: DeliverByStartSequence})
+		assert.Error(t, err)
+	})
+
+	t.Run("by start time", func(t *testing.T) {
+		cfg, err := toJetStreamConsumerConfig(ConsumerConfig{
+			ConsumerName:  "api",
+			DeliverPolicy: DeliverByStartTime,
+			StartTime:     &startTime,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, jetstream.DeliverByStartTimePolicy, cfg.DeliverPolicy)
+		assert.Equal(t, &startTime, cfg.OptStartTime)
+
+		_, err = toJetStreamConsumerConfig(ConsumerConfig{ConsumerName: "api", DeliverPolicy: DeliverByStartTime})
+		assert.Error(t, err)
+	})
+
+	t.Run("ephemeral", func(t *testing.T) {
+		cfg, err := toJetStreamConsumerConfig(ConsumerConfig{ConsumerName: "ignored", Ephemeral: true, DeliverPolicy: DeliverNew})
+		assert.NoError(t, err)
+		assert.Empty(t, cfg.Durable)
+		assert.Empty(t, cfg.Name)
+		assert.Equal(t, jetstream.DeliverNewPolicy, cfg.DeliverPolicy)
+		assert.Positive(t, cfg.InactiveThreshold)
+	})
+
+	t.Run("durable requires a name", func(t *testing.T) {
+		_, err := toJetStreamConsumerConfig(ConsumerConfig{Topic: "events.test"})
+		assert.Error(t, err)
+	})
+}
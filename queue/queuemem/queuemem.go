@@ -0,0 +1,482 @@
+// Package queuemem provides an in-memory implementation of queue.Queue for unit tests.
+// It records every published message, so that tests can assert on what a service published,
+// and delivers messages to consumers like JetStream does, without a NATS server.
+//
+// Differences to the NATS implementation:
+//   - every topic is accepted, streams are not checked
+//   - unacknowledged messages are redelivered on the next fetch instead of after an ack wait
+//   - scheduled messages are published when DispatchDue is called, or by running consumers
+//
+// Example usage:
+//
+//	mq := queuemem.New()
+//	service := NewService(mq, ...)
+//	_, _ = service.CreateBook(ctx, book)
+//	mq.AssertPublishedJSON(t, "events.books", expectedBook)
+package queuemem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SeaRoll/zumi/queue"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Clock returns the current time.
+type Clock func() time.Time
+
+// Message is a published message.
+type Message struct {
+	Sequence uint64    // The sequence of the message, starting at 1
+	Topic    string    // The topic the message was published to
+	Payload  []byte    // The data of the message
+	Time     time.Time // The time the message was published
+}
+
+// ScheduledMessage is a message waiting to be published.
+type ScheduledMessage struct {
+	ID      string
+	Topic   string
+	Payload []byte
+	RunAt   time.Time
+}
+
+type consumer struct {
+	topic    string
+	next     uint64   // the next sequence to deliver
+	inFlight []uint64 // sequences delivered to the callback
+	pending  []uint64 // sequences which were not acknowledged and must be redelivered
+}
+
+// Queue is an in-memory queue.Queue which records published messages.
+type Queue struct {
+	mu           sync.Mutex
+	now          Clock
+	messages     []Message
+	scheduled    map[string]ScheduledMessage
+	consumers    map[string]*consumer
+	publishErr   error
+	notify       chan struct{} // closed and replaced whenever a message is published
+	closed       chan struct{}
+	closeOnce    sync.Once
+	recordOffset int // messages before this index were cleared by Reset
+}
+
+var _ queue.Queue = (*Queue)(nil)
+
+// New creates an empty in-memory queue. The clock defaults to time.Now.
+func New(clock ...Clock) *Queue {
+	now := time.Now
+	if len(clock) > 0 && clock[0] != nil {
+		now = clock[0]
+	}
+
+	return &Queue{
+		now:       now,
+		scheduled: map[string]ScheduledMessage{},
+		consumers: map[string]*consumer{},
+		notify:    make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+}
+
+// Publishes a message to the specified topic.
+func (q *Queue) Publish(topic string, message []byte, _ ...time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.publishErr != nil {
+		return fmt.Errorf("failed to publish message to topic %s: %w", topic, q.publishErr)
+	}
+
+	q.publishLocked(topic, message)
+
+	return nil
+}
+
+// publishLocked appends a message and wakes up waiting consumers. Must be called with the lock held.
+func (q *Queue) publishLocked(topic string, message []byte) {
+	q.messages = append(q.messages, Message{
+		Sequence: uint64(len(q.messages)) + 1,
+		Topic:    topic,
+		Payload:  slices.Clone(message),
+		Time:     q.now(),
+	})
+
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// PublishAt schedules a message to be published to the topic at the given time.
+func (q *Queue) PublishAt(topic string, message []byte, at time.Time) (string, error) {
+	if topic == "" {
+		return "", errors.New("topic cannot be empty")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := uuid.NewString()
+	q.scheduled[id] = ScheduledMessage{ID: id, Topic: topic, Payload: slices.Clone(message), RunAt: at}
+
+	return id, nil
+}
+
+// PublishAfter schedules a message to be published to the topic after the given delay.
+func (q *Queue) PublishAfter(topic string, message []byte, delay time.Duration) (string, error) {
+	return q.PublishAt(topic, message, q.now().Add(delay))
+}
+
+// CancelSchedule cancels a scheduled message by its schedule ID.
+func (q *Queue) CancelSchedule(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.scheduled[id]; !ok {
+		return fmt.Errorf("failed to cancel schedule %s: %w", id, queue.ErrScheduleNotFound)
+	}
+
+	delete(q.scheduled, id)
+
+	return nil
+}
+
+// DispatchDue publishes every scheduled message which is due and returns the number of published messages.
+func (q *Queue) DispatchDue() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	due := []ScheduledMessage{}
+
+	for _, s := range q.scheduled {
+		if !s.RunAt.After(q.now()) {
+			due = append(due, s)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b ScheduledMessage) int { return a.RunAt.Compare(b.RunAt) })
+
+	for _, s := range due {
+		delete(q.scheduled, s.ID)
+		q.publishLocked(s.Topic, s.Payload)
+	}
+
+	return len(due)
+}
+
+// startSequence returns the first sequence a new consumer delivers. Must be called with the lock held.
+func (q *Queue) startSequence(config queue.ConsumerConfig) (uint64, error) {
+	switch config.DeliverPolicy {
+	case queue.DeliverAll:
+		return 1, nil
+	case queue.DeliverNew:
+		return uint64(len(q.messages)) + 1, nil
+	case queue.DeliverByStartSequence:
+		if config.StartSequence == 0 {
+			return 0, errors.New("start sequence is required when delivering by start sequence")
+		}
+
+		return config.StartSequence, nil
+	case queue.DeliverByStartTime:
+		if config.StartTime == nil {
+			return 0, errors.New("start time is required when delivering by start time")
+		}
+
+		for _, msg := range q.messages {
+			if !msg.Time.Before(*config.StartTime) {
+				return msg.Sequence, nil
+			}
+		}
+
+		return uint64(len(q.messages)) + 1, nil
+	default:
+		return 0, fmt.Errorf("unknown deliver policy %d", config.DeliverPolicy)
+	}
+}
+
+// consumer returns the durable consumer with the name of the configuration, or creates a new one.
+func (q *Queue) consumer(config queue.ConsumerConfig) (*consumer, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !config.Ephemeral {
+		if config.ConsumerName == "" {
+			return nil, errors.New("consumer name cannot be empty for a durable consumer")
+		}
+
+		if c, ok := q.consumers[config.ConsumerName]; ok {
+			return c, nil
+		}
+	}
+
+	next, err := q.startSequence(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid consumer configuration: %w", err)
+	}
+
+	c := &consumer{topic: config.Topic, next: next}
+	if !config.Ephemeral {
+		q.consumers[config.ConsumerName] = c
+	}
+
+	return c, nil
+}
+
+// ResetConsumer moves a durable consumer to the start position of the given configuration.
+func (q *Queue) ResetConsumer(config queue.ConsumerConfig) error {
+	if config.Ephemeral {
+		return errors.New("cannot reset an ephemeral consumer")
+	}
+
+	q.mu.Lock()
+	delete(q.consumers, config.ConsumerName)
+	q.mu.Unlock()
+
+	_, err := q.consumer(config)
+
+	return err
+}
+
+// fetch returns up to limit messages for the consumer, redelivering pending messages first.
+func (q *Queue) fetch(c *consumer, limit int) ([]Message, <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	batch := []Message{}
+
+	for len(batch) < limit && len(c.pending) > 0 {
+		batch = append(batch, q.messages[c.pending[0]-1])
+		c.pending = c.pending[1:]
+	}
+
+	for len(batch) < limit && c.next <= uint64(len(q.messages)) {
+		msg := q.messages[c.next-1]
+		c.next++
+
+		if topicMatches(c.topic, msg.Topic) {
+			batch = append(batch, msg)
+		}
+	}
+
+	c.inFlight = c.inFlight[:0]
+	for _, msg := range batch {
+		c.inFlight = append(c.inFlight, msg.Sequence)
+	}
+
+	return batch, q.notify
+}
+
+// ack acknowledges the in-flight messages at the given indices and marks the rest for redelivery.
+func (q *Queue) ack(c *consumer, indices []int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, seq := range c.inFlight {
+		if !slices.Contains(indices, i) {
+			c.pending = append(c.pending, seq)
+		}
+	}
+
+	c.inFlight = c.inFlight[:0]
+}
+
+// Runs a consumer by given configuration and callback function.
+// This function is blocking until the queue is disconnected.
+func (q *Queue) Consume(config queue.ConsumerConfig) error {
+	c, err := q.consumer(config)
+	if err != nil {
+		return err
+	}
+
+	limit := max(config.FetchLimit, 1)
+
+	fetchWait := time.Second
+	if config.Wait != nil {
+		fetchWait = *config.Wait
+	}
+
+	callbackTimeout := time.Minute
+	if config.CallbackTimeout != nil {
+		callbackTimeout = *config.CallbackTimeout
+	}
+
+	for {
+		select {
+		case <-q.closed:
+			return nil
+		default:
+		}
+
+		q.DispatchDue()
+
+		msgs, notify := q.fetch(c, limit)
+		if len(msgs) == 0 {
+			select {
+			case <-q.closed:
+				return nil
+			case <-notify:
+			case <-time.After(min(fetchWait, 100*time.Millisecond)):
+			}
+
+			continue
+		}
+
+		events := make([]queue.Event, len(msgs))
+		for i, msg := range msgs {
+			events[i] = queue.Event{Index: i, Payload: slices.Clone(msg.Payload)}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+		res := config.Callback(ctx, events)
+
+		cancel()
+		q.ack(c, res)
+	}
+}
+
+// Disconnect stops all consumers.
+func (q *Queue) Disconnect() {
+	q.closeOnce.Do(func() {
+		close(q.closed)
+	})
+}
+
+// SetPublishError makes every following Publish call fail with the given error, or succeed again if it is nil.
+func (q *Queue) SetPublishError(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.publishErr = err
+}
+
+// Published returns every message published since the queue was created or last reset.
+func (q *Queue) Published() []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return slices.Clone(q.messages[q.recordOffset:])
+}
+
+// PublishedTo returns the messages published to the topic since the queue was created or last reset.
+func (q *Queue) PublishedTo(topic string) []Message {
+	messages := []Message{}
+
+	for _, msg := range q.Published() {
+		if msg.Topic == topic {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
+
+// Scheduled returns the messages which are scheduled but not yet published.
+func (q *Queue) Scheduled() []ScheduledMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	scheduled := []ScheduledMessage{}
+	for _, s := range q.scheduled {
+		scheduled = append(scheduled, s)
+	}
+
+	slices.SortFunc(scheduled, func(a, b ScheduledMessage) int { return a.RunAt.Compare(b.RunAt) })
+
+	return scheduled
+}
+
+// Reset clears the recorded messages. Consumers keep their position.
+func (q *Queue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.recordOffset = len(q.messages)
+}
+
+// AssertPublished asserts that a message with the payload was published to the topic.
+func (q *Queue) AssertPublished(t assert.TestingT, topic string, payload []byte) bool {
+	for _, msg := range q.PublishedTo(topic) {
+		if bytes.Equal(msg.Payload, payload) {
+			return true
+		}
+	}
+
+	return assert.Fail(t, fmt.Sprintf("No message %q was published to topic %s", payload, topic), "published: %s", q.describe())
+}
+
+// AssertPublishedJSON asserts that a message which is JSON equal to expected was published to the topic.
+func (q *Queue) AssertPublishedJSON(t assert.TestingT, topic string, expected any) bool {
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("Failed to marshal expected message: %v", err))
+	}
+
+	for _, msg := range q.PublishedTo(topic) {
+		if jsonEqual(expectedJSON, msg.Payload) {
+			return true
+		}
+	}
+
+	return assert.Fail(t, fmt.Sprintf("No message %s was published to topic %s", expectedJSON, topic), "published: %s", q.describe())
+}
+
+// AssertPublishedCount asserts the number of messages published to the topic.
+func (q *Queue) AssertPublishedCount(t assert.TestingT, topic string, count int) bool {
+	return assert.Len(t, q.PublishedTo(topic), count, "Unexpected number of messages published to topic %s", topic)
+}
+
+// AssertNotPublished asserts that no message was published to the topic.
+func (q *Queue) AssertNotPublished(t assert.TestingT, topic string) bool {
+	return q.AssertPublishedCount(t, topic, 0)
+}
+
+func (q *Queue) describe() string {
+	descriptions := []string{}
+	for _, msg := range q.Published() {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", msg.Topic, msg.Payload))
+	}
+
+	return "[" + strings.Join(descriptions, ", ") + "]"
+}
+
+func jsonEqual(a, b []byte) bool {
+	var av, bv any
+
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+
+	return assert.ObjectsAreEqual(av, bv)
+}
+
+// topicMatches reports whether the topic is matched by the filter,
+// supporting the NATS `*` (single token) and `>` (one or more tokens) wildcards.
+func topicMatches(filter, topic string) bool {
+	if filter == "" {
+		return true
+	}
+
+	filterTokens := strings.Split(filter, ".")
+	topicTokens := strings.Split(topic, ".")
+
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(topicTokens) > i
+		}
+
+		if i >= len(topicTokens) || (token != "*" && token != topicTokens[i]) {
+			return false
+		}
+	}
+
+	return len(filterTokens) == len(topicTokens)
+}
@@ -0,0 +1,77 @@
+package queuemem
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/queue"
+	"github.com/SeaRoll/zumi/queue/queuetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// failureRecorder is an assert.TestingT which records failures instead of failing the test.
+type failureRecorder struct {
+	failed bool
+}
+
+func (f *failureRecorder) Errorf(string, ...any) {
+	f.failed = true
+}
+
+func TestConformance(t *testing.T) {
+	queuetest.RunConformance(t, func(t *testing.T) queue.Queue {
+		mq := New()
+		t.Cleanup(mq.Disconnect)
+
+		return mq
+	})
+}
+
+func TestRecording(t *testing.T) {
+	mq := New()
+
+	assert.NoError(t, mq.Publish("events.books", []byte(`{"id": 1, "title": "Go"}`)))
+	assert.NoError(t, mq.Publish("events.authors", []byte("author")))
+
+	mq.AssertPublished(t, "events.authors", []byte("author"))
+	mq.AssertPublishedJSON(t, "events.books", map[string]any{"title": "Go", "id": 1})
+	mq.AssertPublishedCount(t, "events.books", 1)
+	mq.AssertNotPublished(t, "events.orders")
+
+	recorder := &failureRecorder{}
+	assert.False(t, mq.AssertPublished(recorder, "events.books", []byte("missing")))
+	assert.True(t, recorder.failed, "assertion fails for a missing message")
+
+	mq.Reset()
+	assert.Empty(t, mq.Published())
+
+	publishErr := errors.New("nats is down")
+	mq.SetPublishError(publishErr)
+	assert.ErrorIs(t, mq.Publish("events.books", []byte("book")), publishErr)
+	mq.SetPublishError(nil)
+	assert.NoError(t, mq.Publish("events.books", []byte("book")))
+}
+
+func TestScheduledWithFakeClock(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	mq := New(func() time.Time { return now })
+
+	_, err := mq.PublishAfter("events.reminders", []byte("later"), time.Hour)
+	assert.NoError(t, err)
+
+	_, err = mq.PublishAfter("events.reminders", []byte("sooner"), 30*time.Minute)
+	assert.NoError(t, err)
+
+	assert.Len(t, mq.Scheduled(), 2)
+	assert.Equal(t, 0, mq.DispatchDue())
+
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, 1, mq.DispatchDue())
+	mq.AssertPublished(t, "events.reminders", []byte("sooner"))
+
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, 1, mq.DispatchDue())
+	assert.Empty(t, mq.Scheduled())
+	mq.AssertPublishedCount(t, "events.reminders", 2)
+}
@@ -0,0 +1,207 @@
+package queuetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Receiver collects the payloads of the events it receives, acknowledging all of them.
+type Receiver struct {
+	mu       sync.Mutex
+	payloads []string
+}
+
+// Callback is the queue.CallbackFunc of the receiver.
+func (r *Receiver) Callback(_ context.Context, events []queue.Event) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	processed := []int{}
+
+	for _, event := range events {
+		r.payloads = append(r.payloads, string(event.Payload))
+		processed = append(processed, event.Index)
+	}
+
+	return processed
+}
+
+// Received returns the payloads received so far.
+func (r *Receiver) Received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.payloads...)
+}
+
+// AwaitReceived waits until exactly the expected payloads are received, in any order.
+func (r *Receiver) AwaitReceived(t *testing.T, expected ...string) {
+	t.Helper()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.ElementsMatch(c, expected, r.Received())
+	}, 10*time.Second, 50*time.Millisecond, "Messages were not received in time")
+}
+
+// RunConformance runs the conformance test suite against the queues created by newQueue.
+// Every queue must capture the events.> topics and have scheduled publishing enabled,
+// and must not share messages with queues created for other tests.
+func RunConformance(t *testing.T, newQueue func(t *testing.T) queue.Queue) {
+	t.Helper()
+
+	t.Run("publish and consume", func(t *testing.T) {
+		mq := newQueue(t)
+		r := &Receiver{}
+
+		go func() {
+			_ = mq.Consume(queue.ConsumerConfig{ConsumerName: "api", Topic: "events.books", FetchLimit: 10, Callback: r.Callback})
+		}()
+
+		require.NoError(t, mq.Publish("events.books", []byte("book")))
+		require.NoError(t, mq.Publish("events.authors", []byte("author")))
+
+		r.AwaitReceived(t, "book")
+	})
+
+	t.Run("every durable consumer receives the message", func(t *testing.T) {
+		mq := newQueue(t)
+		first := &Receiver{}
+		second := &Receiver{}
+
+		go func() {
+			_ = mq.Consume(queue.ConsumerConfig{ConsumerName: "first", Topic: "events.*", FetchLimit: 1, Callback: first.Callback})
+		}()
+		go func() {
+			_ = mq.Consume(queue.ConsumerConfig{ConsumerName: "second", Topic: "events.>", FetchLimit: 1, Callback: second.Callback})
+		}()
+
+		require.NoError(t, mq.Publish("events.books", []byte("book")))
+
+		first.AwaitReceived(t, "book")
+		second.AwaitReceived(t, "book")
+	})
+
+	t.Run("replay from start sequence", func(t *testing.T) {
+		mq := newQueue(t)
+
+		for _, payload := range []string{"first", "second", "third"} {
+			require.NoError(t, mq.Publish("events.replay", []byte(payload)))
+		}
+
+		r := &Receiver{}
+
+		go func() {
+			_ = mq.Consume(queue.ConsumerConfig{
+				Topic:         "events.replay",
+				FetchLimit:    10,
+				Ephemeral:     true,
+				DeliverPolicy: queue.DeliverByStartSequence,
+				StartSequence: 2,
+				Callback:      r.Callback,
+			})
+		}()
+
+		r.AwaitReceived(t, "second", "third")
+	})
+
+	t.Run("deliver new", func(t *testing.T) {
+		mq := newQueue(t)
+
+		require.NoError(t, mq.Publish("events.books", []byte("old")))
+
+		// create the consumer before publishing, then start consuming
+		cfg := queue.ConsumerConfig{ConsumerName: "api", Topic: "events.books", FetchLimit: 10, DeliverPolicy: queue.DeliverNew}
+		require.NoError(t, mq.ResetConsumer(cfg))
+		require.NoError(t, mq.Publish("events.books", []byte("new")))
+
+		r := &Receiver{}
+		cfg.Callback = r.Callback
+
+		go func() { _ = mq.Consume(cfg) }()
+
+		r.AwaitReceived(t, "new")
+	})
+
+	t.Run("reset consumer", func(t *testing.T) {
+		mq := newQueue(t)
+
+		for _, payload := range []string{"first", "second"} {
+			require.NoError(t, mq.Publish("events.books", []byte(payload)))
+		}
+
+		cfg := queue.ConsumerConfig{
+			ConsumerName:  "projection",
+			Topic:         "events.books",
+			FetchLimit:    10,
+			DeliverPolicy: queue.DeliverByStartSequence,
+			StartSequence: 2,
+		}
+		require.NoError(t, mq.ResetConsumer(cfg))
+
+		r := &Receiver{}
+		cfg.Callback = r.Callback
+
+		go func() { _ = mq.Consume(cfg) }()
+
+		r.AwaitReceived(t, "second")
+
+		assert.Error(t, mq.ResetConsumer(queue.ConsumerConfig{Topic: "events.books", Ephemeral: true}))
+	})
+
+	t.Run("invalid consumer configuration", func(t *testing.T) {
+		mq := newQueue(t)
+
+		assert.Error(t, mq.Consume(queue.ConsumerConfig{Topic: "events.books", FetchLimit: 1}))
+		assert.Error(t, mq.Consume(queue.ConsumerConfig{
+			ConsumerName:  "api",
+			Topic:         "events.books",
+			FetchLimit:    1,
+			DeliverPolicy: queue.DeliverByStartTime,
+		}))
+	})
+
+	t.Run("publish after and cancel", func(t *testing.T) {
+		mq := newQueue(t)
+		r := &Receiver{}
+
+		go func() {
+			_ = mq.Consume(queue.ConsumerConfig{ConsumerName: "api", Topic: "events.reminders", FetchLimit: 10, Callback: r.Callback})
+		}()
+
+		_, err := mq.PublishAfter("events.reminders", []byte("reminder"), 200*time.Millisecond)
+		require.NoError(t, err)
+
+		cancelled, err := mq.PublishAfter("events.reminders", []byte("cancelled"), 200*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, mq.CancelSchedule(cancelled))
+		assert.ErrorIs(t, mq.CancelSchedule(cancelled), queue.ErrScheduleNotFound)
+
+		r.AwaitReceived(t, "reminder")
+	})
+
+	t.Run("disconnect stops consumers", func(t *testing.T) {
+		mq := newQueue(t)
+		done := make(chan error, 1)
+
+		go func() {
+			done <- mq.Consume(queue.ConsumerConfig{ConsumerName: "api", Topic: "events.books", FetchLimit: 1, Callback: (&Receiver{}).Callback})
+		}()
+
+		// give the consumer time to start
+		time.Sleep(100 * time.Millisecond)
+		mq.Disconnect()
+
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(15 * time.Second):
+			t.Fatal("Consumer did not stop after disconnect")
+		}
+	})
+}
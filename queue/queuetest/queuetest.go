@@ -0,0 +1,176 @@
+// Package queuetest runs an embedded NATS server with JetStream for tests,
+// so that code using the queue package can be tested without external infrastructure.
+//
+// Example usage:
+//
+//	func TestService(t *testing.T) {
+//	    mq, srv := queuetest.New(t)
+//	    ...
+//	    srv.DisconnectClients() // simulate a network failure
+//	}
+package queuetest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/SeaRoll/zumi/queue"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+const readyTimeout = 10 * time.Second
+
+// Server is an embedded NATS server with JetStream enabled, storing its data in a temporary directory.
+type Server struct {
+	t    testing.TB
+	opts *server.Options
+	srv  *server.Server
+}
+
+// NewServer starts an embedded NATS server with JetStream on a random port.
+// The server is shut down when the test finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		t: t,
+		opts: &server.Options{
+			Host:      "127.0.0.1",
+			Port:      server.RANDOM_PORT,
+			JetStream: true,
+			StoreDir:  t.TempDir(),
+			NoLog:     true,
+			NoSigs:    true,
+		},
+	}
+
+	s.start()
+
+	// keep the port on restarts, so that clients can reconnect
+	tcpAddr, ok := s.srv.Addr().(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("Unexpected NATS server address: %v", s.srv.Addr())
+	}
+
+	s.opts.Port = tcpAddr.Port
+
+	t.Cleanup(s.Shutdown)
+
+	return s
+}
+
+// New starts an embedded NATS server and returns a connected queue using the default configuration.
+func New(t testing.TB) (queue.Queue, *Server) {
+	t.Helper()
+
+	s := NewServer(t)
+
+	return s.Queue(s.Config()), s
+}
+
+func (s *Server) start() {
+	s.t.Helper()
+
+	srv, err := server.NewServer(s.opts)
+	if err != nil {
+		s.t.Fatalf("Failed to create NATS server: %v", err)
+	}
+
+	go srv.Start()
+
+	if !srv.ReadyForConnections(readyTimeout) {
+		s.t.Fatalf("NATS server was not ready for connections within %s", readyTimeout)
+	}
+
+	s.srv = srv
+}
+
+// URL returns the client URL of the server.
+func (s *Server) URL() string {
+	return s.srv.ClientURL()
+}
+
+// Config returns a queue configuration connecting to the server,
+// with a single stream named default capturing the events.> subjects.
+func (s *Server) Config() config.QueueConfig {
+	return config.QueueConfig{
+		Enabled:       true,
+		ConnectionUrl: s.URL(),
+		Name:          "default",
+		TopicPrefix:   "events",
+		MaxAge:        "1h",
+	}
+}
+
+// Queue connects a queue to the server using the given configuration.
+// The connection URL of the configuration is replaced by the URL of the server.
+// The queue is disconnected when the test finishes.
+func (s *Server) Queue(cfg config.QueueConfig) queue.Queue {
+	s.t.Helper()
+
+	cfg.Enabled = true
+	cfg.ConnectionUrl = s.URL()
+
+	q, err := queue.NewQueue(cfg)
+	if err != nil {
+		s.t.Fatalf("Failed to create queue: %v", err)
+	}
+
+	s.t.Cleanup(q.Disconnect)
+
+	return q
+}
+
+// DisconnectClients forcefully closes every client connection, simulating a network failure.
+// Clients reconnect automatically.
+func (s *Server) DisconnectClients() {
+	s.t.Helper()
+
+	connz, err := s.srv.Connz(&server.ConnzOptions{})
+	if err != nil {
+		s.t.Fatalf("Failed to list NATS connections: %v", err)
+	}
+
+	for _, conn := range connz.Conns {
+		err := s.srv.DisconnectClientByID(conn.Cid)
+		if err != nil {
+			s.t.Fatalf("Failed to disconnect NATS client %d: %v", conn.Cid, err)
+		}
+	}
+}
+
+// Shutdown stops the server, simulating an outage. It is safe to call more than once.
+func (s *Server) Shutdown() {
+	if s.srv == nil {
+		return
+	}
+
+	s.srv.Shutdown()
+	s.srv.WaitForShutdown()
+}
+
+// Restart stops the server and starts it again on the same port with the same data,
+// so that clients reconnect and previously stored messages are kept.
+func (s *Server) Restart() {
+	s.t.Helper()
+
+	s.Shutdown()
+	s.start()
+}
+
+// SlowCallback wraps a callback so that every invocation is delayed,
+// simulating a slow consumer. The delay is cut short when the callback context is done.
+func SlowCallback(callback queue.CallbackFunc, delay time.Duration) queue.CallbackFunc {
+	return func(ctx context.Context, events []queue.Event) []int {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return []int{}
+		}
+
+		return callback(ctx, events)
+	}
+}
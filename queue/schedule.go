@@ -0,0 +1,550 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	ErrSchedulerDisabled = errors.New("scheduled publishing is not enabled in the configuration")
+	ErrScheduleNotFound  = errors.New("schedule not found")
+	// ErrScheduleDispatching is returned by CancelSchedule when the message is being published, so it cannot be cancelled.
+	ErrScheduleDispatching = errors.New("schedule is being published")
+
+	// errScheduleConflict is returned by a schedule store when another replica changed the schedule first.
+	errScheduleConflict = errors.New("schedule was modified concurrently")
+)
+
+const (
+	defaultScheduleBucket   = "schedules"
+	defaultScheduleInterval = time.Second
+	// How long a replica owns a schedule it is dispatching before another replica may retry it.
+	scheduleClaimTTL = 30 * time.Second
+)
+
+// scheduledMessage is a message waiting to be published at RunAt.
+type scheduledMessage struct {
+	ID           string    `json:"id"`
+	Topic        string    `json:"topic"`
+	Payload      []byte    `json:"payload"`
+	RunAt        time.Time `json:"runAt"`
+	ClaimedUntil time.Time `json:"claimedUntil"`
+}
+
+// scheduleEntry is a stored scheduled message together with its revision in the store.
+type scheduleEntry struct {
+	message  scheduledMessage
+	revision uint64
+}
+
+// eligibleAt returns when the message may be dispatched: once it is due and not claimed by a replica.
+func (m scheduledMessage) eligibleAt() time.Time {
+	if m.ClaimedUntil.After(m.RunAt) {
+		return m.ClaimedUntil
+	}
+
+	return m.RunAt
+}
+
+// scheduleStore persists scheduled messages.
+// Updates are compare-and-swap on the revision, so that only one replica can claim a schedule.
+type scheduleStore interface {
+	put(ctx context.Context, message scheduledMessage) error
+	get(ctx context.Context, id string) (scheduleEntry, error)
+	// due returns the schedules which are eligible at the given time, see scheduledMessage.eligibleAt.
+	due(ctx context.Context, now time.Time) ([]scheduleEntry, error)
+	update(ctx context.Context, entry scheduleEntry) (uint64, error)
+	remove(ctx context.Context, id string, revision uint64) error
+}
+
+// scheduler publishes scheduled messages once they are due.
+type scheduler struct {
+	store   scheduleStore
+	publish func(topic string, message []byte, msgID string) error
+	now     func() time.Time
+	halt    context.CancelFunc // stops the dispatcher and watching the schedules of other replicas, nil if not started
+}
+
+// schedule stores a message to be published to the topic at the given time and returns its schedule ID.
+func (s *scheduler) schedule(ctx context.Context, topic string, message []byte, at time.Time) (string, error) {
+	if topic == "" {
+		return "", errors.New("topic cannot be empty")
+	}
+
+	id := uuid.NewString()
+
+	err := s.store.put(ctx, scheduledMessage{
+		ID:      id,
+		Topic:   topic,
+		Payload: message,
+		RunAt:   at.UTC(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store schedule: %w", err)
+	}
+
+	return id, nil
+}
+
+// cancel removes a schedule which has not been published yet.
+// A schedule claimed by a dispatcher is being published, and cannot be cancelled anymore.
+func (s *scheduler) cancel(ctx context.Context, id string) error {
+	for {
+		entry, err := s.store.get(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get schedule %s: %w", id, err)
+		}
+
+		if entry.message.ClaimedUntil.After(s.now()) {
+			return fmt.Errorf("failed to cancel schedule %s: %w", id, ErrScheduleDispatching)
+		}
+
+		err = s.store.remove(ctx, id, entry.revision)
+		if errors.Is(err, errScheduleConflict) {
+			continue // claimed meanwhile, read it again
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to cancel schedule %s: %w", id, err)
+		}
+
+		return nil
+	}
+}
+
+// dispatchDue publishes every due schedule and returns the number of published messages.
+// A schedule is first claimed by updating it with a compare-and-swap, so that concurrent
+// replicas skip it. The message is published with the schedule ID as message ID, which lets
+// JetStream deduplicate a retry after a replica crashed between publishing and removing.
+// A schedule which fails does not hold up the others, and the errors of every failed schedule are returned.
+func (s *scheduler) dispatchDue(ctx context.Context) (int, error) {
+	now := s.now()
+
+	entries, err := s.store.due(ctx, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due schedules: %w", err)
+	}
+
+	published := 0
+	errs := []error{}
+
+	for _, entry := range entries {
+		ok, err := s.dispatch(ctx, entry, now)
+		if err != nil {
+			slog.Error("Failed to dispatch scheduled message", "scheduleId", entry.message.ID, "error", err)
+			errs = append(errs, err)
+		}
+
+		if ok {
+			published++
+		}
+	}
+
+	return published, errors.Join(errs...)
+}
+
+// dispatch claims and publishes a due schedule, and returns whether it was published.
+// The claim is released when publishing fails, so that the schedule is retried on the next tick.
+func (s *scheduler) dispatch(ctx context.Context, entry scheduleEntry, now time.Time) (bool, error) {
+	if entry.message.eligibleAt().After(now) {
+		return false, nil
+	}
+
+	entry.message.ClaimedUntil = now.Add(scheduleClaimTTL)
+
+	revision, err := s.store.update(ctx, entry)
+	if errors.Is(err, errScheduleConflict) {
+		return false, nil // claimed or cancelled by someone else
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to claim schedule %s: %w", entry.message.ID, err)
+	}
+
+	err = s.publish(entry.message.Topic, entry.message.Payload, entry.message.ID)
+	if err != nil {
+		entry.message.ClaimedUntil = time.Time{}
+		entry.revision = revision
+
+		_, releaseErr := s.store.update(ctx, entry)
+
+		return false, errors.Join(fmt.Errorf("failed to publish schedule %s: %w", entry.message.ID, err), releaseErr)
+	}
+
+	err = s.store.remove(ctx, entry.message.ID, revision)
+	if err != nil && !errors.Is(err, errScheduleConflict) {
+		return true, fmt.Errorf("failed to remove schedule %s: %w", entry.message.ID, err)
+	}
+
+	return true, nil
+}
+
+// stop stops the dispatcher and watching the schedules.
+func (s *scheduler) stop() {
+	if s.halt != nil {
+		s.halt()
+	}
+}
+
+// run dispatches due schedules in the background at the given interval until the context is done.
+func (s *scheduler) run(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// a dispatch in progress is finished when tearing down, so that its claims are not left behind
+			dispatchCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+			_, err := s.dispatchDue(dispatchCtx)
+			if err != nil {
+				slog.Error("Failed to dispatch scheduled messages", "error", err)
+			}
+
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				slog.Info("Scheduler is being torn down, stopping dispatcher")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// newScheduler creates the key-value bucket for schedules and starts the dispatcher.
+func newScheduler(js jetstream.JetStream, params config.SchedulerConfig, publish func(string, []byte, string) error) (*scheduler, error) {
+	bucket := params.Bucket
+	if bucket == "" {
+		bucket = defaultScheduleBucket
+	}
+
+	interval, err := parseOptionalDuration(params.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse scheduler interval: %w", err)
+	}
+
+	if interval == 0 {
+		interval = defaultScheduleInterval
+	}
+
+	kv, err := js.CreateOrUpdateKeyValue(context.Background(), jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Scheduled messages waiting to be published",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule bucket %s: %w", bucket, err)
+	}
+
+	store := &kvScheduleStore{kv: kv, index: newScheduleIndex()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err = store.watch(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &scheduler{
+		store:   store,
+		publish: publish,
+		now:     time.Now,
+		halt:    cancel,
+	}
+
+	s.run(ctx, interval)
+
+	return s, nil
+}
+
+// kvScheduleStore stores schedules in a JetStream key-value bucket keyed by schedule ID.
+// The schedules are indexed by when they become eligible, so that finding the due schedules
+// does not read the whole bucket. The index is kept up to date with the writes of every replica
+// by watching the bucket.
+type kvScheduleStore struct {
+	kv    jetstream.KeyValue
+	index *scheduleIndex
+}
+
+// watch indexes the schedules of the bucket and keeps indexing its changes until the context is done.
+func (k *kvScheduleStore) watch(ctx context.Context) error {
+	watcher, err := k.kv.WatchAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to watch schedules: %w", err)
+	}
+
+	go func() {
+		defer func() { _ = watcher.Stop() }()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case kve, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+
+				// nil marks that the existing schedules were delivered
+				if kve != nil {
+					k.indexEntry(kve)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// indexEntry updates the index with a change of the bucket.
+func (k *kvScheduleStore) indexEntry(kve jetstream.KeyValueEntry) {
+	if kve.Operation() != jetstream.KeyValuePut {
+		k.index.remove(kve.Key())
+		return
+	}
+
+	var message scheduledMessage
+
+	err := json.Unmarshal(kve.Value(), &message)
+	if err != nil {
+		slog.Error("Failed to index schedule", "scheduleId", kve.Key(), "error", err)
+		return
+	}
+
+	k.index.set(message.ID, message.eligibleAt())
+}
+
+func (k *kvScheduleStore) put(ctx context.Context, message scheduledMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	_, err = k.kv.Create(ctx, message.ID, data)
+	if err != nil {
+		return fmt.Errorf("failed to create schedule: %w", err)
+	}
+
+	k.index.set(message.ID, message.eligibleAt())
+
+	return nil
+}
+
+func (k *kvScheduleStore) get(ctx context.Context, id string) (scheduleEntry, error) {
+	kve, err := k.kv.Get(ctx, id)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return scheduleEntry{}, ErrScheduleNotFound
+	}
+
+	if err != nil {
+		return scheduleEntry{}, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	var message scheduledMessage
+
+	err = json.Unmarshal(kve.Value(), &message)
+	if err != nil {
+		return scheduleEntry{}, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	return scheduleEntry{message: message, revision: kve.Revision()}, nil
+}
+
+func (k *kvScheduleStore) due(ctx context.Context, now time.Time) ([]scheduleEntry, error) {
+	entries := []scheduleEntry{}
+
+	for _, id := range k.index.due(now) {
+		entry, err := k.get(ctx, id)
+		if errors.Is(err, ErrScheduleNotFound) {
+			k.index.remove(id) // removed before the index was updated
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (k *kvScheduleStore) update(ctx context.Context, entry scheduleEntry) (uint64, error) {
+	data, err := json.Marshal(entry.message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	revision, err := k.kv.Update(ctx, entry.message.ID, data, entry.revision)
+	if isWrongLastSequence(err) {
+		return 0, errScheduleConflict
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to update schedule: %w", err)
+	}
+
+	k.index.set(entry.message.ID, entry.message.eligibleAt())
+
+	return revision, nil
+}
+
+func (k *kvScheduleStore) remove(ctx context.Context, id string, revision uint64) error {
+	err := k.kv.Purge(ctx, id, jetstream.LastRevision(revision))
+	if isWrongLastSequence(err) {
+		return errScheduleConflict
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to remove schedule: %w", err)
+	}
+
+	k.index.remove(id)
+
+	return nil
+}
+
+// scheduleIndex is the IDs of schedules sorted by when they become eligible.
+type scheduleIndex struct {
+	mu       sync.Mutex
+	eligible map[string]time.Time
+	sorted   []indexedSchedule // sorted by eligible time, then ID
+}
+
+type indexedSchedule struct {
+	at time.Time
+	id string
+}
+
+func newScheduleIndex() *scheduleIndex {
+	return &scheduleIndex{eligible: map[string]time.Time{}}
+}
+
+func compareIndexed(a, b indexedSchedule) int {
+	if c := a.at.Compare(b.at); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.id, b.id)
+}
+
+// set indexes the schedule at the time it becomes eligible, replacing its previous time.
+func (x *scheduleIndex) set(id string, at time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.removeLocked(id)
+
+	entry := indexedSchedule{at: at, id: id}
+	i, _ := slices.BinarySearchFunc(x.sorted, entry, compareIndexed)
+	x.sorted = slices.Insert(x.sorted, i, entry)
+	x.eligible[id] = at
+}
+
+// remove removes the schedule from the index.
+func (x *scheduleIndex) remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.removeLocked(id)
+}
+
+func (x *scheduleIndex) removeLocked(id string) {
+	at, ok := x.eligible[id]
+	if !ok {
+		return
+	}
+
+	if i, found := slices.BinarySearchFunc(x.sorted, indexedSchedule{at: at, id: id}, compareIndexed); found {
+		x.sorted = slices.Delete(x.sorted, i, i+1)
+	}
+
+	delete(x.eligible, id)
+}
+
+// due returns the IDs of the schedules which are eligible at the given time, the earliest first.
+func (x *scheduleIndex) due(now time.Time) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	ids := []string{}
+
+	for _, entry := range x.sorted {
+		if entry.at.After(now) {
+			break
+		}
+
+		ids = append(ids, entry.id)
+	}
+
+	return ids
+}
+
+// isWrongLastSequence reports whether a compare-and-swap write failed because the key has a newer revision.
+func isWrongLastSequence(err error) bool {
+	var apiErr *jetstream.APIError
+
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence
+}
+
+// PublishAt schedules a message to be published to the topic at the given time.
+// The schedule is stored durably in JetStream and survives restarts. It is published at least once:
+// one replica of the dispatcher claims it at a time, but a replica which fails before removing a published
+// schedule leaves it to be published again once its claim expires after 30 seconds. The schedule ID is the
+// message ID, so the stream drops the duplicate if its duplicate window is longer than that.
+// Returns the schedule ID which can be used to cancel the message.
+func (p *queue) PublishAt(topic string, message []byte, at time.Time) (string, error) {
+	if p.scheduler == nil {
+		return "", ErrSchedulerDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id, err := p.scheduler.schedule(ctx, topic, message, at)
+	if err != nil {
+		return "", fmt.Errorf("failed to schedule message to topic %s: %w", topic, err)
+	}
+
+	slog.Info("Message scheduled successfully", "topic", topic, "scheduleId", id, "runAt", at)
+
+	return id, nil
+}
+
+// PublishAfter schedules a message to be published to the topic after the given delay.
+// Returns the schedule ID which can be used to cancel the message.
+func (p *queue) PublishAfter(topic string, message []byte, delay time.Duration) (string, error) {
+	if p.scheduler == nil {
+		return "", ErrSchedulerDisabled
+	}
+
+	return p.PublishAt(topic, message, p.scheduler.now().Add(delay))
+}
+
+// CancelSchedule cancels a scheduled message by its schedule ID.
+// Returns ErrScheduleNotFound if the message was already published or cancelled,
+// and ErrScheduleDispatching if it is being published.
+func (p *queue) CancelSchedule(id string) error {
+	if p.scheduler == nil {
+		return ErrSchedulerDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return p.scheduler.cancel(ctx, id)
+}
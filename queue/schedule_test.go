@@ -0,0 +1,295 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryScheduleStore is an in-memory schedule store with compare-and-swap revisions.
+type memoryScheduleStore struct {
+	mu       sync.Mutex
+	entries  map[string]scheduleEntry
+	revision uint64
+}
+
+func newMemoryScheduleStore() *memoryScheduleStore {
+	return &memoryScheduleStore{entries: map[string]scheduleEntry{}}
+}
+
+func (m *memoryScheduleStore) put(_ context.Context, message scheduledMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revision++
+	m.entries[message.ID] = scheduleEntry{message: message, revision: m.revision}
+
+	return nil
+}
+
+func (m *memoryScheduleStore) get(_ context.Context, id string) (scheduleEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[id]
+	if !ok {
+		return scheduleEntry{}, ErrScheduleNotFound
+	}
+
+	return entry, nil
+}
+
+func (m *memoryScheduleStore) due(_ context.Context, now time.Time) ([]scheduleEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := []scheduleEntry{}
+
+	for _, entry := range m.entries {
+		if !entry.message.eligibleAt().After(now) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (m *memoryScheduleStore) update(_ context.Context, entry scheduleEntry) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.entries[entry.message.ID]
+	if !ok || current.revision != entry.revision {
+		return 0, errScheduleConflict
+	}
+
+	m.revision++
+	m.entries[entry.message.ID] = scheduleEntry{message: entry.message, revision: m.revision}
+
+	return m.revision, nil
+}
+
+func (m *memoryScheduleStore) remove(_ context.Context, id string, revision uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.entries[id]
+	if !ok || current.revision != revision {
+		return errScheduleConflict
+	}
+
+	delete(m.entries, id)
+
+	return nil
+}
+
+type publishedMessage struct {
+	topic   string
+	payload string
+	msgID   string
+}
+
+// newTestScheduler returns a scheduler with a controllable clock which records published messages.
+func newTestScheduler(store scheduleStore, now *time.Time) (*scheduler, *[]publishedMessage) {
+	published := &[]publishedMessage{}
+
+	return &scheduler{
+		store: store,
+		publish: func(topic string, message []byte, msgID string) error {
+			*published = append(*published, publishedMessage{topic: topic, payload: string(message), msgID: msgID})
+			return nil
+		},
+		now: func() time.Time { return *now },
+	}, published
+}
+
+func TestSchedulerDispatchesDueMessages(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, published := newTestScheduler(newMemoryScheduleStore(), &now)
+
+	id, err := s.schedule(ctx, "events.reminders", []byte("reminder"), now.Add(30*time.Minute))
+	assert.NoError(t, err)
+
+	count, err := s.dispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count, "nothing is due yet")
+
+	now = now.Add(30 * time.Minute)
+
+	count, err = s.dispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []publishedMessage{{topic: "events.reminders", payload: "reminder", msgID: id}}, *published)
+
+	count, err = s.dispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count, "published messages are removed")
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, published := newTestScheduler(newMemoryScheduleStore(), &now)
+
+	id, err := s.schedule(ctx, "events.reminders", []byte("reminder"), now.Add(time.Minute))
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.cancel(ctx, id))
+	assert.ErrorIs(t, s.cancel(ctx, id), ErrScheduleNotFound)
+
+	now = now.Add(time.Hour)
+
+	count, err := s.dispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Empty(t, *published)
+}
+
+func TestSchedulerPublishesOnceAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryScheduleStore()
+	first, firstPublished := newTestScheduler(store, &now)
+	second, secondPublished := newTestScheduler(store, &now)
+
+	for range 10 {
+		_, err := first.schedule(ctx, "events.reminders", []byte("reminder"), now)
+		assert.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, s := range []*scheduler{first, second} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := s.dispatchDue(ctx)
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Len(t, append(*firstPublished, *secondPublished...), 10)
+}
+
+func TestSchedulerRetriesExpiredClaims(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryScheduleStore()
+	s, published := newTestScheduler(store, &now)
+
+	id, err := s.schedule(ctx, "events.reminders", []byte("reminder"), now)
+	assert.NoError(t, err)
+
+	// simulate a replica which claimed the schedule and crashed before publishing
+	entry, err := store.get(ctx, id)
+	assert.NoError(t, err)
+
+	entry.message.ClaimedUntil = now.Add(scheduleClaimTTL)
+	_, err = store.update(ctx, entry)
+	assert.NoError(t, err)
+
+	count, err := s.dispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count, "claimed schedules are skipped")
+
+	now = now.Add(scheduleClaimTTL)
+
+	count, err = s.dispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, id, (*published)[0].msgID)
+}
+
+func TestSchedulerCancelRejectsClaimedSchedules(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryScheduleStore()
+	s, _ := newTestScheduler(store, &now)
+
+	id, err := s.schedule(ctx, "events.reminders", []byte("reminder"), now)
+	require.NoError(t, err)
+
+	// simulate a replica which claimed the schedule and is publishing it
+	entry, err := store.get(ctx, id)
+	require.NoError(t, err)
+
+	entry.message.ClaimedUntil = now.Add(scheduleClaimTTL)
+	_, err = store.update(ctx, entry)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.cancel(ctx, id), ErrScheduleDispatching)
+
+	// an expired claim belongs to a crashed replica, so the schedule can be cancelled
+	now = now.Add(scheduleClaimTTL + time.Second)
+
+	assert.NoError(t, s.cancel(ctx, id))
+}
+
+func TestSchedulerContinuesAfterFailedPublish(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryScheduleStore()
+	s, published := newTestScheduler(store, &now)
+
+	failing, err := s.schedule(ctx, "events.failing", []byte("failing"), now)
+	require.NoError(t, err)
+
+	_, err = s.schedule(ctx, "events.reminders", []byte("reminder"), now)
+	require.NoError(t, err)
+
+	publish := s.publish
+	s.publish = func(topic string, message []byte, msgID string) error {
+		if topic == "events.failing" {
+			return errors.New("unavailable")
+		}
+
+		return publish(topic, message, msgID)
+	}
+
+	count, err := s.dispatchDue(ctx)
+	assert.ErrorContains(t, err, "unavailable")
+	assert.Equal(t, 1, count, "the other schedules are published")
+	assert.Equal(t, "events.reminders", (*published)[0].topic)
+
+	// the claim of the failed schedule is released, so it is retried on the next tick
+	entry, err := store.get(ctx, failing)
+	require.NoError(t, err)
+	assert.True(t, entry.message.ClaimedUntil.IsZero())
+
+	s.publish = publish
+
+	count, err = s.dispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, failing, (*published)[1].msgID)
+}
+
+func TestScheduleIndex(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	index := newScheduleIndex()
+
+	index.set("later", now.Add(time.Hour))
+	index.set("b", now)
+	index.set("a", now)
+	index.set("earlier", now.Add(-time.Minute))
+
+	assert.Equal(t, []string{"earlier", "a", "b"}, index.due(now))
+
+	// claiming a schedule moves it to the end of its claim
+	index.set("a", now.Add(scheduleClaimTTL))
+	assert.Equal(t, []string{"earlier", "b"}, index.due(now))
+
+	index.remove("earlier")
+	index.remove("unknown")
+	assert.Equal(t, []string{"b", "a", "later"}, index.due(now.Add(time.Hour)))
+}
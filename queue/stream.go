@@ -0,0 +1,295 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrImmutableStreamConfig is returned by NewQueue when the configuration of an existing stream changes
+// a field which JetStream cannot update, so that the stream has to be migrated by hand.
+var ErrImmutableStreamConfig = errors.New("stream configuration cannot be updated")
+
+// streamConfigs returns the streams declared in the configuration.
+// If no streams are declared, a single stream is built from the legacy name, prefix and maxAge fields.
+func streamConfigs(params config.QueueConfig) []config.StreamConfig {
+	if len(params.Streams) > 0 {
+		return params.Streams
+	}
+
+	return []config.StreamConfig{{
+		Name:     params.Name,
+		Subjects: []string{params.TopicPrefix + ".>"},
+		MaxAge:   params.MaxAge,
+	}}
+}
+
+// toJetStreamConfig converts a stream configuration into a JetStream stream configuration.
+// Unset limits are normalised to the values the server reports, so that drift detection
+// does not flag defaults as changes.
+func toJetStreamConfig(cfg config.StreamConfig) (jetstream.StreamConfig, error) {
+	if cfg.Name == "" {
+		return jetstream.StreamConfig{}, errors.New("stream name cannot be empty")
+	}
+
+	if len(cfg.Subjects) == 0 {
+		return jetstream.StreamConfig{}, fmt.Errorf("stream %s must have at least one subject", cfg.Name)
+	}
+
+	retention, err := parseRetention(cfg.Retention)
+	if err != nil {
+		return jetstream.StreamConfig{}, fmt.Errorf("invalid stream %s: %w", cfg.Name, err)
+	}
+
+	storage, err := parseStorage(cfg.Storage)
+	if err != nil {
+		return jetstream.StreamConfig{}, fmt.Errorf("invalid stream %s: %w", cfg.Name, err)
+	}
+
+	discard, err := parseDiscard(cfg.Discard)
+	if err != nil {
+		return jetstream.StreamConfig{}, fmt.Errorf("invalid stream %s: %w", cfg.Name, err)
+	}
+
+	maxAge, err := parseOptionalDuration(cfg.MaxAge)
+	if err != nil {
+		return jetstream.StreamConfig{}, fmt.Errorf("failed to parse maxAge duration of stream %s: %w", cfg.Name, err)
+	}
+
+	duplicates, err := parseOptionalDuration(cfg.DuplicateWindow)
+	if err != nil {
+		return jetstream.StreamConfig{}, fmt.Errorf("failed to parse duplicateWindow duration of stream %s: %w", cfg.Name, err)
+	}
+
+	if duplicates == 0 {
+		duplicates = 2 * time.Minute // server default
+	}
+
+	replicas := max(cfg.Replicas, 1)
+
+	maxBytes := cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = -1
+	}
+
+	maxMsgs := cfg.MaxMsgs
+	if maxMsgs <= 0 {
+		maxMsgs = -1
+	}
+
+	return jetstream.StreamConfig{
+		Name:       cfg.Name,
+		Subjects:   cfg.Subjects,
+		Retention:  retention,
+		Storage:    storage,
+		Replicas:   replicas,
+		MaxAge:     maxAge,
+		MaxBytes:   maxBytes,
+		MaxMsgs:    maxMsgs,
+		Discard:    discard,
+		Duplicates: duplicates,
+	}, nil
+}
+
+func parseRetention(value string) (jetstream.RetentionPolicy, error) {
+	switch strings.ToLower(value) {
+	case "", "limits":
+		return jetstream.LimitsPolicy, nil
+	case "interest":
+		return jetstream.InterestPolicy, nil
+	case "workqueue":
+		return jetstream.WorkQueuePolicy, nil
+	default:
+		return 0, fmt.Errorf("unknown retention policy %q", value)
+	}
+}
+
+func parseStorage(value string) (jetstream.StorageType, error) {
+	switch strings.ToLower(value) {
+	case "", "file":
+		return jetstream.FileStorage, nil
+	case "memory":
+		return jetstream.MemoryStorage, nil
+	default:
+		return 0, fmt.Errorf("unknown storage type %q", value)
+	}
+}
+
+func parseDiscard(value string) (jetstream.DiscardPolicy, error) {
+	switch strings.ToLower(value) {
+	case "", "old":
+		return jetstream.DiscardOld, nil
+	case "new":
+		return jetstream.DiscardNew, nil
+	default:
+		return 0, fmt.Errorf("unknown discard policy %q", value)
+	}
+}
+
+func parseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration %q: %w", value, err)
+	}
+
+	return d, nil
+}
+
+// streamDrift returns a human readable description of every field that differs
+// between the configuration on the server and the desired configuration.
+// It fails with ErrImmutableStreamConfig if a field differs which JetStream cannot update:
+// the storage, and the retention when changing to or from the work queue policy.
+func streamDrift(current, desired jetstream.StreamConfig) ([]string, error) {
+	if current.Storage != desired.Storage {
+		return nil, fmt.Errorf("%w: storage of stream %s cannot change from %v to %v",
+			ErrImmutableStreamConfig, desired.Name, current.Storage, desired.Storage)
+	}
+
+	if current.Retention != desired.Retention &&
+		(current.Retention == jetstream.WorkQueuePolicy || desired.Retention == jetstream.WorkQueuePolicy) {
+		return nil, fmt.Errorf("%w: retention of stream %s cannot change from %v to %v",
+			ErrImmutableStreamConfig, desired.Name, current.Retention, desired.Retention)
+	}
+
+	drift := []string{}
+
+	addDrift := func(field string, from, to any) {
+		drift = append(drift, fmt.Sprintf("%s: %v -> %v", field, from, to))
+	}
+
+	if !slices.Equal(current.Subjects, desired.Subjects) {
+		addDrift("subjects", current.Subjects, desired.Subjects)
+	}
+
+	if current.Retention != desired.Retention {
+		addDrift("retention", current.Retention, desired.Retention)
+	}
+
+	if current.Replicas != desired.Replicas {
+		addDrift("replicas", current.Replicas, desired.Replicas)
+	}
+
+	if current.MaxAge != desired.MaxAge {
+		addDrift("maxAge", current.MaxAge, desired.MaxAge)
+	}
+
+	if current.MaxBytes != desired.MaxBytes {
+		addDrift("maxBytes", current.MaxBytes, desired.MaxBytes)
+	}
+
+	if current.MaxMsgs != desired.MaxMsgs {
+		addDrift("maxMsgs", current.MaxMsgs, desired.MaxMsgs)
+	}
+
+	if current.Discard != desired.Discard {
+		addDrift("discard", current.Discard, desired.Discard)
+	}
+
+	if current.Duplicates != desired.Duplicates {
+		addDrift("duplicateWindow", current.Duplicates, desired.Duplicates)
+	}
+
+	return drift, nil
+}
+
+// reconcileStream makes sure the stream exists on the server with the desired configuration.
+// Creating or updating is idempotent: a stream which is already up to date is left untouched,
+// and any drift between the server and the configuration is logged before it is updated,
+// unless it cannot be updated, see streamDrift.
+func reconcileStream(ctx context.Context, js jetstream.JetStream, desired jetstream.StreamConfig) (jetstream.Stream, error) {
+	stream, err := js.Stream(ctx, desired.Name)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		stream, err = js.CreateStream(ctx, desired)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream %s: %w", desired.Name, err)
+		}
+
+		slog.Info("Created stream", "stream", desired.Name, "subjects", desired.Subjects)
+
+		return stream, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream %s: %w", desired.Name, err)
+	}
+
+	drift, err := streamDrift(stream.CachedInfo().Config, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(drift) == 0 {
+		return stream, nil
+	}
+
+	slog.Warn("Stream configuration drift detected", "stream", desired.Name, "drift", drift)
+
+	stream, err = js.UpdateStream(ctx, desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update stream %s: %w", desired.Name, err)
+	}
+
+	return stream, nil
+}
+
+// subjectMatches reports whether the subject is matched by the pattern,
+// supporting the NATS `*` (single token) and `>` (one or more tokens) wildcards.
+func subjectMatches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+
+		if i >= len(subjectTokens) {
+			return false
+		}
+
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// findStream returns the stream a consumer should be created on.
+// If a stream name is given it must be one of the reconciled streams,
+// otherwise the first stream whose subjects match the topic is used.
+func (p *queue) findStream(name string, topic string) (jetstream.Stream, error) {
+	for _, stream := range p.streams {
+		info := stream.CachedInfo()
+		if name != "" {
+			if info.Config.Name == name {
+				return stream, nil
+			}
+
+			continue
+		}
+
+		for _, subject := range info.Config.Subjects {
+			if subjectMatches(subject, topic) {
+				return stream, nil
+			}
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("stream %s is not configured", name)
+	}
+
+	return nil, fmt.Errorf("no stream is configured for topic %s", topic)
+}
@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SeaRoll/zumi/config"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+const legacyConfigYaml = `
+queue:
+  enabled: true
+  url: nats://localhost:4222
+  name: default
+  prefix: events
+  maxAge: 24h
+`
+
+const multiStreamConfigYaml = `
+queue:
+  enabled: true
+  url: nats://localhost:4222
+  streams:
+    - name: orders
+      subjects: ["orders.>"]
+      maxAge: 1h
+      duplicateWindow: 1m
+    - name: jobs
+      subjects: ["jobs.*"]
+      retention: workqueue
+      storage: memory
+      maxMsgs: 1000
+      discard: new
+`
+
+func TestStreamConfigs(t *testing.T) {
+	t.Run("legacy configuration", func(t *testing.T) {
+		cfg, err := config.FromYAML[config.BaseConfig](legacyConfigYaml)
+		assert.NoError(t, err)
+
+		streams := streamConfigs(cfg.Queue)
+		assert.Len(t, streams, 1)
+
+		desired, err := toJetStreamConfig(streams[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "default", desired.Name)
+		assert.Equal(t, []string{"events.>"}, desired.Subjects)
+		assert.Equal(t, jetstream.LimitsPolicy, desired.Retention)
+		assert.Equal(t, 24*time.Hour, desired.MaxAge)
+		assert.Equal(t, 1, desired.Replicas)
+		assert.Equal(t, int64(-1), desired.MaxBytes)
+	})
+
+	t.Run("multiple streams", func(t *testing.T) {
+		cfg, err := config.FromYAML[config.BaseConfig](multiStreamConfigYaml)
+		assert.NoError(t, err)
+
+		streams := streamConfigs(cfg.Queue)
+		assert.Len(t, streams, 2)
+
+		orders, err := toJetStreamConfig(streams[0])
+		assert.NoError(t, err)
+		assert.Equal(t, time.Hour, orders.MaxAge)
+		assert.Equal(t, time.Minute, orders.Duplicates)
+
+		jobs, err := toJetStreamConfig(streams[1])
+		assert.NoError(t, err)
+		assert.Equal(t, jetstream.WorkQueuePolicy, jobs.Retention)
+		assert.Equal(t, jetstream.MemoryStorage, jobs.Storage)
+		assert.Equal(t, int64(1000), jobs.MaxMsgs)
+		assert.Equal(t, jetstream.DiscardNew, jobs.Discard)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, err := toJetStreamConfig(config.StreamConfig{Name: "a", Subjects: []string{"a.>"}, Retention: "forever"})
+		assert.Error(t, err)
+
+		_, err = toJetStreamConfig(config.StreamConfig{Name: "a"})
+		assert.Error(t, err)
+
+		_, err = toJetStreamConfig(config.StreamConfig{Name: "a", Subjects: []string{"a.>"}, MaxAge: "soon"})
+		assert.Error(t, err)
+	})
+}
+
+func TestStreamDrift(t *testing.T) {
+	desired, err := toJetStreamConfig(config.StreamConfig{Name: "a", Subjects: []string{"a.>"}, MaxAge: "1h"})
+	assert.NoError(t, err)
+
+	drift, err := streamDrift(desired, desired)
+	assert.NoError(t, err)
+	assert.Empty(t, drift)
+
+	current := desired
+	current.MaxAge = 2 * time.Hour
+	current.Replicas = 3
+
+	drift, err = streamDrift(current, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"replicas: 3 -> 1", "maxAge: 2h0m0s -> 1h0m0s"}, drift)
+
+	current = desired
+	current.Retention = jetstream.InterestPolicy
+
+	drift, err = streamDrift(current, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"retention: Interest -> Limits"}, drift)
+
+	current = desired
+	current.Storage = jetstream.MemoryStorage
+
+	_, err = streamDrift(current, desired)
+	assert.ErrorIs(t, err, ErrImmutableStreamConfig)
+	assert.ErrorContains(t, err, "storage of stream a cannot change from Memory to File")
+
+	current = desired
+	current.Retention = jetstream.WorkQueuePolicy
+
+	_, err = streamDrift(current, desired)
+	assert.ErrorIs(t, err, ErrImmutableStreamConfig)
+	assert.ErrorContains(t, err, "retention of stream a")
+}
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		subject  string
+		expected bool
+	}{
+		{"events.>", "events.books", true},
+		{"events.>", "events.books.created", true},
+		{"events.>", "events", false},
+		{"events.*", "events.books", true},
+		{"events.*", "events.books.created", false},
+		{"events.books", "events.books", true},
+		{"events.books", "events.authors", false},
+		{"*.books", "events.books", true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, subjectMatches(tt.pattern, tt.subject), "%s ~ %s", tt.pattern, tt.subject)
+	}
+}
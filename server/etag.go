@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag returns the strong entity tag of the version of an entity, e.g: `"3"`.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// SetETag sets the ETag header of the response to the entity tag of the version, see ETag.
+// Clients send it back in the If-Match header of updates, see ParseIfMatch. Set it before writing the response.
+func SetETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", ETag(version))
+}
+
+// ErrPreconditionFailed is matched by every error caused by an If-Match header which cannot match the current version.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// PreconditionError describes why an If-Match header cannot match the current version of an entity.
+// It matches ErrPreconditionFailed and is returned to clients with HTTP status 412.
+type PreconditionError struct {
+	Reason string // Why the precondition cannot match
+}
+
+func (e *PreconditionError) Error() string {
+	return "precondition failed: " + e.Reason
+}
+
+func (e *PreconditionError) Is(target error) bool {
+	return target == ErrPreconditionFailed
+}
+
+// HTTPStatus returns the HTTP status code the error should be returned to clients with.
+func (e *PreconditionError) HTTPStatus() int {
+	return http.StatusPreconditionFailed
+}
+
+// IfMatch is the precondition of an If-Match header.
+type IfMatch struct {
+	Present bool  // Whether the header is set
+	Any     bool  // Whether the header is "*", which matches any current version
+	Version int64 // The version of the entity tag, see ETag, set if the header is present and not "*"
+}
+
+// ParseIfMatch parses an If-Match header. An empty header is not present, and "*" matches any version.
+// Weak entity tags, lists of entity tags and entity tags which are not a version never match the version
+// of an update, which needs exactly one strong entity tag, so they fail with a PreconditionError.
+// A malformed header fails with another error, to be returned with status 400.
+//
+// Example usage:
+//
+//	ifMatch, err := server.ParseIfMatch(r.Header.Get("If-Match"))
+//	if err != nil {
+//	    server.WriteErrorFrom(w, err, http.StatusBadRequest)
+//	    return
+//	}
+func ParseIfMatch(header string) (IfMatch, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return IfMatch{}, nil
+	}
+
+	if header == "*" {
+		return IfMatch{Present: true, Any: true}, nil
+	}
+
+	if strings.Contains(header, ",") {
+		return IfMatch{}, &PreconditionError{Reason: "lists of entity tags cannot match a single version"}
+	}
+
+	if strings.HasPrefix(header, "W/") {
+		return IfMatch{}, &PreconditionError{Reason: "weak entity tags cannot match in If-Match"}
+	}
+
+	unquoted, ok := strings.CutPrefix(header, `"`)
+	if ok {
+		unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	}
+
+	if !ok {
+		return IfMatch{}, fmt.Errorf("invalid entity tag %s in If-Match", header)
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil {
+		return IfMatch{}, &PreconditionError{Reason: fmt.Sprintf("entity tag %s is not a version", header)}
+	}
+
+	return IfMatch{Present: true, Version: version}, nil
+}
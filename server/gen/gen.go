@@ -14,6 +14,7 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"go/types"
 	"log"
@@ -79,12 +80,16 @@ var httpStatusMap = map[string]int{
 	"StatusUnauthorized":        http.StatusUnauthorized,
 	"StatusForbidden":           http.StatusForbidden,
 	"StatusNotFound":            http.StatusNotFound,
+	"StatusConflict":            http.StatusConflict,
+	"StatusPreconditionFailed":  http.StatusPreconditionFailed,
+	"StatusUnprocessableEntity": http.StatusUnprocessableEntity,
 	"StatusInternalServerError": http.StatusInternalServerError,
 	"StatusServiceUnavailable":  http.StatusServiceUnavailable,
 }
 
 // schemaGenerator holds the state for the generation process.
 type schemaGenerator struct {
+	pkg            *packages.Package
 	typesInfo      *types.Info
 	openAPISpec    *openapi3.T
 	generatedTypes map[string]*openapi3.SchemaRef
@@ -149,6 +154,7 @@ func Generate(pattern string) ([]byte, error) {
 	}
 
 	for _, pkg := range pkgs {
+		gen.pkg = pkg
 		gen.typesInfo = pkg.TypesInfo
 		for _, file := range pkg.Syntax {
 			ast.Inspect(file, func(n ast.Node) bool {
@@ -365,6 +371,15 @@ func (g *schemaGenerator) findRequestAndResponseTypes(fn *ast.FuncLit) (*types.S
 			isWriteJSON := sel.Sel.Name == "WriteJSON"
 			isWriteError := sel.Sel.Name == "WriteError"
 
+			// WriteErrorFrom(w, err, fallback) documents its fallback status code
+			if sel.Sel.Name == "WriteErrorFrom" && len(call.Args) >= 3 {
+				if statusCode, resolved := g.resolveStatusCode(call.Args[2]); resolved {
+					responses[statusCode] = nil
+				}
+
+				return true
+			}
+
 			if (isWriteJSON || isWriteError) && len(call.Args) >= 2 {
 				statusCode, resolved := g.resolveStatusCode(call.Args[1])
 				if !resolved {
@@ -413,9 +428,9 @@ func (g *schemaGenerator) extractRequestInfo(reqStruct *types.Struct) (openapi3.
 
 	var requestBody *openapi3.RequestBodyRef
 
-	var processRequestStruct func(s *types.Struct)
+	var processRequestStruct func(s *types.Struct, sortFields []string)
 
-	processRequestStruct = func(s *types.Struct) {
+	processRequestStruct = func(s *types.Struct, sortFields []string) {
 		if s == nil {
 			return
 		}
@@ -432,20 +447,37 @@ func (g *schemaGenerator) extractRequestInfo(reqStruct *types.Struct) (openapi3.
 					embeddedStruct, _ = field.Type().Underlying().(*types.Struct)
 				}
 
-				processRequestStruct(embeddedStruct)
+				// the allowed sort fields of an embedded database.PageRequest, e.g: `sort:"title,author"`,
+				// or the keys of a database.Sortable variable of the package, e.g: `sortable:"bookSortable"`
+				embeddedSortFields := sortFields
+				if sortTag, ok := st.Lookup("sort"); ok {
+					embeddedSortFields = strings.Split(sortTag, ",")
+				}
+
+				if sortableTag, ok := st.Lookup("sortable"); ok {
+					embeddedSortFields = g.sortableFields(sortableTag)
+				}
+
+				processRequestStruct(embeddedStruct, embeddedSortFields)
 
 				continue
 			}
 
 			isRequired := false
+			isOptional := false
 
 			if validateTag := st.Get("validate"); validateTag != "" {
 				if slices.Contains(strings.Split(validateTag, ","), "required") {
 					isRequired = true
 				}
+
+				if slices.Contains(strings.Split(validateTag, ","), "omitempty") {
+					isOptional = true
+				}
 			}
 
 			_, isPointer := field.Type().(*types.Pointer)
+			isPointer = isPointer || isOptional
 
 			paramName, isParam := st.Lookup("path")
 			queryName, isQuery := st.Lookup("query")
@@ -458,10 +490,24 @@ func (g *schemaGenerator) extractRequestInfo(reqStruct *types.Struct) (openapi3.
 				p.Schema = g.goTypeToSchemaRef(field.Type())
 				p.Required = true
 				params = append(params, &openapi3.ParameterRef{Value: p})
+			case isQuery && queryName == "*":
+				// the allowed filters of a database.Filter, e.g: `filter:"title:eq,ilike"`,
+				// or the fields and operators of a database.Filterable variable of the package, e.g: `filterable:"bookFilterable"`
+				filterTag := st.Get("filter")
+				if filterableTag, ok := st.Lookup("filterable"); ok {
+					filterTag = g.filterableTag(filterableTag)
+				}
+
+				params = append(params, filterParameters(filterTag)...)
 			case isQuery:
 				p := openapi3.NewQueryParameter(queryName)
 				p.Schema = g.goTypeToSchemaRef(field.Type())
 				p.Required = isRequired || !isPointer
+
+				if queryName == "sort" && len(sortFields) > 0 {
+					// cursor pagination does not support null handling
+					p.Schema = sortSchema(sortFields, !hasQueryField(s, "cursor"))
+				}
 				params = append(params, &openapi3.ParameterRef{Value: p})
 			case isHeader:
 				p := openapi3.NewHeaderParameter(headerName)
@@ -477,11 +523,227 @@ func (g *schemaGenerator) extractRequestInfo(reqStruct *types.Struct) (openapi3.
 		}
 	}
 
-	processRequestStruct(reqStruct)
+	processRequestStruct(reqStruct, nil)
 
 	return params, requestBody
 }
 
+// sortableFields returns the sort fields of a package-level variable initialized with a map literal,
+// e.g: `var bookSortable = database.Sortable{"title": "title"}`, so that the documented sort fields
+// are the allow-list used by the repository.
+func (g *schemaGenerator) sortableFields(name string) []string {
+	literal := g.mapLiteral(name, "sortable")
+	if literal == nil {
+		return nil
+	}
+
+	return g.literalKeys(literal)
+}
+
+// filterableTag returns the `filter` tag of a package-level variable initialized with a map literal,
+// e.g: `var bookFilterable = database.Filterable{"title": {Operators: []database.FilterOperator{database.FilterEq}}}`
+// results in `title:eq`, so that the documented filters are the allow-list used by the repository.
+func (g *schemaGenerator) filterableTag(name string) string {
+	literal := g.mapLiteral(name, "filterable")
+	if literal == nil {
+		return ""
+	}
+
+	fieldSpecs := []string{}
+
+	for _, elt := range literal.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+
+		field := g.constantString(kv.Key)
+		value, ok := kv.Value.(*ast.CompositeLit)
+		if field == "" || !ok {
+			continue
+		}
+
+		operators := []string{}
+
+		for _, fieldElt := range value.Elts {
+			fieldKV, ok := fieldElt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+
+			if ident, ok := fieldKV.Key.(*ast.Ident); !ok || ident.Name != "Operators" {
+				continue
+			}
+
+			operatorsLiteral, ok := fieldKV.Value.(*ast.CompositeLit)
+			if !ok {
+				log.Printf("Warning: operators of filterable field %s of %s are not a slice literal", field, name)
+				break
+			}
+
+			for _, operator := range operatorsLiteral.Elts {
+				if op := g.constantString(operator); op != "" {
+					operators = append(operators, op)
+				}
+			}
+		}
+
+		if len(operators) > 0 {
+			fieldSpecs = append(fieldSpecs, field+":"+strings.Join(operators, ","))
+		}
+	}
+
+	return strings.Join(fieldSpecs, ";")
+}
+
+// mapLiteral returns the map literal a package-level variable is initialized with,
+// logging a warning which names the kind of the variable if there is none.
+func (g *schemaGenerator) mapLiteral(name, kind string) *ast.CompositeLit {
+	obj := g.pkg.Types.Scope().Lookup(name)
+	if obj == nil {
+		log.Printf("Warning: %s variable %s not found in package %s", kind, name, g.pkg.PkgPath)
+		return nil
+	}
+
+	for _, file := range g.pkg.Syntax {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.VAR {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				vs, ok := spec.(*ast.ValueSpec)
+				if !ok {
+					continue
+				}
+
+				for i, ident := range vs.Names {
+					if g.typesInfo.Defs[ident] != obj || i >= len(vs.Values) {
+						continue
+					}
+
+					literal, ok := vs.Values[i].(*ast.CompositeLit)
+					if !ok {
+						break
+					}
+
+					return literal
+				}
+			}
+		}
+	}
+
+	log.Printf("Warning: %s variable %s is not initialized with a map literal", kind, name)
+
+	return nil
+}
+
+// literalKeys returns the constant string keys of a map literal in their order.
+func (g *schemaGenerator) literalKeys(literal *ast.CompositeLit) []string {
+	keys := []string{}
+
+	for _, elt := range literal.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+
+		if key := g.constantString(kv.Key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// constantString returns the value of a constant string expression, e.g: "title" or database.FilterEq,
+// or an empty string if it is not one.
+func (g *schemaGenerator) constantString(expr ast.Expr) string {
+	if tv, ok := g.typesInfo.Types[expr]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+		return constant.StringVal(tv.Value)
+	}
+
+	return ""
+}
+
+// sortSchema creates the schema of the sort query parameter, which enumerates every
+// sort command allowed for the given sort fields.
+func sortSchema(sortFields []string, withNulls bool) *openapi3.SchemaRef {
+	commands := []any{}
+
+	for _, field := range sortFields {
+		field = strings.TrimSpace(field)
+		commands = append(commands, field)
+
+		for _, direction := range []string{"asc", "desc"} {
+			commands = append(commands, field+","+direction)
+
+			if withNulls {
+				commands = append(commands, field+","+direction+",nullsfirst", field+","+direction+",nullslast")
+			}
+		}
+	}
+
+	items := openapi3.NewStringSchema()
+	items.Enum = commands
+
+	schema := openapi3.NewArraySchema()
+	schema.Items = openapi3.NewSchemaRef("", items)
+	schema.Description = "Sort commands of the format field[,asc|desc]"
+
+	if withNulls {
+		schema.Description = "Sort commands of the format field[,asc|desc[,nullsfirst|nullslast]]"
+	}
+
+	return openapi3.NewSchemaRef("", schema)
+}
+
+// filterParameters creates the optional query parameters of a `filter` tag of the format
+// `field:operator,operator;field:operator`, e.g: `title:eq,ilike;id:in` creates title[eq], title[ilike] and id[in].
+func filterParameters(filterTag string) openapi3.Parameters {
+	params := openapi3.NewParameters()
+
+	for _, fieldSpec := range strings.Split(filterTag, ";") {
+		field, operators, ok := strings.Cut(strings.TrimSpace(fieldSpec), ":")
+		if !ok {
+			continue
+		}
+
+		for _, operator := range strings.Split(operators, ",") {
+			operator = strings.TrimSpace(operator)
+
+			p := openapi3.NewQueryParameter(field + "[" + operator + "]")
+			p.Schema = openapi3.NewStringSchema().NewRef()
+
+			switch operator {
+			case "in":
+				p.Description = "Filter " + field + " by comma separated values"
+			case "null":
+				p.Schema = openapi3.NewBoolSchema().NewRef()
+				p.Description = "Filter " + field + " by whether it is null"
+			default:
+				p.Description = "Filter " + field + " by the " + operator + " operator"
+			}
+
+			params = append(params, &openapi3.ParameterRef{Value: p})
+		}
+	}
+
+	return params
+}
+
+// hasQueryField reports whether the struct has a field bound to the given query parameter.
+func hasQueryField(s *types.Struct, queryName string) bool {
+	for i := 0; i < s.NumFields(); i++ {
+		if name, ok := reflect.StructTag(s.Tag(i)).Lookup("query"); ok && name == queryName {
+			return true
+		}
+	}
+
+	return false
+}
+
 // goTypeToSchemaRef is the public entry point for converting a Go type into an OpenAPI Schema Reference.
 func (g *schemaGenerator) goTypeToSchemaRef(typ types.Type) *openapi3.SchemaRef {
 	// Start the recursive process without any initial substitutions.
@@ -4,9 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
 )
 
+// QueryUnmarshaler is implemented by fields with the `query:"*"` tag, which are parsed from all query parameters,
+// such as database.Filter.
+type QueryUnmarshaler interface {
+	UnmarshalQuery(values url.Values) error
+}
+
 // ParseRequest parses the HTTP request and populates the provided struct with the data from the request.
 // It supports parsing from context, headers, path parameters, query parameters, and JSON body.
 //
@@ -17,6 +24,7 @@ import (
 //	    Name string    `header:"X-Name"`
 //	    Age  int       `path:"age"`
 //	    Tags []string  `query:"tags"`
+//	    All  MyFilter  `query:"*"`
 //	    Data MyData    `body:"json"`
 //	 }
 //
@@ -72,6 +80,20 @@ func ParseRequest(r *http.Request, req any) error {
 		}
 
 		tagName = field.Tag.Get("query")
+		if tagName == "*" {
+			unmarshaler, ok := val.Field(i).Addr().Interface().(QueryUnmarshaler)
+			if !ok {
+				return fmt.Errorf("query field %s must implement QueryUnmarshaler", field.Name)
+			}
+
+			err := unmarshaler.UnmarshalQuery(r.URL.Query())
+			if err != nil {
+				return fmt.Errorf("error parsing query field %s: %w", field.Name, err)
+			}
+
+			continue
+		}
+
 		if tagName != "" {
 			queryValues := r.URL.Query()[tagName]
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -112,3 +113,27 @@ func WriteError(w http.ResponseWriter, status int, message string) {
 		http.Error(w, fmt.Sprintf("failed to write error response: %v", err), http.StatusInternalServerError)
 	}
 }
+
+// StatusError is implemented by errors which carry the HTTP status code they should be returned with,
+// such as database.SortError.
+type StatusError interface {
+	error
+	HTTPStatus() int
+}
+
+// ErrorStatus returns the status code of the first error in the chain implementing StatusError,
+// or the fallback status code if there is none.
+func ErrorStatus(err error, fallback int) int {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.HTTPStatus()
+	}
+
+	return fallback
+}
+
+// WriteErrorFrom writes the error message to the http.ResponseWriter with the status code carried by the error,
+// see ErrorStatus, or with the fallback status code if it carries none.
+func WriteErrorFrom(w http.ResponseWriter, err error, fallback int) {
+	WriteError(w, ErrorStatus(err, fallback), err.Error())
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -237,3 +240,92 @@ func TestServer(t *testing.T) {
 		}
 	})
 }
+
+type conflictError struct{}
+
+func (conflictError) Error() string   { return "already exists" }
+func (conflictError) HTTPStatus() int { return http.StatusConflict }
+
+func TestWriteErrorFrom(t *testing.T) {
+	t.Run("status carried by the error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		WriteErrorFrom(w, fmt.Errorf("failed to save: %w", conflictError{}), http.StatusInternalServerError)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.JSONEq(t, `{"error":"failed to save: already exists"}`, w.Body.String())
+	})
+
+	t.Run("fallback status", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		WriteErrorFrom(w, errors.New("connection refused"), http.StatusInternalServerError)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.JSONEq(t, `{"error":"connection refused"}`, w.Body.String())
+	})
+}
+
+func TestETag(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetETag(w, 3)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	for header, want := range map[string]IfMatch{
+		"":       {},
+		"*":      {Present: true, Any: true},
+		`"3"`:    {Present: true, Version: 3},
+		` "42" `: {Present: true, Version: 42},
+	} {
+		ifMatch, err := ParseIfMatch(header)
+		assert.NoError(t, err)
+		assert.Equal(t, want, ifMatch, header)
+	}
+
+	for _, header := range []string{`W/"3"`, `"3", "4"`, `"three"`} {
+		_, err := ParseIfMatch(header)
+		assert.ErrorIs(t, err, ErrPreconditionFailed, header)
+		assert.Equal(t, http.StatusPreconditionFailed, ErrorStatus(err, http.StatusBadRequest), header)
+	}
+
+	for _, header := range []string{"3", `"3`} {
+		_, err := ParseIfMatch(header)
+		assert.Error(t, err, header)
+		assert.NotErrorIs(t, err, ErrPreconditionFailed, header)
+	}
+}
+
+type queryParams map[string]string
+
+func (q *queryParams) UnmarshalQuery(values url.Values) error {
+	*q = queryParams{}
+
+	for key := range values {
+		if values.Get(key) == "invalid" {
+			return errors.New("invalid value")
+		}
+
+		(*q)[key] = values.Get(key)
+	}
+
+	return nil
+}
+
+func TestParseRequestQueryUnmarshaler(t *testing.T) {
+	var req struct {
+		Page   int         `query:"page"`
+		Params queryParams `query:"*"`
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/books?page=2&title[ilike]=go", nil)
+	assert.NoError(t, ParseRequest(r, &req))
+	assert.Equal(t, 2, req.Page)
+	assert.Equal(t, queryParams{"page": "2", "title[ilike]": "go"}, req.Params)
+
+	r = httptest.NewRequest(http.MethodGet, "/books?title[ilike]=invalid", nil)
+	assert.Error(t, ParseRequest(r, &req))
+
+	var notUnmarshaler struct {
+		Params map[string]string `query:"*"`
+	}
+
+	assert.Error(t, ParseRequest(r, &notUnmarshaler))
+}